@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+)
+
+const (
+	bucketCopyStatusPending   = "pending"
+	bucketCopyStatusRunning   = "running"
+	bucketCopyStatusCompleted = "completed"
+	bucketCopyStatusFailed    = "failed"
+	bucketCopyStatusCanceled  = "canceled"
+)
+
+// bucketCopyRuns associe aux jobs en cours la fonction qui les annule
+var bucketCopyRuns sync.Map
+
+type StartBucketCopyRequest struct {
+	DestProjectID uint    `json:"destProjectId"`
+	SourceBucket  string  `json:"sourceBucket"`
+	SourcePrefix  string  `json:"sourcePrefix,omitempty"`
+	DestBucket    string  `json:"destBucket,omitempty"` // Par défaut le nom du bucket source
+	DestPrefix    *string `json:"destPrefix,omitempty"` // Par défaut sourcePrefix ("" pour copier à la racine)
+	Concurrency   int     `json:"concurrency,omitempty"`
+	Overwrite     bool    `json:"overwrite,omitempty"`    // Remplacer les objets différents déjà présents
+	CreateBucket  bool    `json:"createBucket,omitempty"` // Créer le bucket de destination s'il n'existe pas
+}
+
+type BucketCopyJobRequest struct {
+	ID     uint   `json:"id,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+}
+
+func bucketCopyActive(status string) bool {
+	return status == bucketCopyStatusPending || status == bucketCopyStatusRunning
+}
+
+// findBucketCopyJob charge un job dont le projet est la source ou la destination
+func findBucketCopyJob(config s3.S3ConfigData, id uint) (BucketCopyJob, error) {
+	var job BucketCopyJob
+	err := db.Where("id = ? AND user_id = ? AND (project_id = ? OR dest_project_id = ?)", id, config.UserID, config.ID, config.ID).First(&job).Error
+	return job, err
+}
+
+// runBucketCopyJob copie les objets depuis le checkpoint du job. Un job interrompu (redémarrage)
+// reprend après la dernière clé enregistrée ; les objets déjà identiques sont de toute façon sautés.
+func runBucketCopyJob(jobID uint) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, running := bucketCopyRuns.LoadOrStore(jobID, cancel); running {
+		return
+	}
+	defer bucketCopyRuns.Delete(jobID)
+
+	var job BucketCopyJob
+	// Un job annulé avant d'avoir démarré ne doit pas repartir
+	if err := db.First(&job, jobID).Error; err != nil || !bucketCopyActive(job.Status) {
+		return
+	}
+
+	fail := func(err error) {
+		now := time.Now()
+		db.Model(&job).Updates(map[string]interface{}{"status": bucketCopyStatusFailed, "last_error": err.Error(), "finished_at": &now})
+		LogActivity(db, job.ProjectID, job.UserID, "copy_bucket", fmt.Sprintf("Copy of %s/%s to project %d failed: %v", job.SourceBucket, job.SourcePrefix, job.DestProjectID, err), "error")
+	}
+
+	// Les deux projets doivent toujours appartenir à l'utilisateur qui a lancé la copie
+	srcConfig, err := getS3Config(job.ProjectID, job.UserID)
+	if err != nil {
+		fail(fmt.Errorf("source project not found"))
+		return
+	}
+	dstConfig, err := getS3Config(job.DestProjectID, job.UserID)
+	if err != nil {
+		fail(fmt.Errorf("destination project not found"))
+		return
+	}
+	srcClient, err := objectIndexClient(job.ProjectID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	dstClient, err := objectIndexClient(job.DestProjectID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	db.Model(&job).Updates(map[string]interface{}{"status": bucketCopyStatusRunning, "last_error": ""})
+
+	// Les compteurs repartent de ceux d'une exécution précédente interrompue
+	base := job
+	saveProgress := func(p s3.CopyObjectsProgress) {
+		updates := map[string]interface{}{
+			"checkpoint":      p.Checkpoint,
+			"objects_copied":  base.ObjectsCopied + p.ObjectsCopied,
+			"objects_skipped": base.ObjectsSkipped + p.ObjectsSkipped,
+			"bytes_copied":    base.BytesCopied + p.BytesCopied,
+			"conflicts":       base.Conflicts + p.Conflicts,
+			"failed":          base.Failed + p.Failed,
+		}
+		if p.LastError != "" {
+			updates["last_error"] = p.LastError
+		}
+		db.Model(&job).Updates(updates)
+	}
+
+	progress, err := s3.CopyObjects(ctx, srcClient, srcConfig, dstClient, dstConfig, s3.CopyObjectsOptions{
+		SourceBucket: job.SourceBucket,
+		SourcePrefix: job.SourcePrefix,
+		DestBucket:   job.DestBucket,
+		DestPrefix:   job.DestPrefix,
+		StartAfter:   job.Checkpoint,
+		Concurrency:  job.Concurrency,
+		Overwrite:    job.Overwrite,
+	}, saveProgress)
+	saveProgress(progress)
+
+	now := time.Now()
+	// L'annulation peut aussi remonter comme une erreur de listing
+	if ctx.Err() == context.Canceled {
+		db.Model(&job).Updates(map[string]interface{}{"status": bucketCopyStatusCanceled, "finished_at": &now})
+		LogActivity(db, job.ProjectID, job.UserID, "copy_bucket", fmt.Sprintf("Canceled copy of %s/%s to project %d", job.SourceBucket, job.SourcePrefix, job.DestProjectID), "success")
+		return
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	failed := base.Failed + progress.Failed
+	if failed > 0 {
+		fail(fmt.Errorf("%d objects could not be copied, last error: %s", failed, progress.LastError))
+		return
+	}
+
+	db.Model(&job).Updates(map[string]interface{}{"status": bucketCopyStatusCompleted, "finished_at": &now})
+	details := fmt.Sprintf("Copied %s/%s from project %d to %s/%s in project %d (%d copied, %d already present, %d conflicts)",
+		job.SourceBucket, job.SourcePrefix, job.ProjectID, job.DestBucket, job.DestPrefix, job.DestProjectID,
+		base.ObjectsCopied+progress.ObjectsCopied, base.ObjectsSkipped+progress.ObjectsSkipped, base.Conflicts+progress.Conflicts)
+	LogActivity(db, job.ProjectID, job.UserID, "copy_bucket", details, "success")
+	if job.DestProjectID != job.ProjectID {
+		LogActivity(db, job.DestProjectID, job.UserID, "copy_bucket", details, "success")
+	}
+}
+
+// resumeBucketCopyJobs relance au démarrage les copies interrompues
+func resumeBucketCopyJobs() {
+	var jobs []BucketCopyJob
+	if err := db.Where("status IN ?", []string{bucketCopyStatusPending, bucketCopyStatusRunning}).Find(&jobs).Error; err != nil {
+		log.Printf("Failed to resume bucket copy jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		go runBucketCopyJob(job.ID)
+	}
+}
+
+// HandleStartBucketCopy gère POST /api/{projectId}/s3/copy-bucket : copie un bucket (ou un préfixe)
+// du projet courant vers un autre projet de l'utilisateur dans un job en arrière-plan (202)
+func HandleStartBucketCopy(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req StartBucketCopyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.DestProjectID == 0 || req.SourceBucket == "" {
+		jsonError(w, "destProjectId and sourceBucket are required", http.StatusBadRequest)
+		return
+	}
+	if req.DestBucket == "" {
+		req.DestBucket = req.SourceBucket
+	}
+	destPrefix := req.SourcePrefix
+	if req.DestPrefix != nil {
+		destPrefix = *req.DestPrefix
+	}
+	if req.Concurrency < 0 || req.Concurrency > s3.MaxCopyConcurrency {
+		jsonError(w, fmt.Sprintf("concurrency must be between 1 and %d", s3.MaxCopyConcurrency), http.StatusBadRequest)
+		return
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = s3.DefaultCopyConcurrency
+	}
+	// Une destination incluse dans la source (ou l'inverse) serait relistée pendant la copie
+	if req.DestProjectID == config.ID && req.DestBucket == req.SourceBucket &&
+		(strings.HasPrefix(destPrefix, req.SourcePrefix) || strings.HasPrefix(req.SourcePrefix, destPrefix)) {
+		jsonError(w, "Source and destination overlap", http.StatusBadRequest)
+		return
+	}
+
+	dstConfig, err := getS3Config(req.DestProjectID, config.UserID)
+	if err != nil {
+		jsonError(w, "Destination project not found", http.StatusNotFound)
+		return
+	}
+
+	srcClient, ok := s3ClientForRequest(w, config, "", "")
+	if !ok {
+		return
+	}
+	if exists, err := srcClient.BucketExists(r.Context(), req.SourceBucket); err != nil || !exists {
+		jsonError(w, "Source bucket not found", http.StatusNotFound)
+		return
+	}
+
+	dstCreds, err := s3.GetS3Credentials(dstConfig, "", "")
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to get destination credentials: %v", err), http.StatusBadGateway)
+		return
+	}
+	dstClient, err := s3.CreateS3Client(dstCreds)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to create destination client: %v", err), http.StatusBadGateway)
+		return
+	}
+	exists, err := dstClient.BucketExists(r.Context(), req.DestBucket)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to check destination bucket: %v", err), http.StatusBadGateway)
+		return
+	}
+	if !exists {
+		if !req.CreateBucket {
+			jsonError(w, "Destination bucket not found (set createBucket to create it)", http.StatusNotFound)
+			return
+		}
+		if err := dstClient.MakeBucket(r.Context(), req.DestBucket, minio.MakeBucketOptions{Region: dstCreds.Region}); err != nil {
+			jsonError(w, fmt.Sprintf("Failed to create destination bucket: %v", err), http.StatusBadGateway)
+			return
+		}
+		LogActivity(db, dstConfig.ID, config.UserID, "create_bucket", fmt.Sprintf("Created bucket %s for a copy from project %d", req.DestBucket, config.ID), "success")
+	}
+
+	// La même copie déjà en cours est renvoyée telle quelle
+	var job BucketCopyJob
+	err = db.Where("project_id = ? AND dest_project_id = ? AND source_bucket = ? AND source_prefix = ? AND dest_bucket = ? AND dest_prefix = ? AND status IN ?",
+		config.ID, req.DestProjectID, req.SourceBucket, req.SourcePrefix, req.DestBucket, destPrefix,
+		[]string{bucketCopyStatusPending, bucketCopyStatusRunning}).First(&job).Error
+	if err == gorm.ErrRecordNotFound {
+		job = BucketCopyJob{
+			ProjectID:     config.ID,
+			UserID:        config.UserID,
+			DestProjectID: req.DestProjectID,
+			SourceBucket:  req.SourceBucket,
+			SourcePrefix:  req.SourcePrefix,
+			DestBucket:    req.DestBucket,
+			DestPrefix:    destPrefix,
+			Concurrency:   req.Concurrency,
+			Overwrite:     req.Overwrite,
+			Status:        bucketCopyStatusPending,
+		}
+		err = db.Create(&job).Error
+		if err == nil {
+			LogActivity(db, config.ID, config.UserID, "copy_bucket", fmt.Sprintf("Started copy of %s/%s to %s/%s in project %d", req.SourceBucket, req.SourcePrefix, req.DestBucket, destPrefix, req.DestProjectID), "success")
+			go runBucketCopyJob(job.ID)
+		}
+	}
+	if err != nil {
+		jsonError(w, "Failed to create copy job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"job": job})
+}
+
+// HandleListBucketCopyJobs gère POST /api/{projectId}/s3/list-bucket-copy-jobs (un job précis avec
+// id, ou les copies dont le projet est la source ou la destination, éventuellement filtrées par bucket)
+func HandleListBucketCopyJobs(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BucketCopyJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	query := db.Where("user_id = ? AND (project_id = ? OR dest_project_id = ?)", config.UserID, config.ID, config.ID)
+	if req.ID != 0 {
+		query = query.Where("id = ?", req.ID)
+	}
+	if req.Bucket != "" {
+		query = query.Where("source_bucket = ? OR dest_bucket = ?", req.Bucket, req.Bucket)
+	}
+
+	jobs := []BucketCopyJob{}
+	if err := query.Order("created_at desc").Limit(100).Find(&jobs).Error; err != nil {
+		jsonError(w, "Failed to fetch jobs", http.StatusInternalServerError)
+		return
+	}
+	if req.ID != 0 && len(jobs) == 0 {
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": jobs})
+}
+
+// HandleCancelBucketCopy gère POST /api/{projectId}/s3/cancel-bucket-copy
+func HandleCancelBucketCopy(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BucketCopyJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	job, err := findBucketCopyJob(config, req.ID)
+	if err != nil {
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if !bucketCopyActive(job.Status) {
+		jsonError(w, "Job is not running", http.StatusConflict)
+		return
+	}
+
+	if cancel, ok := bucketCopyRuns.Load(job.ID); ok {
+		// Le job passe lui-même en "canceled" une fois les copies en cours arrêtées
+		cancel.(context.CancelFunc)()
+	} else {
+		now := time.Now()
+		db.Model(&job).Updates(map[string]interface{}{"status": bucketCopyStatusCanceled, "finished_at": &now})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": job.ID, "canceled": true})
+}
+
+// HandleResumeBucketCopy gère POST /api/{projectId}/s3/resume-bucket-copy. Un job annulé reprend
+// à son checkpoint ; un job en échec repart du début pour retenter les objets en erreur.
+func HandleResumeBucketCopy(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BucketCopyJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	job, err := findBucketCopyJob(config, req.ID)
+	if err != nil {
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.Status != bucketCopyStatusFailed && job.Status != bucketCopyStatusCanceled {
+		jsonError(w, "Only failed or canceled jobs can be resumed", http.StatusConflict)
+		return
+	}
+
+	updates := map[string]interface{}{"status": bucketCopyStatusPending, "last_error": "", "finished_at": nil}
+	if job.Failed > 0 {
+		// Le checkpoint a dépassé les objets en erreur : tout relister, les objets copiés seront sautés
+		updates["checkpoint"] = ""
+		updates["objects_copied"] = 0
+		updates["objects_skipped"] = 0
+		updates["bytes_copied"] = 0
+		updates["conflicts"] = 0
+		updates["failed"] = 0
+	}
+	if err := db.Model(&job).Updates(updates).Error; err != nil {
+		jsonError(w, "Failed to resume job", http.StatusInternalServerError)
+		return
+	}
+	db.First(&job, job.ID)
+
+	LogActivity(db, job.ProjectID, config.UserID, "copy_bucket", fmt.Sprintf("Resumed copy of %s/%s to project %d", job.SourceBucket, job.SourcePrefix, job.DestProjectID), "success")
+	go runBucketCopyJob(job.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"job": job})
+}
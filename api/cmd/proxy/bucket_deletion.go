@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	bucketDeletionStatusPending   = "pending"
+	bucketDeletionStatusRunning   = "running"
+	bucketDeletionStatusCompleted = "completed"
+	bucketDeletionStatusFailed    = "failed"
+
+	bucketDeletionTimeout = 24 * time.Hour
+)
+
+// bucketDeletionRuns empêche deux exécutions simultanées du même job
+var bucketDeletionRuns sync.Map
+
+type BucketProtectionRequest struct {
+	Bucket    string `json:"bucket"`
+	Protected bool   `json:"protected"`
+}
+
+type BucketDeletionJobRequest struct {
+	ID     uint   `json:"id,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+}
+
+// isBucketProtected indique si la suppression d'un bucket est interdite (branché sur s3.BucketProtectedFunc)
+func isBucketProtected(projectID uint, bucket string) (bool, error) {
+	var count int64
+	err := db.Model(&ProtectedBucket{}).Where("project_id = ? AND bucket = ?", projectID, bucket).Count(&count).Error
+	return count > 0, err
+}
+
+// startBucketDeletionJob crée (ou renvoie, s'il est déjà en cours) le job de suppression forcée
+// d'un bucket (branché sur s3.ForceDeleteBucketFunc)
+func startBucketDeletionJob(config s3.S3ConfigData, bucket string, bypassGovernance bool) (interface{}, error) {
+	var job BucketDeletionJob
+	err := db.Where("project_id = ? AND bucket = ? AND status IN ?", config.ID, bucket,
+		[]string{bucketDeletionStatusPending, bucketDeletionStatusRunning}).First(&job).Error
+	if err == nil {
+		return job, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	job = BucketDeletionJob{
+		ProjectID:        config.ID,
+		UserID:           config.UserID,
+		Bucket:           bucket,
+		Status:           bucketDeletionStatusPending,
+		BypassGovernance: bypassGovernance,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return nil, err
+	}
+
+	LogActivity(db, config.ID, config.UserID, "delete_bucket", fmt.Sprintf("Started force delete of bucket %s", bucket), "success")
+	go runBucketDeletionJob(job.ID)
+	return job, nil
+}
+
+// runBucketDeletionJob vide puis supprime le bucket. Un job interrompu (redémarrage) peut être
+// relancé tel quel : ce qui a déjà été supprimé n'est simplement plus listé.
+func runBucketDeletionJob(jobID uint) {
+	if _, running := bucketDeletionRuns.LoadOrStore(jobID, true); running {
+		return
+	}
+	defer bucketDeletionRuns.Delete(jobID)
+
+	var job BucketDeletionJob
+	if err := db.First(&job, jobID).Error; err != nil {
+		return
+	}
+
+	fail := func(err error) {
+		now := time.Now()
+		db.Model(&job).Updates(map[string]interface{}{"status": bucketDeletionStatusFailed, "last_error": err.Error(), "finished_at": &now})
+		LogActivity(db, job.ProjectID, job.UserID, "delete_bucket", fmt.Sprintf("Force delete of bucket %s failed: %v", job.Bucket, err), "error")
+	}
+
+	// La protection a pu être posée entre la demande et l'exécution
+	if protected, err := isBucketProtected(job.ProjectID, job.Bucket); err != nil || protected {
+		if err == nil {
+			err = fmt.Errorf("bucket is protected against deletion")
+		}
+		fail(err)
+		return
+	}
+
+	client, err := objectIndexClient(job.ProjectID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	db.Model(&job).Updates(map[string]interface{}{"status": bucketDeletionStatusRunning, "last_error": ""})
+
+	ctx, cancel := context.WithTimeout(context.Background(), bucketDeletionTimeout)
+	defer cancel()
+
+	// Les compteurs repartent de ceux d'une exécution précédente interrompue
+	base := s3.EmptyBucketProgress{ObjectsDeleted: job.ObjectsDeleted, UploadsAborted: job.UploadsAborted}
+	saveProgress := func(p s3.EmptyBucketProgress) {
+		db.Model(&job).Updates(map[string]interface{}{
+			"objects_deleted": base.ObjectsDeleted + p.ObjectsDeleted,
+			"uploads_aborted": base.UploadsAborted + p.UploadsAborted,
+			"failed":          p.Failed,
+		})
+	}
+
+	progress, err := s3.EmptyBucket(ctx, client, job.Bucket, job.BypassGovernance, saveProgress)
+	saveProgress(progress)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := client.RemoveBucket(ctx, job.Bucket); err != nil {
+		fail(fmt.Errorf("failed to delete bucket: %v", err))
+		return
+	}
+
+	forgetBucket(job.ProjectID, job.Bucket)
+
+	now := time.Now()
+	db.Model(&job).Updates(map[string]interface{}{"status": bucketDeletionStatusCompleted, "finished_at": &now})
+	LogActivity(db, job.ProjectID, job.UserID, "delete_bucket", fmt.Sprintf("Force deleted bucket %s (%d objects and versions, %d incomplete uploads)",
+		job.Bucket, base.ObjectsDeleted+progress.ObjectsDeleted, base.UploadsAborted+progress.UploadsAborted), "success")
+}
+
+// forgetBucket supprime ce que kexamanager conservait sur un bucket qui n'existe plus
+func forgetBucket(projectID uint, bucket string) {
+	db.Transaction(func(tx *gorm.DB) error {
+		var idx ObjectIndex
+		if err := tx.Where("project_id = ? AND bucket = ?", projectID, bucket).First(&idx).Error; err == nil {
+			tx.Where("index_id = ?", idx.ID).Delete(&ObjectIndexEntry{})
+			tx.Unscoped().Delete(&idx)
+		}
+		tx.Unscoped().Where("project_id = ? AND bucket = ?", projectID, bucket).Delete(&TrashEntry{})
+		tx.Model(&MultipartUpload{}).Where("project_id = ? AND bucket = ? AND status = ?", projectID, bucket, multipartStatusInProgress).
+			Update("status", multipartStatusAborted)
+		return nil
+	})
+}
+
+// resumeBucketDeletionJobs relance au démarrage les jobs interrompus
+func resumeBucketDeletionJobs() {
+	var jobs []BucketDeletionJob
+	if err := db.Where("status IN ?", []string{bucketDeletionStatusPending, bucketDeletionStatusRunning}).Find(&jobs).Error; err != nil {
+		log.Printf("Failed to resume bucket deletion jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		go runBucketDeletionJob(job.ID)
+	}
+}
+
+// HandleSetBucketProtection gère POST /api/{projectId}/s3/set-bucket-protection
+func HandleSetBucketProtection(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BucketProtectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Bucket == "" {
+		jsonError(w, "bucket is required", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.Protected {
+		err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&ProtectedBucket{
+			ProjectID: config.ID,
+			Bucket:    req.Bucket,
+			UserID:    config.UserID,
+		}).Error
+	} else {
+		err = db.Unscoped().Where("project_id = ? AND bucket = ?", config.ID, req.Bucket).Delete(&ProtectedBucket{}).Error
+	}
+	if err != nil {
+		jsonError(w, "Failed to update bucket protection", http.StatusInternalServerError)
+		return
+	}
+
+	details := fmt.Sprintf("Protected bucket %s against deletion", req.Bucket)
+	if !req.Protected {
+		details = fmt.Sprintf("Removed deletion protection of bucket %s", req.Bucket)
+	}
+	LogActivity(db, config.ID, config.UserID, "set_bucket_protection", details, "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"bucket": req.Bucket, "protected": req.Protected})
+}
+
+// HandleListProtectedBuckets gère POST /api/{projectId}/s3/list-protected-buckets
+func HandleListProtectedBuckets(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	buckets := []ProtectedBucket{}
+	if err := db.Where("project_id = ?", config.ID).Order("bucket").Find(&buckets).Error; err != nil {
+		jsonError(w, "Failed to fetch protected buckets", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"buckets": buckets})
+}
+
+// HandleListBucketDeletionJobs gère POST /api/{projectId}/s3/list-bucket-deletion-jobs
+// (un job précis avec id, ou tous les jobs du projet, éventuellement filtrés par bucket)
+func HandleListBucketDeletionJobs(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BucketDeletionJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	query := db.Where("project_id = ?", config.ID)
+	if req.ID != 0 {
+		query = query.Where("id = ?", req.ID)
+	}
+	if req.Bucket != "" {
+		query = query.Where("bucket = ?", req.Bucket)
+	}
+
+	jobs := []BucketDeletionJob{}
+	if err := query.Order("created_at desc").Limit(100).Find(&jobs).Error; err != nil {
+		jsonError(w, "Failed to fetch jobs", http.StatusInternalServerError)
+		return
+	}
+	if req.ID != 0 && len(jobs) == 0 {
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": jobs})
+}
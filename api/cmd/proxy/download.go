@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+)
+
+const (
+	downloadModePresign = "presign"
+	downloadModeProxy   = "proxy"
+)
+
+// errDownloadSigningNotConfigured : sans DOWNLOAD_SIGNING_KEY, aucune URL de téléchargement n'est
+// signée ni acceptée (le secret JWT a une valeur par défaut connue de tous)
+var errDownloadSigningNotConfigured = errors.New("DOWNLOAD_SIGNING_KEY is not configured, proxied download links are disabled")
+
+func downloadSigningKey() ([]byte, error) {
+	secret := strings.TrimSpace(os.Getenv("DOWNLOAD_SIGNING_KEY"))
+	if secret == "" {
+		return nil, errDownloadSigningNotConfigured
+	}
+	return []byte(secret), nil
+}
+
+// signDownload signe (projet, bucket, clé, version, clé SSE-C du trousseau, expiration) avec DOWNLOAD_SIGNING_KEY.
+// Les URLs signées permettent d'utiliser download-object sans en-tête Authorization,
+// par exemple dans une balise <img> ou un lien de téléchargement.
+func signDownload(projectID uint, bucket, key, versionID, sseKeyName string, expires int64) (string, error) {
+	secret, err := downloadSigningKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s\n%s\n%d", projectID, bucket, key, versionID, sseKeyName, expires)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// proxyDownloadURL construit une URL signée vers download-object
+func proxyDownloadURL(projectID uint, req s3.GetObjectRequest, expiry time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(expiry)
+	signature, err := signDownload(projectID, req.Bucket, req.Key, req.VersionID, req.SSEKeyName, expiresAt.Unix())
+	if err != nil {
+		return "", expiresAt, err
+	}
+	params := url.Values{}
+	params.Set("bucket", req.Bucket)
+	params.Set("key", req.Key)
+	if req.VersionID != "" {
+		params.Set("versionId", req.VersionID)
+	}
+	if req.SSEKeyName != "" {
+		params.Set("sseKeyName", req.SSEKeyName)
+	}
+	params.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	params.Set("signature", signature)
+	return fmt.Sprintf("/api/%d/s3/download-object?%s", projectID, params.Encode()), expiresAt, nil
+}
+
+// handleSignedDownload sert download-object pour une URL signée, sans JWT
+func handleSignedDownload(w http.ResponseWriter, r *http.Request, projectID uint) {
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		jsonError(w, "Download link expired", http.StatusForbidden)
+		return
+	}
+
+	expected, err := signDownload(projectID, query.Get("bucket"), query.Get("key"), query.Get("versionId"), query.Get("sseKeyName"), expires)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		jsonError(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+
+	var config S3Config
+	if err := db.Where("id = ?", projectID).First(&config).Error; err != nil {
+		jsonError(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	s3.HandleDownloadObjectWithConfig(toS3ConfigData(config)).ServeHTTP(w, r)
+}
+
+// HandleGetObject gère get-object : URL présignée vers S3, ou URL signée vers download-object pour
+// les projets en mode "proxy" et les objets SSE-C (un navigateur ne peut pas envoyer la clé à S3).
+func HandleGetObject(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		jsonError(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+	var req s3.GetObjectRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	sseC := req.SSECustomerKey != "" || req.SSEKeyName != "" ||
+		(config.DefaultEncryption == s3.EncryptionSSEC && req.SSE != s3.EncryptionNone)
+	if config.DownloadMode != downloadModeProxy && !sseC {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s3.HandleGetObjectWithConfig(config).ServeHTTP(w, r)
+		return
+	}
+
+	handleGetObjectProxied(w, config, req)
+}
+
+// handleGetObjectProxied renvoie une URL pointant vers kexamanager plutôt que vers S3URL,
+// souvent inaccessible aux navigateurs.
+func handleGetObjectProxied(w http.ResponseWriter, config s3.S3ConfigData, req s3.GetObjectRequest) {
+	if req.Bucket == "" || req.Key == "" {
+		jsonError(w, "bucket and key are required", http.StatusBadRequest)
+		return
+	}
+
+	// Une clé fournie en clair ne doit jamais finir dans une URL (historique, logs)
+	if req.SSECustomerKey != "" {
+		jsonError(w, "A per-request SSE-C key cannot be embedded in a download link: store it in the project keyring and pass sseKeyName, or call download-object with the X-Amz-Server-Side-Encryption-Customer-Key header", http.StatusBadRequest)
+		return
+	}
+
+	// Même plafond que les URLs présignées S3 (7 jours)
+	downloadURL, expiresAt, err := proxyDownloadURL(config.ID, req, s3.PresignExpiry(req.ExpiresIn))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s3.GetObjectResponse{
+		PresignedURL: downloadURL,
+		ExpiresAt:    expiresAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"gorm.io/gorm"
+)
+
+type CreateSSEKeyRequest struct {
+	Name string `json:"name"`
+	Key  string `json:"key,omitempty"` // base64, 32 octets ; vide = générer une clé aléatoire
+}
+
+type DeleteSSEKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateSSEKeyResponse ne renvoie la clé que lorsqu'elle a été générée, pour que l'utilisateur la sauvegarde
+type CreateSSEKeyResponse struct {
+	SSECKey
+	GeneratedKey string `json:"generated_key,omitempty"`
+}
+
+// errKeyringNotConfigured : sans KEYRING_KEY, aucune clé n'est stockée ni déchiffrée (pas de
+// repli sur un autre secret, qui pourrait être la valeur par défaut connue de tous)
+var errKeyringNotConfigured = errors.New("KEYRING_KEY is not configured, the SSE-C keyring is disabled")
+
+// keyringMasterKey dérive de KEYRING_KEY la clé AES-256 qui chiffre les trousseaux
+func keyringMasterKey() ([]byte, error) {
+	secret := strings.TrimSpace(os.Getenv("KEYRING_KEY"))
+	if secret == "" {
+		return nil, errKeyringNotConfigured
+	}
+	sum := sha256.Sum256([]byte("kexamanager-keyring:" + secret))
+	return sum[:], nil
+}
+
+func keyringAEAD() (cipher.AEAD, error) {
+	master, err := keyringMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSSEKey chiffre une clé SSE-C ; le projet et le nom sont liés comme données additionnelles
+// pour qu'une clé ne puisse pas être déplacée d'un projet à l'autre dans la base
+func sealSSEKey(projectID uint, name string, key []byte) (string, error) {
+	aead, err := keyringAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, key, []byte(fmt.Sprintf("%d/%s", projectID, name)))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSSEKey(projectID uint, name, encrypted string) ([]byte, error) {
+	aead, err := keyringAEAD()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("corrupted key")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, ciphertext, []byte(fmt.Sprintf("%d/%s", projectID, name)))
+	if err != nil {
+		return nil, errors.New("key cannot be decrypted (KEYRING_KEY changed?)")
+	}
+	return key, nil
+}
+
+// sseKeyFingerprint calcule l'empreinte exposée par S3 (x-amz-server-side-encryption-customer-key-MD5)
+func sseKeyFingerprint(key []byte) string {
+	sum := md5.Sum(key)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// resolveSSECKey renvoie la clé SSE-C déchiffrée d'un projet (branché sur s3.ResolveSSEKeyFunc)
+func resolveSSECKey(projectID uint, name string) ([]byte, error) {
+	var entry SSECKey
+	if err := db.Where("project_id = ? AND name = ?", projectID, name).First(&entry).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("not found in the project keyring")
+		}
+		return nil, err
+	}
+	return openSSEKey(projectID, name, entry.EncryptedKey)
+}
+
+// HandleCreateSSEKey gère POST /api/{projectId}/s3/create-sse-key
+func HandleCreateSSEKey(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateSSEKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		jsonError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := keyringMasterKey(); err != nil {
+		jsonError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	var key []byte
+	generated := req.Key == ""
+	if generated {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			jsonError(w, "Failed to generate key", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(req.Key)
+		if err != nil || len(decoded) != 32 {
+			jsonError(w, "key must be a base64-encoded 256-bit key", http.StatusBadRequest)
+			return
+		}
+		key = decoded
+	}
+
+	var count int64
+	db.Model(&SSECKey{}).Where("project_id = ? AND name = ?", config.ID, req.Name).Count(&count)
+	if count > 0 {
+		jsonError(w, "A key with this name already exists", http.StatusConflict)
+		return
+	}
+
+	encrypted, err := sealSSEKey(config.ID, req.Name, key)
+	if err != nil {
+		jsonError(w, "Failed to encrypt key", http.StatusInternalServerError)
+		return
+	}
+
+	entry := SSECKey{
+		ProjectID:    config.ID,
+		UserID:       config.UserID,
+		Name:         req.Name,
+		EncryptedKey: encrypted,
+		Fingerprint:  sseKeyFingerprint(key),
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		jsonError(w, "Failed to store key", http.StatusInternalServerError)
+		return
+	}
+
+	LogActivity(db, config.ID, config.UserID, "create_sse_key", fmt.Sprintf("Added SSE-C key %s (%s) to the keyring", entry.Name, entry.Fingerprint), "success")
+
+	resp := CreateSSEKeyResponse{SSECKey: entry}
+	if generated {
+		resp.GeneratedKey = base64.StdEncoding.EncodeToString(key)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleListSSEKeys gère POST /api/{projectId}/s3/list-sse-keys (noms et empreintes, jamais les clés)
+func HandleListSSEKeys(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var keys []SSECKey
+	if err := db.Where("project_id = ?", config.ID).Order("name").Find(&keys).Error; err != nil {
+		jsonError(w, "Failed to fetch keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+// HandleDeleteSSEKey gère POST /api/{projectId}/s3/delete-sse-key.
+// Les objets chiffrés avec cette clé deviennent illisibles sans une copie de la clé.
+func HandleDeleteSSEKey(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeleteSSEKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if config.DefaultEncryption == s3.EncryptionSSEC && config.DefaultSSEKey == req.Name {
+		jsonError(w, "This key is the project default, change the default encryption first", http.StatusConflict)
+		return
+	}
+
+	result := db.Unscoped().Where("project_id = ? AND name = ?", config.ID, req.Name).Delete(&SSECKey{})
+	if result.Error != nil {
+		jsonError(w, "Failed to delete key", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		jsonError(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	LogActivity(db, config.ID, config.UserID, "delete_sse_key", fmt.Sprintf("Removed SSE-C key %s from the keyring", req.Name), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
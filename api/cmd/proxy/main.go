@@ -34,19 +34,30 @@ func getS3Config(configID uint, userID uint) (s3.S3ConfigData, error) {
 	if err := db.Where("id = ? AND user_id = ?", configID, userID).First(&config).Error; err != nil {
 		return s3.S3ConfigData{}, err
 	}
+	return toS3ConfigData(config), nil
+}
+
+// toS3ConfigData convertit le modèle en données utilisables par le package s3
+func toS3ConfigData(config S3Config) s3.S3ConfigData {
 	return s3.S3ConfigData{
-		ID:             config.ID,
-		UserID:         config.UserID,
-		Name:           config.Name,
-		Type:           config.Type,
-		S3URL:          config.S3URL,
-		AdminURL:       config.AdminURL,
-		AdminToken:     config.AdminToken,
-		ClientID:       config.ClientID,
-		ClientSecret:   config.ClientSecret,
-		Region:         config.Region,
-		ForcePathStyle: config.ForcePathStyle,
-	}, nil
+		ID:                 config.ID,
+		UserID:             config.UserID,
+		Name:               config.Name,
+		Type:               config.Type,
+		S3URL:              config.S3URL,
+		AdminURL:           config.AdminURL,
+		AdminToken:         config.AdminToken,
+		ClientID:           config.ClientID,
+		ClientSecret:       config.ClientSecret,
+		Region:             config.Region,
+		ForcePathStyle:     config.ForcePathStyle,
+		DownloadMode:       config.DownloadMode,
+		DefaultEncryption:  config.DefaultEncryption,
+		DefaultSSEKey:      config.DefaultSSEKey,
+		NeverOverwrite:     config.NeverOverwrite,
+		TrashEnabled:       config.TrashEnabled,
+		TrashRetentionDays: config.TrashRetention,
+	}
 }
 
 // getEnv returns the first non-empty environment variable value among keys.
@@ -169,6 +180,12 @@ func handleProjectRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Les URLs de téléchargement signées remplacent le JWT (balises <img>, liens directs)
+	if endpointStart == "s3" && len(pathParts) == 3 && pathParts[2] == "download-object" && r.URL.Query().Get("signature") != "" {
+		handleSignedDownload(w, r, uint(projectID))
+		return
+	}
+
 	// Validate token and get user ID
 	userID, err := validateToken(r)
 	if err != nil {
@@ -249,6 +266,12 @@ func handleS3Request(w http.ResponseWriter, r *http.Request, config s3.S3ConfigD
 	// Trim leading slash from endpoint
 	endpoint = strings.TrimPrefix(endpoint, "/")
 
+	// Le protocole tus utilise ses propres méthodes HTTP et des URLs par upload
+	if endpoint == "tus" || strings.HasPrefix(endpoint, "tus/") {
+		HandleTus(w, r, config, strings.TrimPrefix(endpoint, "tus"))
+		return
+	}
+
 	// Map endpoints to handlers
 	switch endpoint {
 	case "list-buckets":
@@ -260,11 +283,161 @@ func handleS3Request(w http.ResponseWriter, r *http.Request, config s3.S3ConfigD
 	case "list-objects":
 		s3.HandleListObjectsWithConfig(config).ServeHTTP(w, r)
 	case "get-object":
-		s3.HandleGetObjectWithConfig(config).ServeHTTP(w, r)
+		HandleGetObject(w, r, config)
+	case "download-object":
+		s3.HandleDownloadObjectWithConfig(config).ServeHTTP(w, r)
 	case "put-object":
 		s3.HandlePutObjectWithConfig(config).ServeHTTP(w, r)
 	case "delete-object":
 		s3.HandleDeleteObjectWithConfig(config).ServeHTTP(w, r)
+	case "stat-object":
+		s3.HandleStatObjectWithConfig(config).ServeHTTP(w, r)
+	case "update-object-metadata":
+		s3.HandleUpdateObjectMetadataWithConfig(config).ServeHTTP(w, r)
+	case "get-object-tags":
+		s3.HandleGetObjectTagsWithConfig(config).ServeHTTP(w, r)
+	case "set-object-tags":
+		s3.HandleSetObjectTagsWithConfig(config).ServeHTTP(w, r)
+	case "delete-object-tags":
+		s3.HandleDeleteObjectTagsWithConfig(config).ServeHTTP(w, r)
+	case "get-bucket-tags":
+		s3.HandleGetBucketTagsWithConfig(config).ServeHTTP(w, r)
+	case "set-bucket-tags":
+		s3.HandleSetBucketTagsWithConfig(config).ServeHTTP(w, r)
+	case "delete-bucket-tags":
+		s3.HandleDeleteBucketTagsWithConfig(config).ServeHTTP(w, r)
+	case "get-bucket-versioning":
+		s3.HandleGetBucketVersioningWithConfig(config).ServeHTTP(w, r)
+	case "set-bucket-versioning":
+		s3.HandleSetBucketVersioningWithConfig(config).ServeHTTP(w, r)
+	case "list-object-versions":
+		s3.HandleListObjectVersionsWithConfig(config).ServeHTTP(w, r)
+	case "restore-object-version":
+		s3.HandleRestoreObjectVersionWithConfig(config).ServeHTTP(w, r)
+	case "delete-object-version":
+		s3.HandleDeleteObjectVersionWithConfig(config).ServeHTTP(w, r)
+	case "lifecycle-schema":
+		s3.HandleLifecycleSchema().ServeHTTP(w, r)
+	case "get-bucket-lifecycle":
+		s3.HandleGetBucketLifecycleWithConfig(config).ServeHTTP(w, r)
+	case "put-bucket-lifecycle":
+		s3.HandlePutBucketLifecycleWithConfig(config).ServeHTTP(w, r)
+	case "validate-bucket-lifecycle":
+		s3.HandleValidateBucketLifecycleWithConfig(config).ServeHTTP(w, r)
+	case "preview-bucket-lifecycle":
+		s3.HandlePreviewBucketLifecycleWithConfig(config).ServeHTTP(w, r)
+	case "get-bucket-policy":
+		s3.HandleGetBucketPolicyWithConfig(config).ServeHTTP(w, r)
+	case "set-bucket-policy":
+		s3.HandleSetBucketPolicyWithConfig(config).ServeHTTP(w, r)
+	case "delete-bucket-policy":
+		s3.HandleDeleteBucketPolicyWithConfig(config).ServeHTTP(w, r)
+	case "validate-bucket-policy":
+		s3.HandleValidateBucketPolicyWithConfig(config).ServeHTTP(w, r)
+	case "bucket-policy-template":
+		s3.HandleBucketPolicyTemplate().ServeHTTP(w, r)
+	case "simulate-bucket-policy":
+		s3.HandleSimulateBucketPolicyWithConfig(config).ServeHTTP(w, r)
+	case "get-bucket-cors":
+		s3.HandleGetBucketCORSWithConfig(config).ServeHTTP(w, r)
+	case "put-bucket-cors":
+		s3.HandlePutBucketCORSWithConfig(config).ServeHTTP(w, r)
+	case "delete-bucket-cors":
+		s3.HandleDeleteBucketCORSWithConfig(config).ServeHTTP(w, r)
+	case "allow-cors-origin":
+		s3.HandleAllowCORSOriginWithConfig(config).ServeHTTP(w, r)
+	case "diagnose-cors":
+		s3.HandleDiagnoseCORSWithConfig(config).ServeHTTP(w, r)
+	case "get-bucket-object-lock":
+		s3.HandleGetBucketObjectLockWithConfig(config).ServeHTTP(w, r)
+	case "set-bucket-object-lock":
+		s3.HandleSetBucketObjectLockWithConfig(config).ServeHTTP(w, r)
+	case "get-object-retention":
+		s3.HandleGetObjectRetentionWithConfig(config).ServeHTTP(w, r)
+	case "set-object-retention":
+		s3.HandleSetObjectRetentionWithConfig(config).ServeHTTP(w, r)
+	case "get-object-legal-hold":
+		s3.HandleGetObjectLegalHoldWithConfig(config).ServeHTTP(w, r)
+	case "set-object-legal-hold":
+		s3.HandleSetObjectLegalHoldWithConfig(config).ServeHTTP(w, r)
+	case "create-sse-key":
+		HandleCreateSSEKey(w, r, config)
+	case "list-sse-keys":
+		HandleListSSEKeys(w, r, config)
+	case "delete-sse-key":
+		HandleDeleteSSEKey(w, r, config)
+	case "archive-prefix":
+		s3.HandleArchivePrefixWithConfig(config).ServeHTTP(w, r)
+	case "extract-archive":
+		s3.HandleExtractArchiveWithConfig(config).ServeHTTP(w, r)
+	case "search-objects":
+		s3.HandleSearchObjectsWithConfig(config).ServeHTTP(w, r)
+	case "enable-object-index":
+		HandleEnableObjectIndex(w, r, config)
+	case "disable-object-index":
+		HandleDisableObjectIndex(w, r, config)
+	case "list-object-indexes":
+		HandleListObjectIndexes(w, r, config)
+	case "reindex-bucket":
+		HandleReindexBucket(w, r, config)
+	case "search-object-index":
+		HandleSearchObjectIndex(w, r, config)
+	case "thumbnail":
+		s3.HandleThumbnailWithConfig(config).ServeHTTP(w, r)
+	case "get-text-object":
+		s3.HandleGetTextObjectWithConfig(config).ServeHTTP(w, r)
+	case "put-text-object":
+		s3.HandlePutTextObjectWithConfig(config).ServeHTTP(w, r)
+	case "verify-object":
+		s3.HandleVerifyObjectWithConfig(config).ServeHTTP(w, r)
+	case "list-trash":
+		HandleListTrash(w, r, config)
+	case "restore-trash":
+		HandleRestoreTrash(w, r, config)
+	case "empty-trash":
+		HandleEmptyTrash(w, r, config)
+	case "set-bucket-protection":
+		HandleSetBucketProtection(w, r, config)
+	case "list-protected-buckets":
+		HandleListProtectedBuckets(w, r, config)
+	case "list-bucket-deletion-jobs":
+		HandleListBucketDeletionJobs(w, r, config)
+	case "list-incomplete-uploads":
+		s3.HandleListIncompleteUploadsWithConfig(config).ServeHTTP(w, r)
+	case "abort-incomplete-uploads":
+		s3.HandleAbortIncompleteUploadsWithConfig(config).ServeHTTP(w, r)
+	case "copy-bucket":
+		HandleStartBucketCopy(w, r, config)
+	case "list-bucket-copy-jobs":
+		HandleListBucketCopyJobs(w, r, config)
+	case "cancel-bucket-copy":
+		HandleCancelBucketCopy(w, r, config)
+	case "resume-bucket-copy":
+		HandleResumeBucketCopy(w, r, config)
+	case "presign-put":
+		s3.HandlePresignPutWithConfig(config).ServeHTTP(w, r)
+	case "presign-post":
+		s3.HandlePresignPostPolicyWithConfig(config).ServeHTTP(w, r)
+	case "confirm-upload":
+		s3.HandleConfirmUploadWithConfig(config).ServeHTTP(w, r)
+	case "create-share-link":
+		HandleCreateShareLink(w, r, config)
+	case "list-share-links":
+		HandleListShareLinks(w, r, config)
+	case "revoke-share-link":
+		HandleRevokeShareLink(w, r, config)
+	case "initiate-multipart-upload":
+		HandleInitiateMultipartUpload(w, r, config)
+	case "upload-part":
+		HandleUploadPart(w, r, config)
+	case "list-parts":
+		HandleListParts(w, r, config)
+	case "complete-multipart-upload":
+		HandleCompleteMultipartUpload(w, r, config)
+	case "abort-multipart-upload":
+		HandleAbortMultipartUpload(w, r, config)
+	case "list-multipart-sessions":
+		HandleListMultipartSessions(w, r, config)
 	default:
 		http.NotFound(w, r)
 	}
@@ -360,6 +533,23 @@ func main() {
 	s3.InitHandlers(validateToken, getS3Config, func(projectID, userID uint, action, details, status string) error {
 		return LogActivity(db, projectID, userID, action, details, status)
 	})
+	s3.ResolveSSEKeyFunc = resolveSSECKey
+	s3.ObjectChangedFunc = indexObjectChange
+	s3.ObjectTrashedFunc = recordTrashedObject
+	s3.BucketProtectedFunc = isBucketProtected
+	s3.ForceDeleteBucketFunc = startBucketDeletionJob
+	s3.UploadAbortedFunc = markUploadAborted
+
+	// Taille maximale du cache disque des miniatures (octets)
+	if size, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("THUMBNAIL_CACHE_SIZE")), 10, 64); err == nil && size > 0 {
+		s3.ThumbnailCacheMaxSize = size
+	}
+
+	// Re-crawls planifiés des index de clés
+	go runObjectIndexScheduler()
+	go runTrashPurgeScheduler()
+	resumeBucketDeletionJobs()
+	resumeBucketCopyJobs()
 
 	// Utiliser les valeurs des flags (qui incluent maintenant les variables d'environnement)
 	listenPort := strings.TrimSpace(*portFlag)
@@ -398,6 +588,9 @@ func main() {
 	mux.HandleFunc("/api/s3-configs/update", HandleUpdateS3Config)
 	mux.HandleFunc("/api/s3-configs/delete", HandleDeleteS3Config)
 
+	// Liens de partage publics (sans authentification)
+	mux.HandleFunc("/s/", HandleShareLinkDownload)
+
 	// Dynamic admin proxy based on project ID - registered last as catch-all
 	mux.HandleFunc("/api/", handleProjectRoutes)
 
@@ -23,7 +23,7 @@ func RunMigrations(db *gorm.DB) error {
 	}
 
 	// AutoMigrate des modèles principaux (ajoute nouvelles colonnes/tables)
-	if err := db.AutoMigrate(&User{}, &S3Config{}, &ProjectLog{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &S3Config{}, &ProjectLog{}, &MultipartUpload{}, &ShareLink{}, &SSECKey{}, &ObjectIndex{}, &ObjectIndexEntry{}, &TrashEntry{}, &ProtectedBucket{}, &BucketDeletionJob{}, &BucketCopyJob{}); err != nil {
 		return fmt.Errorf("failed to auto-migrate models: %w", err)
 	}
 
@@ -74,6 +74,9 @@ func RunMigrations(db *gorm.DB) error {
 		log.Printf("Migration %d applied successfully", migration.Version)
 	}
 
+	// La table FTS5 n'est pas gérée par AutoMigrate (table virtuelle, dépend des tags de build)
+	setupObjectIndexFTS(db)
+
 	return nil
 }
 
@@ -16,20 +16,26 @@ type User struct {
 
 // S3Config représente une configuration S3 pour un utilisateur
 type S3Config struct {
-	ID             uint `gorm:"primaryKey" json:"id"`
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	DeletedAt      gorm.DeletedAt `gorm:"index"`
-	UserID         uint           `gorm:"not null" json:"user_id"`
-	Name           string         `gorm:"not null" json:"name"` // Nom de la config (ex: "Mon Garage", "AWS S3")
-	Type           string         `gorm:"not null" json:"type"` // "garage" ou "s3"
-	S3URL          string         `json:"s3_url,omitempty"`     // URL S3 (pour les deux types)
-	AdminURL       string         `json:"admin_url,omitempty"`  // URL Admin (seulement pour Garage)
-	AdminToken     string         `gorm:"not null" json:"-"`    // Token API admin (seulement pour Garage) - Ne pas exposer en JSON
-	ClientID       string         `gorm:"not null" json:"client_id"`
-	ClientSecret   string         `gorm:"not null" json:"-"` // Ne pas exposer en JSON
-	Region         string         `gorm:"default:'us-east-1'" json:"region"`
-	ForcePathStyle bool           `gorm:"default:true" json:"force_path_style"`
+	ID                uint `gorm:"primaryKey" json:"id"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+	UserID            uint           `gorm:"not null" json:"user_id"`
+	Name              string         `gorm:"not null" json:"name"` // Nom de la config (ex: "Mon Garage", "AWS S3")
+	Type              string         `gorm:"not null" json:"type"` // "garage" ou "s3"
+	S3URL             string         `json:"s3_url,omitempty"`     // URL S3 (pour les deux types)
+	AdminURL          string         `json:"admin_url,omitempty"`  // URL Admin (seulement pour Garage)
+	AdminToken        string         `gorm:"not null" json:"-"`    // Token API admin (seulement pour Garage) - Ne pas exposer en JSON
+	ClientID          string         `gorm:"not null" json:"client_id"`
+	ClientSecret      string         `gorm:"not null" json:"-"` // Ne pas exposer en JSON
+	Region            string         `gorm:"default:'us-east-1'" json:"region"`
+	ForcePathStyle    bool           `gorm:"default:true" json:"force_path_style"`
+	DownloadMode      string         `gorm:"default:'presign'" json:"download_mode"` // "presign" (URL présignée) ou "proxy" (flux via kexamanager)
+	DefaultEncryption string         `json:"default_encryption"`                     // "", "sse-s3" ou "sse-c" : chiffrement appliqué par défaut aux uploads
+	DefaultSSEKey     string         `json:"default_sse_key"`                        // Nom de la clé du trousseau utilisée pour "sse-c"
+	NeverOverwrite    bool           `gorm:"default:false" json:"never_overwrite"`   // Refuser toute écriture sur une clé existante
+	TrashEnabled      bool           `gorm:"default:false" json:"trash_enabled"`     // Les suppressions passent par la corbeille
+	TrashRetention    int            `gorm:"default:30" json:"trash_retention_days"` // Jours avant la purge automatique de la corbeille
 }
 
 // S3Credentials représente les credentials S3 (pour compatibilité)
@@ -55,3 +61,138 @@ type ProjectLog struct {
 	Details   string `json:"details"`
 	Status    string `json:"status"` // "success", "error"
 }
+
+// MultipartUpload représente un upload multipart S3 suivi par kexamanager.
+// Il est persisté pour qu'un navigateur puisse reprendre l'upload après un rechargement.
+type MultipartUpload struct {
+	gorm.Model
+	ProjectID   uint   `gorm:"index;not null" json:"project_id"`
+	UserID      uint   `gorm:"index" json:"user_id"`
+	Bucket      string `gorm:"not null" json:"bucket"`
+	Key         string `gorm:"not null" json:"key"`
+	UploadID    string `gorm:"uniqueIndex;not null" json:"upload_id"`
+	ContentType string `json:"content_type"`
+	FileSize    int64  `json:"file_size"` // -1 si inconnue
+	PartSize    int64  `gorm:"not null" json:"part_size"`
+	Status      string `gorm:"index;not null" json:"status"`               // "in_progress", "completed", "aborted"
+	Protocol    string `gorm:"default:'chunked';not null" json:"protocol"` // "chunked" ou "tus"
+	IfNoneMatch string `json:"if_none_match,omitempty"`                    // "*" : création seule, vérifié à la finalisation
+	Encryption  string `gorm:"default:'none';not null" json:"encryption"`  // Chiffrement fixé au démarrage : "none", "sse-s3" ou "sse-c"
+	SSEKeyName  string `json:"sse_key_name,omitempty"`                     // Clé du trousseau pour "sse-c", renvoyée à chaque part
+	// Champs utilisés uniquement par le protocole tus
+	Offset    int64  `json:"offset"`     // Octets reçus (parts envoyées + tampon local)
+	PartCount int    `json:"part_count"` // Parts déjà envoyées à S3
+	Metadata  string `json:"metadata,omitempty"`
+}
+
+// ShareLink représente un lien de partage public vers un objet S3 (servi sur /s/{token})
+type ShareLink struct {
+	gorm.Model
+	Token         string     `gorm:"uniqueIndex;not null" json:"token"`
+	ProjectID     uint       `gorm:"index;not null" json:"project_id"`
+	UserID        uint       `gorm:"index;not null" json:"user_id"` // Créateur du lien, propriétaire du projet
+	Bucket        string     `gorm:"not null" json:"bucket"`
+	Key           string     `gorm:"not null" json:"key"`
+	PasswordHash  string     `json:"-"`                                       // Hash bcrypt, vide si pas de mot de passe
+	Mode          string     `gorm:"default:'redirect';not null" json:"mode"` // "redirect" ou "stream"
+	ExpiresAt     *time.Time `json:"expires_at"`                              // nil = pas d'expiration
+	MaxDownloads  int        `json:"max_downloads"`                           // 0 = illimité
+	DownloadCount int        `json:"download_count"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+// SSECKey est une clé SSE-C du trousseau d'un projet, chiffrée avec la clé maître du serveur
+type SSECKey struct {
+	gorm.Model
+	ProjectID    uint   `gorm:"uniqueIndex:idx_sse_key_project_name;not null" json:"project_id"`
+	UserID       uint   `gorm:"not null" json:"user_id"`
+	Name         string `gorm:"uniqueIndex:idx_sse_key_project_name;not null" json:"name"`
+	EncryptedKey string `gorm:"not null" json:"-"`           // base64(nonce || AES-GCM(clé))
+	Fingerprint  string `gorm:"not null" json:"fingerprint"` // MD5 base64 de la clé, tel que renvoyé par S3
+}
+
+// ObjectIndex active l'index persistant des clés d'un bucket (recherche sans lister S3)
+type ObjectIndex struct {
+	gorm.Model
+	ProjectID     uint       `gorm:"uniqueIndex:idx_object_index_project_bucket;not null" json:"project_id"`
+	UserID        uint       `gorm:"not null" json:"user_id"`
+	Bucket        string     `gorm:"uniqueIndex:idx_object_index_project_bucket;not null" json:"bucket"`
+	CrawlInterval int        `gorm:"not null" json:"crawl_interval"` // Minutes entre deux re-crawls
+	Status        string     `gorm:"not null" json:"status"`         // "pending", "crawling", "ready", "error"
+	LastCrawlAt   *time.Time `json:"last_crawl_at"`                  // Fin du dernier crawl réussi
+	LastError     string     `json:"last_error,omitempty"`
+	ObjectCount   int64      `json:"object_count"`
+	CrawlSeq      int64      `gorm:"not null;default:0" json:"-"` // Numéro du crawl en cours ou du dernier crawl
+}
+
+// ObjectIndexEntry est une clé indexée ; la table FTS5 object_index_fts en est le miroir
+type ObjectIndexEntry struct {
+	ID           uint      `gorm:"primaryKey" json:"-"`
+	IndexID      uint      `gorm:"uniqueIndex:idx_object_index_entry_key;not null" json:"-"`
+	Key          string    `gorm:"uniqueIndex:idx_object_index_entry_key;not null" json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	CrawlSeq     int64     `gorm:"index;not null" json:"-"` // Crawl qui a vu la clé en dernier
+}
+
+// TrashEntry est un objet supprimé conservé dans la corbeille du projet jusqu'à sa purge
+type TrashEntry struct {
+	gorm.Model
+	ProjectID uint   `gorm:"index;not null" json:"project_id"`
+	UserID    uint   `gorm:"not null" json:"user_id"`
+	Bucket    string `gorm:"index;not null" json:"bucket"`
+	Key       string `gorm:"not null" json:"key"`  // Clé d'origine, restaurée à l'identique
+	TrashKey  string `json:"trash_key,omitempty"`  // Copie sous .kexa-trash/ (bucket non versionné)
+	VersionID string `json:"version_id,omitempty"` // Version conservée (bucket versionné)
+	Size      int64  `json:"size"`
+	ETag      string `json:"etag"`
+}
+
+// ProtectedBucket marque un bucket dont la suppression est refusée par kexamanager
+type ProtectedBucket struct {
+	gorm.Model
+	ProjectID uint   `gorm:"uniqueIndex:idx_protected_bucket_project_bucket;not null" json:"project_id"`
+	Bucket    string `gorm:"uniqueIndex:idx_protected_bucket_project_bucket;not null" json:"bucket"`
+	UserID    uint   `gorm:"not null" json:"user_id"` // Utilisateur qui a posé la protection
+}
+
+// BucketDeletionJob suit la suppression forcée d'un bucket : vidage (versions et uploads
+// incomplets compris) puis RemoveBucket
+type BucketDeletionJob struct {
+	gorm.Model
+	ProjectID        uint       `gorm:"index;not null" json:"project_id"`
+	UserID           uint       `gorm:"not null" json:"user_id"`
+	Bucket           string     `gorm:"not null" json:"bucket"`
+	Status           string     `gorm:"index;not null" json:"status"` // "pending", "running", "completed", "failed"
+	ObjectsDeleted   int64      `json:"objects_deleted"`              // Objets, versions et marqueurs de suppression
+	UploadsAborted   int64      `json:"uploads_aborted"`
+	Failed           int64      `json:"failed"`
+	LastError        string     `json:"last_error,omitempty"`
+	FinishedAt       *time.Time `json:"finished_at"`
+	BypassGovernance bool       `json:"bypass_governance"` // Supprimer aussi les objets sous rétention GOVERNANCE
+}
+
+// BucketCopyJob suit la copie d'un bucket (ou d'un préfixe) vers un autre projet. Checkpoint est
+// la dernière clé au-delà de laquelle reprendre après un redémarrage.
+type BucketCopyJob struct {
+	gorm.Model
+	ProjectID      uint       `gorm:"index;not null" json:"project_id"` // Projet source
+	UserID         uint       `gorm:"not null" json:"user_id"`
+	DestProjectID  uint       `gorm:"index;not null" json:"dest_project_id"`
+	SourceBucket   string     `gorm:"not null" json:"source_bucket"`
+	SourcePrefix   string     `json:"source_prefix"`
+	DestBucket     string     `gorm:"not null" json:"dest_bucket"`
+	DestPrefix     string     `json:"dest_prefix"`
+	Concurrency    int        `json:"concurrency"`
+	Overwrite      bool       `json:"overwrite"`
+	Status         string     `gorm:"index;not null" json:"status"` // "pending", "running", "completed", "failed", "canceled"
+	Checkpoint     string     `json:"checkpoint,omitempty"`
+	ObjectsCopied  int64      `json:"objects_copied"`
+	ObjectsSkipped int64      `json:"objects_skipped"` // Déjà présents avec la même taille et le même ETag
+	BytesCopied    int64      `json:"bytes_copied"`
+	Conflicts      int64      `json:"conflicts"` // Objets différents déjà présents, non remplacés
+	Failed         int64      `json:"failed"`
+	LastError      string     `json:"last_error,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
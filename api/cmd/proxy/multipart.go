@@ -0,0 +1,588 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// Taille de part par défaut et limites imposées par l'API multipart S3
+	defaultPartSize = 16 << 20
+	minPartSize     = 5 << 20
+	maxPartSize     = 5 << 30
+	maxPartCount    = 10000
+
+	multipartStatusInProgress = "in_progress"
+	multipartStatusCompleted  = "completed"
+	multipartStatusAborted    = "aborted"
+
+	multipartProtocolChunked = "chunked"
+	multipartProtocolTus     = "tus"
+)
+
+// InitiateMultipartUploadRequest démarre (ou reprend) un upload multipart
+type InitiateMultipartUploadRequest struct {
+	KeyId       string `json:"keyId"`
+	Token       string `json:"token"`
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	ContentType string `json:"contentType,omitempty"`
+	FileSize    int64  `json:"fileSize"`
+	PartSize    int64  `json:"partSize,omitempty"`
+	Overwrite   *bool  `json:"overwrite,omitempty"` // false : refuser si la clé existe
+	IfNoneMatch string `json:"ifNoneMatch,omitempty"`
+}
+
+// MultipartUploadRequest identifie un upload multipart existant
+type MultipartUploadRequest struct {
+	KeyId    string `json:"keyId"`
+	Token    string `json:"token"`
+	UploadID string `json:"uploadId"`
+}
+
+type ListMultipartSessionsRequest struct {
+	Bucket string `json:"bucket,omitempty"`
+}
+
+// UploadedPart décrit une part déjà reçue par le backend S3
+type UploadedPart struct {
+	PartNumber   int    `json:"partNumber"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified"`
+}
+
+type MultipartUploadResponse struct {
+	Upload     MultipartUpload `json:"upload"`
+	TotalParts int             `json:"totalParts"`
+	Parts      []UploadedPart  `json:"parts"`
+	Resumed    bool            `json:"resumed"`
+}
+
+// s3ClientForRequest construit un client S3 à partir de la config du projet, en écrivant l'erreur si besoin
+func s3ClientForRequest(w http.ResponseWriter, config s3.S3ConfigData, keyId, token string) (*minio.Client, bool) {
+	creds, err := s3.GetS3Credentials(config, keyId, token)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	client, err := s3.CreateS3Client(creds)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return client, true
+}
+
+// choosePartSize retourne une taille de part valide pour S3 (5 Mo minimum, 10000 parts maximum)
+func choosePartSize(fileSize, requested int64) int64 {
+	partSize := requested
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if fileSize > 0 {
+		for (fileSize+partSize-1)/partSize > maxPartCount {
+			partSize *= 2
+		}
+	}
+	if partSize > maxPartSize {
+		partSize = maxPartSize
+	}
+	return partSize
+}
+
+// uploadEncryption rejoue le chiffrement fixé au démarrage de l'upload : SSE-C exige la clé à chaque part
+func uploadEncryption(config s3.S3ConfigData, upload MultipartUpload) (encrypt.ServerSide, error) {
+	return s3.WriteEncryption(config, s3.SSEOptions{SSE: upload.Encryption, SSEKeyName: upload.SSEKeyName})
+}
+
+func totalParts(upload MultipartUpload) int {
+	if upload.FileSize <= 0 || upload.PartSize <= 0 {
+		return 0
+	}
+	return int((upload.FileSize + upload.PartSize - 1) / upload.PartSize)
+}
+
+// findMultipartUpload récupère une session en cours appartenant au projet
+func findMultipartUpload(w http.ResponseWriter, config s3.S3ConfigData, uploadID string) (MultipartUpload, bool) {
+	var upload MultipartUpload
+	if uploadID == "" {
+		jsonError(w, "uploadId is required", http.StatusBadRequest)
+		return upload, false
+	}
+
+	if err := db.Where("project_id = ? AND upload_id = ? AND protocol = ?", config.ID, uploadID, multipartProtocolChunked).First(&upload).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			jsonError(w, "Upload not found", http.StatusNotFound)
+		} else {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+		}
+		return upload, false
+	}
+
+	if upload.Status != multipartStatusInProgress {
+		jsonError(w, fmt.Sprintf("Upload is %s", upload.Status), http.StatusConflict)
+		return upload, false
+	}
+
+	return upload, true
+}
+
+// listUploadedParts lit toutes les parts déjà envoyées pour un upload
+func listUploadedParts(r *http.Request, client *minio.Client, upload MultipartUpload) ([]UploadedPart, error) {
+	core := minio.Core{Client: client}
+	parts := []UploadedPart{}
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(r.Context(), upload.Bucket, upload.Key, upload.UploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range result.ObjectParts {
+			parts = append(parts, UploadedPart{
+				PartNumber:   p.PartNumber,
+				Size:         p.Size,
+				ETag:         p.ETag,
+				LastModified: p.LastModified.Format(time.RFC3339),
+			})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	return parts, nil
+}
+
+// checkUploadPrecondition vérifie une condition d'écriture avant de démarrer un upload
+func checkUploadPrecondition(ctx context.Context, client *minio.Client, config s3.S3ConfigData, bucket, key string, precondition s3.WritePrecondition) error {
+	if precondition.IsZero() {
+		return nil
+	}
+	readSSE, err := s3.ResolveReadEncryption(config, s3.SSEOptions{})
+	if err != nil {
+		return err
+	}
+	return precondition.Check(ctx, client, bucket, key, readSSE)
+}
+
+// writeUploadPreconditionError répond 409 (structuré) pour un conflit, 502 sinon
+func writeUploadPreconditionError(w http.ResponseWriter, err error) {
+	if conflict, ok := err.(*s3.WriteConflictError); ok {
+		s3.WriteConflict(w, conflict)
+		return
+	}
+	jsonError(w, fmt.Sprintf("Failed to check existing object: %v", err), http.StatusBadGateway)
+}
+
+func writeMultipartResponse(w http.ResponseWriter, upload MultipartUpload, parts []UploadedPart, resumed bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MultipartUploadResponse{
+		Upload:     upload,
+		TotalParts: totalParts(upload),
+		Parts:      parts,
+		Resumed:    resumed,
+	})
+}
+
+// HandleInitiateMultipartUpload gère POST /api/{projectId}/s3/initiate-multipart-upload.
+// Si un upload en cours existe déjà pour la même clé et la même taille, il est repris.
+func HandleInitiateMultipartUpload(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req InitiateMultipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Bucket == "" || req.Key == "" {
+		jsonError(w, "bucket and key are required", http.StatusBadRequest)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, req.KeyId, req.Token)
+	if !ok {
+		return
+	}
+
+	// Vérifié dès maintenant pour ne pas envoyer tout le fichier avant un refus, puis à nouveau
+	// à la finalisation
+	precondition := s3.ResolveWritePrecondition(config, s3.WritePrecondition{IfNoneMatch: req.IfNoneMatch}, req.Overwrite)
+	if err := checkUploadPrecondition(r.Context(), client, config, req.Bucket, req.Key, precondition); err != nil {
+		writeUploadPreconditionError(w, err)
+		return
+	}
+
+	fileSize := req.FileSize
+	if fileSize <= 0 {
+		fileSize = -1
+	}
+
+	var existing MultipartUpload
+	err := db.Where("project_id = ? AND bucket = ? AND `key` = ? AND file_size = ? AND status = ? AND protocol = ?",
+		config.ID, req.Bucket, req.Key, fileSize, multipartStatusInProgress, multipartProtocolChunked).
+		Order("created_at desc").First(&existing).Error
+	if err == nil {
+		parts, err := listUploadedParts(r, client, existing)
+		if err == nil {
+			if existing.IfNoneMatch != precondition.IfNoneMatch {
+				existing.IfNoneMatch = precondition.IfNoneMatch
+				db.Model(&existing).Update("if_none_match", existing.IfNoneMatch)
+			}
+			writeMultipartResponse(w, existing, parts, true)
+			return
+		}
+		// L'upload n'existe plus côté S3 (expiré ou nettoyé) : on en démarre un nouveau
+		db.Model(&existing).Update("status", multipartStatusAborted)
+	} else if err != gorm.ErrRecordNotFound {
+		jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	encryption, sse, err := s3.ResolveUploadEncryption(config)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	core := minio.Core{Client: client}
+	uploadID, err := core.NewMultipartUpload(r.Context(), req.Bucket, req.Key, minio.PutObjectOptions{
+		ContentType:          contentType,
+		ServerSideEncryption: sse,
+	})
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to initiate multipart upload: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	upload := MultipartUpload{
+		ProjectID:   config.ID,
+		UserID:      config.UserID,
+		Bucket:      req.Bucket,
+		Key:         req.Key,
+		UploadID:    uploadID,
+		ContentType: contentType,
+		FileSize:    fileSize,
+		PartSize:    choosePartSize(fileSize, req.PartSize),
+		Status:      multipartStatusInProgress,
+		Protocol:    multipartProtocolChunked,
+		IfNoneMatch: precondition.IfNoneMatch,
+		Encryption:  encryption.SSE,
+		SSEKeyName:  encryption.SSEKeyName,
+	}
+	if err := db.Create(&upload).Error; err != nil {
+		core.AbortMultipartUpload(r.Context(), req.Bucket, req.Key, uploadID)
+		jsonError(w, "Failed to save upload", http.StatusInternalServerError)
+		return
+	}
+
+	writeMultipartResponse(w, upload, []UploadedPart{}, false)
+}
+
+// HandleUploadPart gère POST /api/{projectId}/s3/upload-part.
+// Le corps est un formulaire multipart avec les champs uploadId, partNumber et file.
+func HandleUploadPart(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		jsonError(w, fmt.Sprintf("Invalid multipart form: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	upload, ok := findMultipartUpload(w, config, r.FormValue("uploadId"))
+	if !ok {
+		return
+	}
+
+	partNumber, err := strconv.Atoi(r.FormValue("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartCount {
+		jsonError(w, "partNumber must be between 1 and 10000", http.StatusBadRequest)
+		return
+	}
+	if expected := totalParts(upload); expected > 0 && partNumber > expected {
+		jsonError(w, fmt.Sprintf("partNumber must be between 1 and %d for this upload", expected), http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to get file from form: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > upload.PartSize {
+		jsonError(w, fmt.Sprintf("Part exceeds the negotiated part size of %d bytes", upload.PartSize), http.StatusBadRequest)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, r.FormValue("keyId"), r.FormValue("token"))
+	if !ok {
+		return
+	}
+
+	sse, err := uploadEncryption(config, upload)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	core := minio.Core{Client: client}
+	part, err := core.PutObjectPart(r.Context(), upload.Bucket, upload.Key, upload.UploadID, partNumber, file, header.Size, minio.PutObjectPartOptions{SSE: sse})
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to upload part: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Touche la session pour que UpdatedAt reflète la dernière activité
+	db.Model(&upload).Update("updated_at", time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UploadedPart{
+		PartNumber:   part.PartNumber,
+		Size:         part.Size,
+		ETag:         part.ETag,
+		LastModified: part.LastModified.Format(time.RFC3339),
+	})
+}
+
+// HandleListParts gère POST /api/{projectId}/s3/list-parts
+func HandleListParts(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MultipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	upload, ok := findMultipartUpload(w, config, req.UploadID)
+	if !ok {
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, req.KeyId, req.Token)
+	if !ok {
+		return
+	}
+
+	parts, err := listUploadedParts(r, client, upload)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to list parts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeMultipartResponse(w, upload, parts, false)
+}
+
+// HandleCompleteMultipartUpload gère POST /api/{projectId}/s3/complete-multipart-upload.
+// Les parts sont relues depuis S3, le client n'a donc pas besoin de conserver les ETags.
+func HandleCompleteMultipartUpload(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MultipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	upload, ok := findMultipartUpload(w, config, req.UploadID)
+	if !ok {
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, req.KeyId, req.Token)
+	if !ok {
+		return
+	}
+
+	parts, err := listUploadedParts(r, client, upload)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to list parts: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(parts) == 0 {
+		jsonError(w, "No parts uploaded", http.StatusBadRequest)
+		return
+	}
+	if expected := totalParts(upload); expected > 0 && len(parts) != expected {
+		jsonError(w, fmt.Sprintf("Upload incomplete: %d of %d parts received", len(parts), expected), http.StatusConflict)
+		return
+	}
+
+	// Le nombre seul ne suffit pas : 1, 2 et 4 sur 3 parts compléteraient un objet sans la part 3
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	for i, p := range parts {
+		if p.PartNumber != i+1 {
+			jsonError(w, fmt.Sprintf("Upload incomplete: part %d is missing", i+1), http.StatusConflict)
+			return
+		}
+	}
+	completeParts := make([]minio.CompletePart, len(parts))
+	var size int64
+	for i, p := range parts {
+		completeParts[i] = minio.CompletePart{PartNumber: p.PartNumber, ETag: p.ETag}
+		size += p.Size
+	}
+
+	readSSE, err := s3.ResolveReadEncryption(config, s3.SSEOptions{})
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	core := minio.Core{Client: client}
+	precondition := s3.ResolveWritePrecondition(config, s3.WritePrecondition{IfNoneMatch: upload.IfNoneMatch}, nil)
+	info, err := precondition.CompleteMultipart(r.Context(), core, upload.Bucket, upload.Key, upload.UploadID, completeParts, minio.PutObjectOptions{}, readSSE)
+	if conflict, ok := err.(*s3.WriteConflictError); ok {
+		// La clé a été créée pendant l'envoi : les parts ne serviront plus
+		core.AbortMultipartUpload(r.Context(), upload.Bucket, upload.Key, upload.UploadID)
+		db.Model(&upload).Update("status", multipartStatusAborted)
+		LogActivity(db, config.ID, config.UserID, "upload_file", fmt.Sprintf("Refused multipart upload to %s/%s: %s", upload.Bucket, upload.Key, conflict.Reason), "error")
+		s3.WriteConflict(w, conflict)
+		return
+	}
+	if err != nil {
+		LogActivity(db, config.ID, config.UserID, "upload_file", fmt.Sprintf("Failed to complete multipart upload %s/%s: %v", upload.Bucket, upload.Key, err), "error")
+		jsonError(w, fmt.Sprintf("Failed to complete multipart upload: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.Model(&upload).Update("status", multipartStatusCompleted).Error; err != nil {
+		jsonError(w, "Failed to update upload", http.StatusInternalServerError)
+		return
+	}
+
+	LogActivity(db, config.ID, config.UserID, "upload_file", fmt.Sprintf("Uploaded file %s/%s (%d bytes, %d parts)", upload.Bucket, upload.Key, size, len(parts)), "success")
+	indexObjectChange(config.ID, s3.ObjectChange{Bucket: upload.Bucket, Key: upload.Key, Size: size, ETag: info.ETag, LastModified: time.Now()})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"bucket":  upload.Bucket,
+		"key":     upload.Key,
+		"size":    size,
+		"etag":    info.ETag,
+	})
+}
+
+// HandleAbortMultipartUpload gère POST /api/{projectId}/s3/abort-multipart-upload
+func HandleAbortMultipartUpload(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MultipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	upload, ok := findMultipartUpload(w, config, req.UploadID)
+	if !ok {
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, req.KeyId, req.Token)
+	if !ok {
+		return
+	}
+
+	core := minio.Core{Client: client}
+	if err := core.AbortMultipartUpload(r.Context(), upload.Bucket, upload.Key, upload.UploadID); err != nil {
+		jsonError(w, fmt.Sprintf("Failed to abort multipart upload: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.Model(&upload).Update("status", multipartStatusAborted).Error; err != nil {
+		jsonError(w, "Failed to update upload", http.StatusInternalServerError)
+		return
+	}
+
+	LogActivity(db, config.ID, config.UserID, "abort_upload", fmt.Sprintf("Aborted multipart upload %s/%s", upload.Bucket, upload.Key), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// markUploadAborted marque annulé l'upload suivi dont l'upload S3 a été annulé hors de ce
+// fichier (branché sur s3.UploadAbortedFunc), pour qu'il ne soit plus proposé à la reprise
+func markUploadAborted(projectID uint, uploadID string) {
+	var upload MultipartUpload
+	if err := db.Where("project_id = ? AND upload_id = ? AND status = ?", projectID, uploadID, multipartStatusInProgress).First(&upload).Error; err != nil {
+		return
+	}
+	if err := db.Model(&upload).Update("status", multipartStatusAborted).Error; err != nil {
+		log.Printf("Failed to mark upload %s as aborted: %v", uploadID, err)
+		return
+	}
+	if upload.Protocol == multipartProtocolTus {
+		os.Remove(tusBufferPath(upload))
+		tusLocks.Delete(upload.ID)
+	}
+}
+
+// HandleListMultipartSessions gère POST /api/{projectId}/s3/list-multipart-sessions.
+// Retourne les uploads en cours du projet pour que le frontend puisse proposer de les reprendre.
+func HandleListMultipartSessions(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ListMultipartSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	query := db.Where("project_id = ? AND status = ? AND protocol = ?", config.ID, multipartStatusInProgress, multipartProtocolChunked)
+	if req.Bucket != "" {
+		query = query.Where("bucket = ?", req.Bucket)
+	}
+
+	uploads := []MultipartUpload{}
+	if err := query.Order("updated_at desc").Find(&uploads).Error; err != nil {
+		jsonError(w, "Failed to fetch uploads", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"uploads": uploads})
+}
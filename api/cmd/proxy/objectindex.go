@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	objectIndexStatusPending  = "pending"
+	objectIndexStatusCrawling = "crawling"
+	objectIndexStatusReady    = "ready"
+	objectIndexStatusError    = "error"
+
+	objectIndexDefaultInterval = 60          // minutes
+	objectIndexMinInterval     = 5           // minutes
+	objectIndexMaxInterval     = 7 * 24 * 60 // minutes
+	objectIndexBatchSize       = 500
+	objectIndexCrawlTimeout    = 6 * time.Hour
+	objectIndexSearchMaxLimit  = 1000
+)
+
+// objectIndexFTS indique si SQLite a été compilé avec FTS5 (go build -tags sqlite_fts5).
+// Sans FTS5 la recherche retombe sur LIKE, plus lent sur de gros index.
+var objectIndexFTS bool
+
+// objectIndexCrawls empêche deux crawls simultanés du même index
+var objectIndexCrawls sync.Map
+
+type ObjectIndexRequest struct {
+	Bucket        string `json:"bucket"`
+	CrawlInterval int    `json:"crawlInterval,omitempty"` // Minutes (enable-object-index)
+}
+
+type ObjectIndexSearchRequest struct {
+	Bucket  string `json:"bucket"`
+	Query   string `json:"query,omitempty"` // Mots recherchés dans la clé (tous requis)
+	Prefix  string `json:"prefix,omitempty"`
+	MinSize int64  `json:"minSize,omitempty"`
+	MaxSize int64  `json:"maxSize,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+	Offset  int    `json:"offset,omitempty"`
+}
+
+type ObjectIndexSearchResponse struct {
+	Objects         []ObjectIndexEntry `json:"objects"`
+	Total           int64              `json:"total"`
+	Status          string             `json:"status"`
+	IndexedAt       *time.Time         `json:"indexed_at"`
+	IndexAgeSeconds int64              `json:"index_age_seconds"` // -1 tant que le premier crawl n'est pas terminé
+	FullText        bool               `json:"full_text"`
+}
+
+// setupObjectIndexFTS crée la table FTS5 (tokenizer trigram : recherche de sous-chaînes dans les clés)
+// et les triggers qui la synchronisent avec object_index_entries.
+func setupObjectIndexFTS(db *gorm.DB) {
+	err := db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS object_index_fts USING fts5(key, content='object_index_entries', content_rowid='id', tokenize='trigram')").Error
+	if err != nil {
+		// Binaire sans FTS5 : des triggers créés par un binaire précédent casseraient les écritures
+		for _, trigger := range []string{"object_index_entries_ai", "object_index_entries_ad", "object_index_entries_au"} {
+			db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+		}
+		log.Printf("Object index: FTS5 unavailable (%v), falling back to LIKE queries", err)
+		return
+	}
+
+	var triggers int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'object_index_entries_%'").Scan(&triggers)
+	if triggers < 3 {
+		statements := []string{
+			`CREATE TRIGGER IF NOT EXISTS object_index_entries_ai AFTER INSERT ON object_index_entries BEGIN
+				INSERT INTO object_index_fts(rowid, key) VALUES (new.id, new.key);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS object_index_entries_ad AFTER DELETE ON object_index_entries BEGIN
+				INSERT INTO object_index_fts(object_index_fts, rowid, key) VALUES ('delete', old.id, old.key);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS object_index_entries_au AFTER UPDATE OF key ON object_index_entries BEGIN
+				INSERT INTO object_index_fts(object_index_fts, rowid, key) VALUES ('delete', old.id, old.key);
+				INSERT INTO object_index_fts(rowid, key) VALUES (new.id, new.key);
+			END`,
+			// Les entrées écrites sans triggers (binaire sans FTS5) doivent être réindexées
+			"INSERT INTO object_index_fts(object_index_fts) VALUES ('rebuild')",
+		}
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				log.Printf("Object index: failed to set up FTS5 triggers: %v", err)
+				return
+			}
+		}
+	}
+	objectIndexFTS = true
+}
+
+// upsertObjectIndexEntries insère ou met à jour des clés ; la clé ne change jamais, le trigger
+// de mise à jour FTS ne se déclenche donc pas sur un simple re-crawl
+func upsertObjectIndexEntries(tx *gorm.DB, entries []ObjectIndexEntry) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "index_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"size", "e_tag", "last_modified", "crawl_seq"}),
+	}).Create(&entries).Error
+}
+
+// objectIndexClient crée un client S3 avec les identifiants du projet (crawls en arrière-plan)
+func objectIndexClient(projectID uint) (*minio.Client, error) {
+	var project S3Config
+	if err := db.First(&project, projectID).Error; err != nil {
+		return nil, err
+	}
+	creds, err := s3.GetS3Credentials(toS3ConfigData(project), "", "")
+	if err != nil {
+		return nil, err
+	}
+	return s3.CreateS3Client(creds)
+}
+
+// crawlObjectIndex liste tout le bucket et met l'index à jour. Les clés absentes du listing
+// (numéro de crawl plus ancien) sont supprimées à la fin d'un crawl réussi.
+func crawlObjectIndex(indexID uint) {
+	if _, running := objectIndexCrawls.LoadOrStore(indexID, struct{}{}); running {
+		return
+	}
+	defer objectIndexCrawls.Delete(indexID)
+
+	var idx ObjectIndex
+	if err := db.First(&idx, indexID).Error; err != nil {
+		return
+	}
+
+	seq := idx.CrawlSeq + 1
+	db.Model(&idx).Updates(map[string]interface{}{"status": objectIndexStatusCrawling, "crawl_seq": seq})
+
+	fail := func(err error) {
+		db.Model(&idx).Updates(map[string]interface{}{"status": objectIndexStatusError, "last_error": err.Error()})
+		LogActivity(db, idx.ProjectID, idx.UserID, "crawl_object_index", fmt.Sprintf("Failed to index bucket %s: %v", idx.Bucket, err), "error")
+	}
+
+	client, err := objectIndexClient(idx.ProjectID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), objectIndexCrawlTimeout)
+	defer cancel()
+
+	batch := make([]ObjectIndexEntry, 0, objectIndexBatchSize)
+	for object := range client.ListObjects(ctx, idx.Bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			err = object.Err
+			break
+		}
+		if strings.HasPrefix(object.Key, s3.TrashPrefix) {
+			continue
+		}
+		batch = append(batch, ObjectIndexEntry{
+			IndexID:      idx.ID,
+			Key:          object.Key,
+			Size:         object.Size,
+			ETag:         strings.Trim(object.ETag, `"`),
+			LastModified: object.LastModified,
+			CrawlSeq:     seq,
+		})
+		if len(batch) == objectIndexBatchSize {
+			if err = upsertObjectIndexEntries(db, batch); err != nil {
+				break
+			}
+			batch = batch[:0]
+		}
+	}
+	if err == nil && len(batch) > 0 {
+		err = upsertObjectIndexEntries(db, batch)
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// L'index a pu être désactivé pendant le crawl
+	if err := db.First(&ObjectIndex{}, idx.ID).Error; err != nil {
+		db.Where("index_id = ?", idx.ID).Delete(&ObjectIndexEntry{})
+		return
+	}
+
+	db.Where("index_id = ? AND crawl_seq < ?", idx.ID, seq).Delete(&ObjectIndexEntry{})
+
+	var count int64
+	db.Model(&ObjectIndexEntry{}).Where("index_id = ?", idx.ID).Count(&count)
+	now := time.Now()
+	db.Model(&idx).Updates(map[string]interface{}{
+		"status":        objectIndexStatusReady,
+		"last_crawl_at": now,
+		"last_error":    "",
+		"object_count":  count,
+	})
+}
+
+// scheduleObjectIndexCrawls lance les re-crawls arrivés à échéance
+func scheduleObjectIndexCrawls() {
+	var indexes []ObjectIndex
+	if err := db.Find(&indexes).Error; err != nil {
+		return
+	}
+	for _, idx := range indexes {
+		interval := time.Duration(idx.CrawlInterval) * time.Minute
+		switch {
+		case idx.Status == objectIndexStatusError && time.Since(idx.UpdatedAt) < interval:
+			continue
+		case idx.LastCrawlAt != nil && time.Since(*idx.LastCrawlAt) < interval:
+			continue
+		}
+		go crawlObjectIndex(idx.ID)
+	}
+}
+
+// runObjectIndexScheduler vérifie chaque minute les index à re-crawler
+func runObjectIndexScheduler() {
+	// Un crawl interrompu par un redémarrage est relancé
+	db.Model(&ObjectIndex{}).Where("status = ?", objectIndexStatusCrawling).Update("status", objectIndexStatusPending)
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		scheduleObjectIndexCrawls()
+		<-ticker.C
+	}
+}
+
+// indexObjectChange applique à l'index les écritures faites via kexamanager (branché sur s3.ObjectChangedFunc)
+func indexObjectChange(projectID uint, change s3.ObjectChange) {
+	var idx ObjectIndex
+	if err := db.Where("project_id = ? AND bucket = ?", projectID, change.Bucket).First(&idx).Error; err != nil {
+		return
+	}
+
+	if change.Deleted {
+		db.Where("index_id = ? AND `key` = ?", idx.ID, change.Key).Delete(&ObjectIndexEntry{})
+		return
+	}
+
+	// Numéro du crawl courant : une clé ajoutée pendant un crawl n'est pas supprimée à sa fin
+	upsertObjectIndexEntries(db, []ObjectIndexEntry{{
+		IndexID:      idx.ID,
+		Key:          change.Key,
+		Size:         change.Size,
+		ETag:         strings.Trim(change.ETag, `"`),
+		LastModified: change.LastModified,
+		CrawlSeq:     idx.CrawlSeq,
+	}})
+}
+
+// findObjectIndex charge l'index d'un bucket du projet ou répond 404
+func findObjectIndex(w http.ResponseWriter, config s3.S3ConfigData, bucket string) (ObjectIndex, bool) {
+	var idx ObjectIndex
+	if err := db.Where("project_id = ? AND bucket = ?", config.ID, bucket).First(&idx).Error; err != nil {
+		jsonError(w, "No index for this bucket", http.StatusNotFound)
+		return idx, false
+	}
+	return idx, true
+}
+
+// escapeLike échappe les caractères spéciaux de LIKE (utilisé avec ESCAPE '\')
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// HandleEnableObjectIndex gère POST /api/{projectId}/s3/enable-object-index (crée l'index ou change
+// son intervalle, puis lance un crawl)
+func HandleEnableObjectIndex(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ObjectIndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Bucket == "" {
+		jsonError(w, "bucket is required", http.StatusBadRequest)
+		return
+	}
+
+	interval := req.CrawlInterval
+	if interval == 0 {
+		interval = objectIndexDefaultInterval
+	}
+	if interval < objectIndexMinInterval || interval > objectIndexMaxInterval {
+		jsonError(w, fmt.Sprintf("crawlInterval must be between %d and %d minutes", objectIndexMinInterval, objectIndexMaxInterval), http.StatusBadRequest)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, "", "")
+	if !ok {
+		return
+	}
+	exists, err := client.BucketExists(r.Context(), req.Bucket)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Failed to check bucket: %v", err), http.StatusBadGateway)
+		return
+	}
+	if !exists {
+		jsonError(w, "Bucket not found", http.StatusNotFound)
+		return
+	}
+
+	var idx ObjectIndex
+	err = db.Where("project_id = ? AND bucket = ?", config.ID, req.Bucket).First(&idx).Error
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		idx = ObjectIndex{
+			ProjectID:     config.ID,
+			UserID:        config.UserID,
+			Bucket:        req.Bucket,
+			CrawlInterval: interval,
+			Status:        objectIndexStatusPending,
+		}
+		if err := db.Create(&idx).Error; err != nil {
+			jsonError(w, "Failed to create index", http.StatusInternalServerError)
+			return
+		}
+	case err != nil:
+		jsonError(w, "Failed to fetch index", http.StatusInternalServerError)
+		return
+	default:
+		if err := db.Model(&idx).Update("crawl_interval", interval).Error; err != nil {
+			jsonError(w, "Failed to update index", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	go crawlObjectIndex(idx.ID)
+
+	LogActivity(db, config.ID, config.UserID, "enable_object_index", fmt.Sprintf("Enabled key index for bucket %s (re-crawl every %d minutes)", req.Bucket, interval), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(idx)
+}
+
+// HandleDisableObjectIndex gère POST /api/{projectId}/s3/disable-object-index
+func HandleDisableObjectIndex(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ObjectIndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	idx, ok := findObjectIndex(w, config, req.Bucket)
+	if !ok {
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("index_id = ?", idx.ID).Delete(&ObjectIndexEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&idx).Error
+	}); err != nil {
+		jsonError(w, "Failed to delete index", http.StatusInternalServerError)
+		return
+	}
+
+	LogActivity(db, config.ID, config.UserID, "disable_object_index", fmt.Sprintf("Disabled key index for bucket %s", req.Bucket), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// HandleListObjectIndexes gère POST /api/{projectId}/s3/list-object-indexes
+func HandleListObjectIndexes(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var indexes []ObjectIndex
+	if err := db.Where("project_id = ?", config.ID).Order("bucket").Find(&indexes).Error; err != nil {
+		jsonError(w, "Failed to fetch indexes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"indexes": indexes, "full_text": objectIndexFTS})
+}
+
+// HandleReindexBucket gère POST /api/{projectId}/s3/reindex-bucket (crawl immédiat)
+func HandleReindexBucket(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ObjectIndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	idx, ok := findObjectIndex(w, config, req.Bucket)
+	if !ok {
+		return
+	}
+	if _, running := objectIndexCrawls.Load(idx.ID); running {
+		jsonError(w, "A crawl is already running for this bucket", http.StatusConflict)
+		return
+	}
+
+	go crawlObjectIndex(idx.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// HandleSearchObjectIndex gère POST /api/{projectId}/s3/search-object-index. La réponse indique
+// l'âge de l'index : les objets écrits hors de kexamanager n'apparaissent qu'au crawl suivant.
+func HandleSearchObjectIndex(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ObjectIndexSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	idx, ok := findObjectIndex(w, config, req.Bucket)
+	if !ok {
+		return
+	}
+
+	query := db.Model(&ObjectIndexEntry{}).Where("index_id = ?", idx.ID)
+	if req.Prefix != "" {
+		query = query.Where("`key` LIKE ? ESCAPE '\\'", escapeLike(req.Prefix)+"%")
+	}
+
+	// Le tokenizer trigram ne peut pas chercher moins de 3 caractères : LIKE pour ces termes
+	var phrases []string
+	for _, term := range strings.Fields(req.Query) {
+		if objectIndexFTS && utf8.RuneCountInString(term) >= 3 {
+			phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+			continue
+		}
+		query = query.Where("`key` LIKE ? ESCAPE '\\'", "%"+escapeLike(term)+"%")
+	}
+	if len(phrases) > 0 {
+		query = query.Where("id IN (SELECT rowid FROM object_index_fts WHERE object_index_fts MATCH ?)", strings.Join(phrases, " AND "))
+	}
+
+	if req.MinSize > 0 {
+		query = query.Where("size >= ?", req.MinSize)
+	}
+	if req.MaxSize > 0 {
+		query = query.Where("size <= ?", req.MaxSize)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		jsonError(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	limit = min(limit, objectIndexSearchMaxLimit)
+
+	objects := []ObjectIndexEntry{}
+	if err := query.Order("`key`").Limit(limit).Offset(max(req.Offset, 0)).Find(&objects).Error; err != nil {
+		jsonError(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := ObjectIndexSearchResponse{
+		Objects:         objects,
+		Total:           total,
+		Status:          idx.Status,
+		IndexedAt:       idx.LastCrawlAt,
+		IndexAgeSeconds: -1,
+		FullText:        objectIndexFTS,
+	}
+	if idx.LastCrawlAt != nil {
+		resp.IndexAgeSeconds = int64(time.Since(*idx.LastCrawlAt).Seconds())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,340 @@
+package s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	archiveFormatZip   = "zip"
+	archiveFormatTarGz = "tar.gz"
+
+	// ArchiveMaxTotalSize caps the uncompressed size of an archive-prefix export
+	ArchiveMaxTotalSize int64 = 10 << 30
+	archiveMaxObjects         = 50000
+
+	archiveDefaultConcurrency = 4
+	archiveMaxConcurrency     = 16
+)
+
+// Formats déjà compressés : les re-compresser coûte du CPU sans rien gagner
+var archiveStoredExtensions = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true, ".heic": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".flac": true, ".mp4": true, ".mkv": true, ".mov": true, ".webm": true,
+	".pdf": true, ".docx": true, ".xlsx": true, ".pptx": true, ".jar": true, ".apk": true,
+}
+
+// archiveEntry is an object to export and its path inside the archive
+type archiveEntry struct {
+	Key  string
+	Name string
+}
+
+// prefetchedObject is an object whose GET has already been sent to S3
+type prefetchedObject struct {
+	Object *minio.Object
+	Info   minio.ObjectInfo
+	Err    error
+}
+
+// archiveName turns a key into a safe path relative to the exported prefix, or "" to skip it
+func archiveName(prefix, key string) string {
+	name := strings.TrimPrefix(key, prefix)
+	if name == "" || strings.HasSuffix(name, "/") {
+		// Marqueurs de dossier : les dossiers sont implicites dans l'archive
+		return ""
+	}
+	name = strings.TrimLeft(path.Clean("/"+name), "/")
+	if name == "" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// archiveFilename builds the download filename from the last segment of the prefix
+func archiveFilename(bucket, prefix, format string) string {
+	base := path.Base(strings.TrimSuffix(prefix, "/"))
+	if prefix == "" || base == "." || base == "/" {
+		base = bucket
+	}
+	return base + "." + format
+}
+
+// openArchiveObject sends the GET for an object. Stat forces the request so that errors
+// (and the SSE-C fallback for implicit keys) are known before the archive entry is written.
+func openArchiveObject(ctx context.Context, client *minio.Client, bucket, key string, readSSE ReadEncryption) prefetchedObject {
+	open := func(sse encrypt.ServerSide) prefetchedObject {
+		object, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{ServerSideEncryption: sse})
+		if err != nil {
+			return prefetchedObject{Err: err}
+		}
+		info, err := object.Stat()
+		if err != nil {
+			object.Close()
+			return prefetchedObject{Err: err}
+		}
+		return prefetchedObject{Object: object, Info: info}
+	}
+
+	result := open(readSSE.SSE)
+	if result.Err != nil && readSSE.SSE != nil && readSSE.Implicit && minio.ToErrorResponse(result.Err).StatusCode == http.StatusBadRequest {
+		result = open(nil)
+	}
+	return result
+}
+
+// prefetchObjects opens the objects in order with at most concurrency of them opened ahead of
+// the writer. The writer must call release once it is done with an object. The returned
+// cleanup closes the objects that were opened but never consumed.
+func prefetchObjects(ctx context.Context, client *minio.Client, bucket string, entries []archiveEntry, readSSE ReadEncryption, concurrency int) (slots []chan prefetchedObject, release func(), cleanup func(consumed int)) {
+	slots = make([]chan prefetchedObject, len(entries))
+	for i := range slots {
+		slots[i] = make(chan prefetchedObject, 1)
+	}
+	sem := make(chan struct{}, concurrency)
+	launched := make(chan int, 1)
+
+	go func() {
+		n := 0
+		defer func() { launched <- n }()
+		for i := range entries {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			n++
+			go func(i int) {
+				slots[i] <- openArchiveObject(ctx, client, bucket, entries[i].Key, readSSE)
+			}(i)
+		}
+	}()
+
+	release = func() { <-sem }
+	cleanup = func(consumed int) {
+		go func() {
+			n := <-launched
+			for i := consumed; i < n; i++ {
+				if result := <-slots[i]; result.Object != nil {
+					result.Object.Close()
+				}
+			}
+		}()
+	}
+	return slots, release, cleanup
+}
+
+// archiveWriter abstracts the zip and tar.gz writers
+type archiveWriter interface {
+	Add(name string, info minio.ObjectInfo, body io.Reader) error
+	Close() error
+}
+
+type zipArchive struct{ zw *zip.Writer }
+
+func (a *zipArchive) Add(name string, info minio.ObjectInfo, body io.Reader) error {
+	method := zip.Deflate
+	if archiveStoredExtensions[strings.ToLower(path.Ext(name))] {
+		method = zip.Store
+	}
+	header := &zip.FileHeader{Name: name, Method: method, Modified: info.LastModified}
+	header.SetMode(0o644)
+	fw, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(fw, body, info.Size)
+	return err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+type tarGzArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarGzArchive) Add(name string, info minio.ObjectInfo, body io.Reader) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     info.Size,
+		Mode:     0o644,
+		ModTime:  info.LastModified,
+		Format:   tar.FormatPAX,
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(a.tw, body, info.Size)
+	return err
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// HandleArchivePrefixWithConfig streams every object under a prefix as a ZIP or tar.gz archive.
+// The archive is built on the fly: objects are fetched ahead with bounded concurrency and
+// copied straight to the response, so memory does not grow with the archive size.
+func HandleArchivePrefixWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ArchivePrefixRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.Format == "" {
+			req.Format = archiveFormatZip
+		}
+		if req.Format == "tgz" {
+			req.Format = archiveFormatTarGz
+		}
+		if req.Format != archiveFormatZip && req.Format != archiveFormatTarGz {
+			http.Error(w, "format must be 'zip' or 'tar.gz'", http.StatusBadRequest)
+			return
+		}
+
+		maxTotalSize := ArchiveMaxTotalSize
+		if req.MaxTotalSize > 0 && req.MaxTotalSize < maxTotalSize {
+			maxTotalSize = req.MaxTotalSize
+		}
+		concurrency := archiveDefaultConcurrency
+		if req.Concurrency > 0 {
+			concurrency = min(req.Concurrency, archiveMaxConcurrency)
+		}
+
+		readSSE, err := ResolveReadEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		// Lister d'abord : les limites sont vérifiées avant d'envoyer le moindre octet
+		var entries []archiveEntry
+		var totalSize int64
+		for object := range client.ListObjects(r.Context(), req.Bucket, minio.ListObjectsOptions{Prefix: req.Prefix, Recursive: true}) {
+			if object.Err != nil {
+				http.Error(w, fmt.Sprintf("Failed to list objects: %v", object.Err), http.StatusInternalServerError)
+				return
+			}
+			if isTrashKey(object.Key) && !isTrashKey(req.Prefix) {
+				continue
+			}
+			name := archiveName(req.Prefix, object.Key)
+			if name == "" {
+				continue
+			}
+			entries = append(entries, archiveEntry{Key: object.Key, Name: name})
+			totalSize += object.Size
+			if len(entries) > archiveMaxObjects {
+				http.Error(w, fmt.Sprintf("Prefix contains more than %d objects", archiveMaxObjects), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if totalSize > maxTotalSize {
+				http.Error(w, fmt.Sprintf("Prefix exceeds the maximum archive size of %d bytes", maxTotalSize), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+		if len(entries) == 0 {
+			http.Error(w, "No objects under this prefix", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		slots, release, cleanup := prefetchObjects(ctx, client, req.Bucket, entries, readSSE, concurrency)
+
+		filename := archiveFilename(req.Bucket, req.Prefix, req.Format)
+		var archive archiveWriter
+		if req.Format == archiveFormatZip {
+			w.Header().Set("Content-Type", "application/zip")
+			archive = &zipArchive{zw: zip.NewWriter(w)}
+		} else {
+			w.Header().Set("Content-Type", "application/gzip")
+			gz := gzip.NewWriter(w)
+			archive = &tarGzArchive{gz: gz, tw: tar.NewWriter(gz)}
+		}
+		w.Header().Set("Content-Disposition", ContentDisposition("attachment", filename))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+
+		var written int64
+		consumed := 0
+		fail := func(err error) {
+			cancel()
+			cleanup(consumed)
+			if LogActionFunc != nil {
+				LogActionFunc(config.ID, config.UserID, "archive_prefix", fmt.Sprintf("Export of %s/%s failed after %d of %d objects: %v", req.Bucket, req.Prefix, consumed, len(entries), err), "error")
+			}
+			// Les en-têtes sont partis : couper la connexion pour que le client ne prenne pas
+			// une archive tronquée pour une archive complète
+			panic(http.ErrAbortHandler)
+		}
+
+		for i, entry := range entries {
+			var result prefetchedObject
+			select {
+			case result = <-slots[i]:
+			case <-ctx.Done():
+				fail(ctx.Err())
+			}
+			consumed = i + 1
+
+			err := result.Err
+			if err == nil {
+				// Un objet peut avoir grossi depuis le listing
+				if written+result.Info.Size > maxTotalSize {
+					err = fmt.Errorf("archive exceeds the maximum size of %d bytes", maxTotalSize)
+				} else {
+					err = archive.Add(entry.Name, result.Info, result.Object)
+					written += result.Info.Size
+				}
+				result.Object.Close()
+			}
+			release()
+			if err != nil {
+				fail(fmt.Errorf("%s: %v", entry.Key, err))
+			}
+		}
+
+		if err := archive.Close(); err != nil {
+			fail(err)
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "archive_prefix", fmt.Sprintf("Exported %d objects (%d bytes) from %s/%s as %s", len(entries), written, req.Bucket, req.Prefix, req.Format), "success")
+		}
+	}
+}
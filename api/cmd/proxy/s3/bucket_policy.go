@@ -0,0 +1,591 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	policyVersion       = "2012-10-17"
+	policyLegacyVersion = "2008-10-17"
+	s3ARNPrefix         = "arn:aws:s3:::"
+
+	policyTemplatePublicReadPrefix  = "public-read-prefix"
+	policyTemplatePublicList        = "public-list"
+	policyTemplateReadOnlyPrincipal = "read-only-principal"
+)
+
+var policyTemplates = []string{policyTemplatePublicReadPrefix, policyTemplatePublicList, policyTemplateReadOnlyPrincipal}
+
+// policyWriteActions are flagged when granted to anonymous users
+var policyWriteActions = []string{"s3:PutObject", "s3:DeleteObject", "s3:PutBucketPolicy", "s3:DeleteBucket", "s3:AbortMultipartUpload"}
+
+// stringList accepts either a single string or an array of strings, as IAM policies do
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("expected a string or an array of strings")
+	}
+	*l = multiple
+	return nil
+}
+
+// policyPrincipal is either "*" (everyone, including anonymous) or a map such as {"AWS": [...]}
+type policyPrincipal struct {
+	All    bool
+	Values map[string]stringList
+}
+
+func (p *policyPrincipal) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "*" {
+			return fmt.Errorf("principal string must be \"*\"")
+		}
+		p.All = true
+		return nil
+	}
+	return json.Unmarshal(data, &p.Values)
+}
+
+func (p policyPrincipal) MarshalJSON() ([]byte, error) {
+	if p.All {
+		return json.Marshal("*")
+	}
+	return json.Marshal(p.Values)
+}
+
+// anonymous reports whether the principal covers unauthenticated requests
+func (p *policyPrincipal) anonymous() bool {
+	if p == nil {
+		return false
+	}
+	if p.All {
+		return true
+	}
+	for _, v := range p.Values["AWS"] {
+		if v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type policyStatement struct {
+	Sid          string                           `json:"Sid,omitempty"`
+	Effect       string                           `json:"Effect"`
+	Principal    *policyPrincipal                 `json:"Principal,omitempty"`
+	NotPrincipal *policyPrincipal                 `json:"NotPrincipal,omitempty"`
+	Action       stringList                       `json:"Action,omitempty"`
+	NotAction    stringList                       `json:"NotAction,omitempty"`
+	Resource     stringList                       `json:"Resource,omitempty"`
+	NotResource  stringList                       `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]stringList `json:"Condition,omitempty"`
+}
+
+// policyStatements accepts a single statement object as well as an array
+type policyStatements []policyStatement
+
+func (s *policyStatements) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var single policyStatement
+		if err := json.Unmarshal(trimmed, &single); err != nil {
+			return err
+		}
+		*s = policyStatements{single}
+		return nil
+	}
+	var multiple []policyStatement
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*s = multiple
+	return nil
+}
+
+type policyDocument struct {
+	Version   string           `json:"Version"`
+	ID        string           `json:"Id,omitempty"`
+	Statement policyStatements `json:"Statement"`
+}
+
+func (s policyStatement) label(index int) string {
+	if s.Sid != "" {
+		return s.Sid
+	}
+	return fmt.Sprintf("Statement[%d]", index)
+}
+
+func parsePolicy(raw string) (policyDocument, error) {
+	var doc policyDocument
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return doc, fmt.Errorf("invalid policy JSON: %v", err)
+	}
+	return doc, nil
+}
+
+// wildcardMatch matches IAM patterns where '*' matches any sequence (including '/') and '?' one
+// character. Iterative: on a mismatch only the last '*' is retried one character further, so the
+// cost stays O(len(pattern)·len(value)) whatever the number of '*'.
+func wildcardMatch(pattern, value string) bool {
+	p, v := []rune(pattern), []rune(value)
+	pi, vi := 0, 0
+	star, starV := -1, 0
+	for vi < len(v) {
+		switch {
+		case pi < len(p) && p[pi] == '*':
+			star, starV = pi, vi
+			pi++
+		case pi < len(p) && (p[pi] == '?' || p[pi] == v[vi]):
+			pi++
+			vi++
+		case star >= 0:
+			// Le dernier '*' absorbe un caractère de plus
+			starV++
+			pi, vi = star+1, starV
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+func matchesAny(patterns []string, value string, foldCase bool) bool {
+	for _, p := range patterns {
+		if foldCase {
+			if wildcardMatch(strings.ToLower(p), strings.ToLower(value)) {
+				return true
+			}
+		} else if wildcardMatch(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePolicy checks a policy document for a bucket. Errors are what S3 would reject,
+// warnings flag statements that open anonymous access.
+func validatePolicy(raw, bucket string) (policyDocument, []string, []string) {
+	errs := []string{}
+	warnings := []string{}
+
+	doc, err := parsePolicy(raw)
+	if err != nil {
+		return doc, append(errs, err.Error()), warnings
+	}
+
+	switch doc.Version {
+	case policyVersion:
+	case policyLegacyVersion, "":
+		warnings = append(warnings, fmt.Sprintf("Version should be %q: policy variables are not supported by older versions", policyVersion))
+	default:
+		errs = append(errs, fmt.Sprintf("unsupported Version %q", doc.Version))
+	}
+	if len(doc.Statement) == 0 {
+		errs = append(errs, "at least one Statement is required")
+	}
+
+	sids := map[string]bool{}
+	for i, stmt := range doc.Statement {
+		name := stmt.label(i)
+		if stmt.Sid != "" {
+			if sids[stmt.Sid] {
+				errs = append(errs, fmt.Sprintf("%s: Sid is used by several statements", name))
+			}
+			sids[stmt.Sid] = true
+		}
+
+		if stmt.Effect != "Allow" && stmt.Effect != "Deny" {
+			errs = append(errs, fmt.Sprintf("%s: Effect must be 'Allow' or 'Deny'", name))
+		}
+		if (stmt.Principal == nil) == (stmt.NotPrincipal == nil) {
+			errs = append(errs, fmt.Sprintf("%s: exactly one of Principal or NotPrincipal is required", name))
+		}
+		if (len(stmt.Action) == 0) == (len(stmt.NotAction) == 0) {
+			errs = append(errs, fmt.Sprintf("%s: exactly one of Action or NotAction is required", name))
+		}
+		if (len(stmt.Resource) == 0) == (len(stmt.NotResource) == 0) {
+			errs = append(errs, fmt.Sprintf("%s: exactly one of Resource or NotResource is required", name))
+		}
+
+		for _, action := range append(append(stringList{}, stmt.Action...), stmt.NotAction...) {
+			if action != "*" && !strings.HasPrefix(strings.ToLower(action), "s3:") {
+				errs = append(errs, fmt.Sprintf("%s: action %q is not an S3 action", name, action))
+			}
+		}
+		for _, resource := range append(append(stringList{}, stmt.Resource...), stmt.NotResource...) {
+			if resource == "*" {
+				continue
+			}
+			target := strings.TrimPrefix(resource, s3ARNPrefix)
+			if target == resource {
+				errs = append(errs, fmt.Sprintf("%s: resource %q must start with %s", name, resource, s3ARNPrefix))
+			} else if b, _, _ := strings.Cut(target, "/"); !wildcardMatch(b, bucket) {
+				errs = append(errs, fmt.Sprintf("%s: resource %q does not belong to bucket %s", name, resource, bucket))
+			}
+		}
+
+		if stmt.Effect == "Allow" && stmt.Principal.anonymous() {
+			if len(stmt.NotAction) > 0 || matchesAny(stmt.Action, "s3:*", true) {
+				warnings = append(warnings, fmt.Sprintf("%s: grants every S3 action to anonymous users", name))
+			} else {
+				warnings = append(warnings, fmt.Sprintf("%s: grants anonymous access (%s)", name, strings.Join(stmt.Action, ", ")))
+				for _, action := range policyWriteActions {
+					if matchesAny(stmt.Action, action, true) {
+						warnings = append(warnings, fmt.Sprintf("%s: anonymous users can call %s", name, action))
+					}
+				}
+			}
+		}
+	}
+
+	return doc, errs, warnings
+}
+
+// simulateAnonymousGet evaluates whether an unauthenticated GetObject on bucket/key is allowed.
+// Statements with conditions cannot be evaluated without the request context and are reported apart.
+func simulateAnonymousGet(doc policyDocument, bucket, key string) SimulatePolicyResponse {
+	const action = "s3:GetObject"
+	resource := s3ARNPrefix + bucket + "/" + key
+	resp := SimulatePolicyResponse{Statements: []string{}}
+
+	denied := false
+	allowed := false
+	for i, stmt := range doc.Statement {
+		principalMatch := stmt.Principal.anonymous()
+		if stmt.NotPrincipal != nil {
+			principalMatch = !stmt.NotPrincipal.anonymous()
+		}
+		actionMatch := matchesAny(stmt.Action, action, true)
+		if len(stmt.NotAction) > 0 {
+			actionMatch = !matchesAny(stmt.NotAction, action, true)
+		}
+		resourceMatch := matchesAny(stmt.Resource, resource, false)
+		if len(stmt.NotResource) > 0 {
+			resourceMatch = !matchesAny(stmt.NotResource, resource, false)
+		}
+		if !principalMatch || !actionMatch || !resourceMatch {
+			continue
+		}
+
+		if len(stmt.Condition) > 0 {
+			resp.Conditions = append(resp.Conditions, stmt.label(i))
+			continue
+		}
+		resp.Statements = append(resp.Statements, stmt.label(i))
+		if stmt.Effect == "Deny" {
+			denied = true
+		} else if stmt.Effect == "Allow" {
+			allowed = true
+		}
+	}
+
+	// Un Deny explicite l'emporte toujours sur un Allow
+	switch {
+	case denied:
+		resp.Reason = "explicitly denied by the policy"
+	case allowed:
+		resp.Allowed = true
+		resp.Reason = "allowed by the policy"
+	default:
+		resp.Reason = "no statement grants anonymous GetObject on this key (implicit deny)"
+	}
+	if len(resp.Conditions) > 0 {
+		resp.Reason += "; conditional statements were not evaluated"
+	}
+	return resp
+}
+
+// buildPolicyTemplate generates a ready-to-edit policy for a common use case
+func buildPolicyTemplate(req PolicyTemplateRequest) (string, error) {
+	bucketARN := s3ARNPrefix + req.Bucket
+	objectsARN := bucketARN + "/" + req.Prefix + "*"
+	anonymous := &policyPrincipal{Values: map[string]stringList{"AWS": {"*"}}}
+
+	var statements policyStatements
+	switch req.Template {
+	case policyTemplatePublicReadPrefix:
+		statements = policyStatements{{
+			Sid:       "PublicRead",
+			Effect:    "Allow",
+			Principal: anonymous,
+			Action:    stringList{"s3:GetObject"},
+			Resource:  stringList{objectsARN},
+		}}
+	case policyTemplatePublicList:
+		list := policyStatement{
+			Sid:       "PublicList",
+			Effect:    "Allow",
+			Principal: anonymous,
+			Action:    stringList{"s3:ListBucket"},
+			Resource:  stringList{bucketARN},
+		}
+		if req.Prefix != "" {
+			list.Condition = map[string]map[string]stringList{"StringLike": {"s3:prefix": {req.Prefix + "*"}}}
+		}
+		statements = policyStatements{list, {
+			Sid:       "PublicRead",
+			Effect:    "Allow",
+			Principal: anonymous,
+			Action:    stringList{"s3:GetObject"},
+			Resource:  stringList{objectsARN},
+		}}
+	case policyTemplateReadOnlyPrincipal:
+		if req.Principal == "" {
+			return "", fmt.Errorf("principal is required for the %s template", req.Template)
+		}
+		principal := &policyPrincipal{Values: map[string]stringList{"AWS": {req.Principal}}}
+		statements = policyStatements{{
+			Sid:       "ReadOnlyBucket",
+			Effect:    "Allow",
+			Principal: principal,
+			Action:    stringList{"s3:ListBucket", "s3:GetBucketLocation"},
+			Resource:  stringList{bucketARN},
+		}, {
+			Sid:       "ReadOnlyObjects",
+			Effect:    "Allow",
+			Principal: principal,
+			Action:    stringList{"s3:GetObject"},
+			Resource:  stringList{objectsARN},
+		}}
+	default:
+		return "", fmt.Errorf("unknown template %q (expected one of %s)", req.Template, strings.Join(policyTemplates, ", "))
+	}
+
+	out, err := json.MarshalIndent(policyDocument{Version: policyVersion, Statement: statements}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func decodeBucketPolicyRequest(w http.ResponseWriter, r *http.Request) (BucketPolicyRequest, bool) {
+	var req BucketPolicyRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Bucket == "" {
+		http.Error(w, "bucket is required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// HandleGetBucketPolicyWithConfig returns the policy of a bucket (empty when none is set)
+func HandleGetBucketPolicyWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeBucketPolicyRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		policy, err := client.GetBucketPolicy(r.Context(), req.Bucket)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get bucket policy: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketPolicyResponse{Policy: policy})
+	}
+}
+
+// HandleSetBucketPolicyWithConfig validates and applies a bucket policy
+func HandleSetBucketPolicyWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeBucketPolicyRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if strings.TrimSpace(req.Policy) == "" {
+			http.Error(w, "policy is required (use delete-bucket-policy to remove it)", http.StatusBadRequest)
+			return
+		}
+		if _, errs, _ := validatePolicy(req.Policy, req.Bucket); len(errs) > 0 {
+			http.Error(w, fmt.Sprintf("Invalid bucket policy: %s", strings.Join(errs, "; ")), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		if err := client.SetBucketPolicy(r.Context(), req.Bucket, req.Policy); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set bucket policy: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "set_bucket_policy", fmt.Sprintf("Set policy on bucket %s", req.Bucket), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketPolicyResponse{Policy: req.Policy})
+	}
+}
+
+// HandleDeleteBucketPolicyWithConfig removes the policy of a bucket
+func HandleDeleteBucketPolicyWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeBucketPolicyRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		// Une policy vide supprime la policy du bucket
+		if err := client.SetBucketPolicy(r.Context(), req.Bucket, ""); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete bucket policy: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "delete_bucket_policy", fmt.Sprintf("Removed policy from bucket %s", req.Bucket), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}
+}
+
+// HandleValidateBucketPolicyWithConfig checks a policy without applying it
+func HandleValidateBucketPolicyWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeBucketPolicyRequest(w, r)
+		if !ok {
+			return
+		}
+
+		_, errs, warnings := validatePolicy(req.Policy, req.Bucket)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PolicyValidationResponse{
+			Valid:    len(errs) == 0,
+			Errors:   errs,
+			Warnings: warnings,
+		})
+	}
+}
+
+// HandleBucketPolicyTemplate builds a policy from a template, or lists the templates when none is given
+func HandleBucketPolicyTemplate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PolicyTemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if req.Template == "" {
+			json.NewEncoder(w).Encode(PolicyTemplateResponse{Templates: policyTemplates})
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		policy, err := buildPolicyTemplate(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(PolicyTemplateResponse{Policy: policy})
+	}
+}
+
+// HandleSimulateBucketPolicyWithConfig answers "can an anonymous user GET this key?" for a
+// candidate policy, or for the policy currently applied to the bucket
+func HandleSimulateBucketPolicyWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req SimulatePolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		policy := req.Policy
+		if strings.TrimSpace(policy) == "" {
+			client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+			if !ok {
+				return
+			}
+			current, err := client.GetBucketPolicy(r.Context(), req.Bucket)
+			if err != nil && minio.ToErrorResponse(err).Code != minio.NoSuchBucketPolicy {
+				http.Error(w, fmt.Sprintf("Failed to get bucket policy: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if current == "" {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(SimulatePolicyResponse{
+					Reason:     "the bucket has no policy (implicit deny)",
+					Statements: []string{},
+				})
+				return
+			}
+			policy = current
+		}
+
+		doc, err := parsePolicy(policy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(simulateAnonymousGet(doc, req.Bucket, req.Key))
+	}
+}
@@ -0,0 +1,57 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "any/key", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/dir/file.txt", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::other/file.txt", false},
+		{"arn:aws:s3:::bucket", "arn:aws:s3:::bucket/file", false},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:Get*", "s3:PutObject", false},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file.txt", false},
+		{"file?.txt", "file12.txt", false},
+		{"?", "é", true},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"a*c", "abcbc", true},
+		{"*.jpg", "photo.jpg.png", false},
+		{"**", "x", true},
+		{"a**", "a", true},
+		{"dir/*/file", "dir/a/b/file", true},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWildcardMatchManyStars(t *testing.T) {
+	// Un retour arrière récursif explose sur ce motif : le test doit rester instantané
+	pattern := "a*a*a*a*a*a*a*a*a*a*b"
+	value := strings.Repeat("a", 10000)
+	start := time.Now()
+	if wildcardMatch(pattern, value) {
+		t.Fatalf("wildcardMatch(%q, a×10000) = true, want false", pattern)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("wildcardMatch took %v", elapsed)
+	}
+	if !wildcardMatch(pattern, value+"b") {
+		t.Fatalf("wildcardMatch(%q, a×10000+b) = false, want true", pattern)
+	}
+}
@@ -0,0 +1,251 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Checksum algorithms accepted by put-object and checked by verify-object
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA256 = "sha256"
+	ChecksumCRC32C = "crc32c"
+)
+
+// checksumMetadataPrefix names the x-amz-meta-* entries holding the checksums (hex)
+const checksumMetadataPrefix = "kexa-checksum-"
+
+var checksumAlgorithms = []string{ChecksumMD5, ChecksumSHA256, ChecksumCRC32C}
+
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case ChecksumMD5:
+		return md5.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	default:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+}
+
+// parseChecksum accepts a digest in hex or base64 (the encoding of the S3 Content-MD5 and
+// x-amz-checksum-* headers) and returns it in lowercase hex
+func parseChecksum(algorithm, value string) (string, error) {
+	size := newChecksumHash(algorithm).Size()
+	value = strings.TrimSpace(value)
+	if len(value) == 2*size {
+		if raw, err := hex.DecodeString(value); err == nil {
+			return hex.EncodeToString(raw), nil
+		}
+	}
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == size {
+		return hex.EncodeToString(raw), nil
+	}
+	return "", fmt.Errorf("%s must be a %d-byte digest in hex or base64", algorithm, size)
+}
+
+// checksumsFromForm reads the optional md5, sha256 and crc32c form fields
+func checksumsFromForm(r *http.Request) (map[string]string, error) {
+	expected := map[string]string{}
+	for _, algorithm := range checksumAlgorithms {
+		value := r.FormValue(algorithm)
+		if value == "" {
+			continue
+		}
+		digest, err := parseChecksum(algorithm, value)
+		if err != nil {
+			return nil, err
+		}
+		expected[algorithm] = digest
+	}
+	return expected, nil
+}
+
+// computeChecksums hashes body once for every requested algorithm
+func computeChecksums(body io.Reader, algorithms []string) (map[string]string, int64, error) {
+	hashes := make(map[string]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		hashes[algorithm] = newChecksumHash(algorithm)
+		writers = append(writers, hashes[algorithm])
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), body)
+	if err != nil {
+		return nil, n, err
+	}
+	sums := make(map[string]string, len(hashes))
+	for algorithm, h := range hashes {
+		sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, n, nil
+}
+
+// verifyUploadChecksums hashes the received file before it is sent to S3, so a corrupted
+// upload is refused without ever replacing the object. The file is rewound afterwards.
+func verifyUploadChecksums(file io.ReadSeeker, expected map[string]string) error {
+	if len(expected) == 0 {
+		return nil
+	}
+	algorithms := make([]string, 0, len(expected))
+	for algorithm := range expected {
+		algorithms = append(algorithms, algorithm)
+	}
+	sums, _, err := computeChecksums(file, algorithms)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %v", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind upload: %v", err)
+	}
+	for _, algorithm := range algorithms {
+		if sums[algorithm] != expected[algorithm] {
+			return fmt.Errorf("%s mismatch: expected %s, received %s", algorithm, expected[algorithm], sums[algorithm])
+		}
+	}
+	return nil
+}
+
+// checksumMetadata turns verified checksums into user metadata stored with the object
+func checksumMetadata(checksums map[string]string) map[string]string {
+	if len(checksums) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(checksums))
+	for algorithm, digest := range checksums {
+		metadata[checksumMetadataPrefix+algorithm] = digest
+	}
+	return metadata
+}
+
+// storedChecksums reads back the checksums recorded by put-object
+func storedChecksums(info minio.ObjectInfo) map[string]string {
+	stored := map[string]string{}
+	for k, v := range info.UserMetadata {
+		algorithm, ok := strings.CutPrefix(strings.ToLower(k), checksumMetadataPrefix)
+		if !ok {
+			continue
+		}
+		for _, known := range checksumAlgorithms {
+			if algorithm == known {
+				stored[algorithm] = strings.ToLower(v)
+			}
+		}
+	}
+	return stored
+}
+
+// HandleVerifyObjectWithConfig re-reads an object and compares its digests with the
+// checksums stored in its metadata at upload time
+func HandleVerifyObjectWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req VerifyObjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		readSSE, err := ResolveReadEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		info, sse, err := readSSE.Stat(r.Context(), client, req.Bucket, req.Key, req.VersionID)
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				http.Error(w, "Object not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		stored := storedChecksums(info)
+		if len(stored) == 0 {
+			http.Error(w, "Object has no stored checksum (uploaded without md5, sha256 or crc32c)", http.StatusUnprocessableEntity)
+			return
+		}
+
+		// Relire exactement la version dont on a lu les métadonnées
+		getOpts := minio.GetObjectOptions{VersionID: info.VersionID, ServerSideEncryption: sse}
+		getOpts.SetMatchETag(normalizeETag(info.ETag))
+		object, err := client.GetObject(r.Context(), req.Bucket, req.Key, getOpts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get object: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer object.Close()
+
+		algorithms := make([]string, 0, len(stored))
+		for _, algorithm := range checksumAlgorithms {
+			if _, ok := stored[algorithm]; ok {
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+		sums, size, err := computeChecksums(object, algorithms)
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+				http.Error(w, "Object was modified while reading, please retry", http.StatusConflict)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to read object: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		resp := VerifyObjectResponse{
+			Bucket:    req.Bucket,
+			Key:       req.Key,
+			VersionID: info.VersionID,
+			Size:      size,
+			Valid:     size == info.Size,
+			Checksums: make([]ObjectChecksum, 0, len(algorithms)),
+		}
+		for _, algorithm := range algorithms {
+			match := sums[algorithm] == stored[algorithm]
+			resp.Valid = resp.Valid && match
+			resp.Checksums = append(resp.Checksums, ObjectChecksum{
+				Algorithm: algorithm,
+				Expected:  stored[algorithm],
+				Actual:    sums[algorithm],
+				Match:     match,
+			})
+		}
+
+		if LogActionFunc != nil {
+			status, result := "success", "valid"
+			if !resp.Valid {
+				status, result = "error", "CORRUPTED"
+			}
+			LogActionFunc(config.ID, config.UserID, "verify_object", fmt.Sprintf("Verified %s/%s (%d bytes): %s", req.Bucket, req.Key, size, result), status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -1,8 +1,11 @@
 package s3
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -21,6 +24,15 @@ type S3ConfigData struct {
 	ClientSecret   string `json:"client_secret"`
 	Region         string `json:"region"`
 	ForcePathStyle bool   `json:"force_path_style"`
+	DownloadMode   string `json:"download_mode"` // "presign" ou "proxy"
+	// Chiffrement par défaut des uploads ("", "sse-s3" ou "sse-c") et clé du trousseau pour "sse-c"
+	DefaultEncryption string `json:"default_encryption"`
+	DefaultSSEKey     string `json:"default_sse_key"`
+	// Politique "ne jamais écraser" : toute écriture sur une clé existante est refusée
+	NeverOverwrite bool `json:"never_overwrite"`
+	// Corbeille : les suppressions sont conservées TrashRetentionDays jours avant purge
+	TrashEnabled       bool `json:"trash_enabled"`
+	TrashRetentionDays int  `json:"trash_retention_days"`
 }
 
 // S3Credentials represents S3 credentials
@@ -49,11 +61,13 @@ type Bucket struct {
 }
 
 type ListObjectsRequest struct {
-	KeyId    string `json:"keyId"`
-	Token    string `json:"token"`
-	Bucket   string `json:"bucket"`
-	Prefix   string `json:"prefix,omitempty"`
-	ConfigID uint   `json:"configId"`
+	KeyId       string            `json:"keyId"`
+	Token       string            `json:"token"`
+	Bucket      string            `json:"bucket"`
+	Prefix      string            `json:"prefix,omitempty"`
+	IncludeTags bool              `json:"includeTags,omitempty"`
+	TagFilter   map[string]string `json:"tagFilter,omitempty"` // Ne garder que les objets portant tous ces tags
+	ConfigID    uint              `json:"configId"`
 }
 
 type ListObjectsResponse struct {
@@ -61,25 +75,40 @@ type ListObjectsResponse struct {
 	ContinuationToken string     `json:"continuationToken,omitempty"`
 	IsTruncated       bool       `json:"isTruncated"`
 	TotalSize         int64      `json:"totalSize"`
+	TagErrors         int        `json:"tagErrors,omitempty"` // Objets dont les tags n'ont pas pu être lus
 }
 
 type S3Object struct {
-	Key          string `json:"key"`
-	Size         int64  `json:"size"`
-	LastModified string `json:"lastModified"`
-	ETag         string `json:"etag"`
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	LastModified string            `json:"lastModified"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"contentType,omitempty"` // Renseigné par search-objects lorsqu'un filtre contentType est utilisé
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// SSEOptions selects server-side encryption for a request. For SSE-C the key is either
+// sent with the request (base64, 32 bytes) or taken from the project keyring by name.
+type SSEOptions struct {
+	SSE            string `json:"sse,omitempty"` // "sse-s3", "sse-c" ou "none" ; vide = défaut du projet
+	SSECustomerKey string `json:"sseCustomerKey,omitempty"`
+	SSEKeyName     string `json:"sseKeyName,omitempty"`
 }
 
 type GetObjectRequest struct {
-	KeyId    string `json:"keyId"`
-	Token    string `json:"token"`
-	Bucket   string `json:"bucket"`
-	Key      string `json:"key"`
-	ConfigID uint   `json:"configId"`
+	KeyId     string `json:"keyId"`
+	Token     string `json:"token"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"versionId,omitempty"`
+	ExpiresIn int    `json:"expiresIn,omitempty"` // Durée de validité en secondes (15 minutes par défaut)
+	ConfigID  uint   `json:"configId"`
+	SSEOptions
 }
 
 type GetObjectResponse struct {
 	PresignedURL string `json:"presignedUrl"`
+	ExpiresAt    string `json:"expiresAt,omitempty"`
 }
 
 type PutObjectRequest struct {
@@ -88,30 +117,576 @@ type PutObjectRequest struct {
 	Bucket      string `json:"bucket"`
 	Key         string `json:"key"`
 	ContentType string `json:"contentType,omitempty"`
+	ExpiresIn   int    `json:"expiresIn,omitempty"` // Durée de validité en secondes (presign-put)
+	Overwrite   *bool  `json:"overwrite,omitempty"` // false : refuser si la clé existe
+	IfNoneMatch string `json:"ifNoneMatch,omitempty"`
 	ConfigID    uint   `json:"configId"`
 }
 
 type PutObjectResponse struct {
-	PresignedURL string `json:"presignedUrl"`
+	PresignedURL string            `json:"presignedUrl"`
+	Headers      map[string]string `json:"headers,omitempty"` // En-têtes à renvoyer tels quels avec le PUT
+	ExpiresAt    string            `json:"expiresAt,omitempty"`
+}
+
+type PresignPostPolicyRequest struct {
+	KeyId             string `json:"keyId"`
+	Token             string `json:"token"`
+	Bucket            string `json:"bucket"`
+	Key               string `json:"key,omitempty"`       // Clé exacte...
+	KeyPrefix         string `json:"keyPrefix,omitempty"` // ...ou préfixe imposé
+	ContentType       string `json:"contentType,omitempty"`
+	ContentTypePrefix string `json:"contentTypePrefix,omitempty"` // ex: "image/"
+	MinSize           int64  `json:"minSize,omitempty"`
+	MaxSize           int64  `json:"maxSize,omitempty"`
+	ExpiresIn         int    `json:"expiresIn,omitempty"`
+}
+
+type PresignPostPolicyResponse struct {
+	URL       string            `json:"url"`
+	FormData  map[string]string `json:"formData"`
+	ExpiresAt string            `json:"expiresAt"`
+}
+
+type ConfirmUploadRequest struct {
+	KeyId        string `json:"keyId"`
+	Token        string `json:"token"`
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	ExpectedSize int64  `json:"expectedSize,omitempty"`
+}
+
+type ConfirmUploadResponse struct {
+	Success      bool   `json:"success"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag"`
+	ContentType  string `json:"contentType"`
+	LastModified string `json:"lastModified"`
 }
 
 type DeleteObjectRequest struct {
-	KeyId    string `json:"keyId"`
-	Token    string `json:"token"`
-	Bucket   string `json:"bucket"`
-	Key      string `json:"key"`
-	ConfigID uint   `json:"configId"`
+	KeyId            string `json:"keyId"`
+	Token            string `json:"token"`
+	Bucket           string `json:"bucket"`
+	Key              string `json:"key"`
+	VersionID        string `json:"versionId,omitempty"`
+	BypassGovernance bool   `json:"bypassGovernance,omitempty"` // Supprimer malgré une rétention GOVERNANCE
+	Permanent        bool   `json:"permanent,omitempty"`        // Ne pas passer par la corbeille du projet
+	ConfigID         uint   `json:"configId"`
 }
 
 type DeleteObjectResponse struct {
 	Success bool `json:"success"`
+	Trashed bool `json:"trashed,omitempty"` // Déplacé dans la corbeille (restaurable)
+}
+
+type StatObjectRequest struct {
+	KeyId     string `json:"keyId"`
+	Token     string `json:"token"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"versionId,omitempty"`
+	SSEOptions
+}
+
+// ObjectMetadata describes the HTTP and user metadata of an object
+type ObjectMetadata struct {
+	Key                string            `json:"key"`
+	Size               int64             `json:"size"`
+	LastModified       string            `json:"lastModified"`
+	Encryption         string            `json:"encryption,omitempty"` // "sse-s3", "sse-c", "sse-kms" ou vide
+	ETag               string            `json:"etag"`
+	VersionID          string            `json:"versionId,omitempty"`
+	StorageClass       string            `json:"storageClass,omitempty"`
+	ContentType        string            `json:"contentType"`
+	CacheControl       string            `json:"cacheControl"`
+	ContentDisposition string            `json:"contentDisposition"`
+	ContentEncoding    string            `json:"contentEncoding"`
+	ContentLanguage    string            `json:"contentLanguage"`
+	UserMetadata       map[string]string `json:"userMetadata"` // Clés sans le préfixe x-amz-meta-
+}
+
+// UpdateObjectMetadataRequest replaces object metadata. A nil field keeps the
+// current value, an empty string removes it. UserMetadata, when present,
+// replaces the whole set of x-amz-meta-* entries.
+type UpdateObjectMetadataRequest struct {
+	KeyId              string            `json:"keyId"`
+	Token              string            `json:"token"`
+	Bucket             string            `json:"bucket"`
+	Key                string            `json:"key"`
+	ContentType        *string           `json:"contentType,omitempty"`
+	CacheControl       *string           `json:"cacheControl,omitempty"`
+	ContentDisposition *string           `json:"contentDisposition,omitempty"`
+	ContentEncoding    *string           `json:"contentEncoding,omitempty"`
+	ContentLanguage    *string           `json:"contentLanguage,omitempty"`
+	UserMetadata       map[string]string `json:"userMetadata,omitempty"`
+	SSEOptions
+}
+
+// TaggingRequest targets the tags of an object, or of the bucket when Key is empty
+type TaggingRequest struct {
+	KeyId     string            `json:"keyId"`
+	Token     string            `json:"token"`
+	Bucket    string            `json:"bucket"`
+	Key       string            `json:"key,omitempty"`
+	VersionID string            `json:"versionId,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+type TaggingResponse struct {
+	Tags map[string]string `json:"tags"`
+}
+
+type BucketVersioningRequest struct {
+	KeyId  string `json:"keyId"`
+	Token  string `json:"token"`
+	Bucket string `json:"bucket"`
+	Status string `json:"status,omitempty"` // "Enabled" ou "Suspended" (set-bucket-versioning)
+}
+
+type BucketVersioningResponse struct {
+	Status string `json:"status"` // "Enabled", "Suspended" ou "" si jamais activé
+}
+
+type ListObjectVersionsRequest struct {
+	KeyId  string `json:"keyId"`
+	Token  string `json:"token"`
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix,omitempty"`
+	Key    string `json:"key,omitempty"` // Limiter l'historique à une clé précise
+}
+
+type ObjectVersion struct {
+	Key            string `json:"key"`
+	VersionID      string `json:"versionId"`
+	IsLatest       bool   `json:"isLatest"`
+	IsDeleteMarker bool   `json:"isDeleteMarker"`
+	Size           int64  `json:"size"`
+	LastModified   string `json:"lastModified"`
+	ETag           string `json:"etag,omitempty"`
+}
+
+type ListObjectVersionsResponse struct {
+	Versions []ObjectVersion `json:"versions"`
+}
+
+type ObjectVersionRequest struct {
+	KeyId     string `json:"keyId"`
+	Token     string `json:"token"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"versionId"`
+	SSEOptions
+}
+
+// LifecycleRule is the editable JSON form of an S3 lifecycle rule (see lifecycle-schema)
+type LifecycleRule struct {
+	ID                        string            `json:"id"`
+	Status                    string            `json:"status,omitempty"` // "Enabled" (défaut) ou "Disabled"
+	Prefix                    string            `json:"prefix,omitempty"`
+	Tags                      map[string]string `json:"tags,omitempty"`
+	ExpirationDays            int               `json:"expirationDays,omitempty"`
+	ExpirationDate            string            `json:"expirationDate,omitempty"` // YYYY-MM-DD, minuit UTC
+	ExpiredObjectDeleteMarker bool              `json:"expiredObjectDeleteMarker,omitempty"`
+	NoncurrentExpirationDays  int               `json:"noncurrentExpirationDays,omitempty"`
+	NewerNoncurrentVersions   int               `json:"newerNoncurrentVersions,omitempty"`
+	AbortIncompleteUploadDays int               `json:"abortIncompleteUploadDays,omitempty"`
+}
+
+type BucketLifecycleRequest struct {
+	KeyId  string          `json:"keyId"`
+	Token  string          `json:"token"`
+	Bucket string          `json:"bucket"`
+	Rules  []LifecycleRule `json:"rules,omitempty"`
+}
+
+type BucketLifecycleResponse struct {
+	Rules []LifecycleRule `json:"rules"`
+	// IDs des règles utilisant des actions non éditables (transitions...) : le PUT est refusé
+	UnsupportedRules []string `json:"unsupportedRules,omitempty"`
+}
+
+type LifecycleValidationResponse struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+type LifecyclePreviewRequest struct {
+	KeyId  string        `json:"keyId"`
+	Token  string        `json:"token"`
+	Bucket string        `json:"bucket"`
+	Rule   LifecycleRule `json:"rule"`
+	Limit  int           `json:"limit,omitempty"` // 1000 par défaut
+}
+
+type LifecyclePreviewObject struct {
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"lastModified"`
+	ExpiresAt    string `json:"expiresAt,omitempty"` // Vide si la règle n'expire pas les versions courantes
+	Expired      bool   `json:"expired"`             // Déjà éligible : supprimé au prochain passage du lifecycle
+}
+
+type LifecyclePreviewResponse struct {
+	Objects           []LifecyclePreviewObject `json:"objects"`
+	Matched           int                      `json:"matched"`
+	Expired           int                      `json:"expired"`
+	IncompleteUploads int                      `json:"incompleteUploads"` // Uploads que abortIncompleteUploadDays annulerait déjà
+	Truncated         bool                     `json:"truncated"`
+}
+
+type BucketPolicyRequest struct {
+	KeyId  string `json:"keyId"`
+	Token  string `json:"token"`
+	Bucket string `json:"bucket"`
+	Policy string `json:"policy,omitempty"` // Document JSON de la policy
+}
+
+type BucketPolicyResponse struct {
+	Policy string `json:"policy"` // Vide si le bucket n'a pas de policy
+}
+
+type PolicyValidationResponse struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+type PolicyTemplateRequest struct {
+	Bucket    string `json:"bucket"`
+	Template  string `json:"template"` // "public-read-prefix", "public-list", "read-only-principal"
+	Prefix    string `json:"prefix,omitempty"`
+	Principal string `json:"principal,omitempty"` // ARN ou identifiant de clé (read-only-principal)
+}
+
+type PolicyTemplateResponse struct {
+	Templates []string `json:"templates,omitempty"` // Renseigné quand aucun template n'est demandé
+	Policy    string   `json:"policy,omitempty"`
+}
+
+type SimulatePolicyRequest struct {
+	KeyId  string `json:"keyId"`
+	Token  string `json:"token"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Policy string `json:"policy,omitempty"` // Policy à tester ; vide = policy actuelle du bucket
+}
+
+type SimulatePolicyResponse struct {
+	Allowed    bool     `json:"allowed"`
+	Reason     string   `json:"reason"`
+	Statements []string `json:"statements"`           // Statements (Sid ou index) qui s'appliquent à la requête
+	Conditions []string `json:"conditions,omitempty"` // Statements ignorés car soumis à des conditions
+}
+
+type CORSRule struct {
+	ID             string   `json:"id,omitempty"`
+	AllowedOrigins []string `json:"allowedOrigins"`
+	AllowedMethods []string `json:"allowedMethods"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	ExposeHeaders  []string `json:"exposeHeaders,omitempty"`
+	MaxAgeSeconds  int      `json:"maxAgeSeconds,omitempty"`
+}
+
+type BucketCORSRequest struct {
+	KeyId  string     `json:"keyId"`
+	Token  string     `json:"token"`
+	Bucket string     `json:"bucket"`
+	Rules  []CORSRule `json:"rules,omitempty"`
+}
+
+type BucketCORSResponse struct {
+	Rules []CORSRule `json:"rules"`
+}
+
+type AllowCORSOriginRequest struct {
+	KeyId  string `json:"keyId"`
+	Token  string `json:"token"`
+	Bucket string `json:"bucket"`
+	Origin string `json:"origin,omitempty"` // Par défaut, l'origine de la requête (en-tête Origin ou Referer)
+	Apply  bool   `json:"apply"`            // false = aperçu sans modifier le bucket
+}
+
+type AllowCORSOriginResponse struct {
+	Rule    CORSRule   `json:"rule"`
+	Rules   []CORSRule `json:"rules"` // Configuration complète après fusion
+	Applied bool       `json:"applied"`
+}
+
+type DiagnoseCORSRequest struct {
+	KeyId  string `json:"keyId"`
+	Token  string `json:"token"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key,omitempty"`    // Clé utilisée pour construire l'URL testée
+	Origin string `json:"origin,omitempty"` // Par défaut, l'origine de la requête
+	Method string `json:"method,omitempty"` // PUT par défaut
+}
+
+type DiagnoseCORSResponse struct {
+	OK           bool     `json:"ok"`
+	URL          string   `json:"url"`
+	Origin       string   `json:"origin"`
+	Method       string   `json:"method"`
+	StatusCode   int      `json:"statusCode"`
+	AllowOrigin  string   `json:"allowOrigin,omitempty"`
+	AllowMethods string   `json:"allowMethods,omitempty"`
+	AllowHeaders string   `json:"allowHeaders,omitempty"`
+	ExposeHeader string   `json:"exposeHeaders,omitempty"`
+	Problems     []string `json:"problems"`
+}
+
+// DefaultRetention is the retention applied to new objects of an object-lock bucket
+type DefaultRetention struct {
+	Mode  string `json:"mode"`            // "GOVERNANCE" ou "COMPLIANCE"
+	Days  uint   `json:"days,omitempty"`  // Exclusif avec years
+	Years uint   `json:"years,omitempty"` // Exclusif avec days
+}
+
+type BucketObjectLockRequest struct {
+	KeyId            string            `json:"keyId"`
+	Token            string            `json:"token"`
+	Bucket           string            `json:"bucket"`
+	DefaultRetention *DefaultRetention `json:"defaultRetention,omitempty"` // nil = supprimer la rétention par défaut
+}
+
+type BucketObjectLockResponse struct {
+	Enabled          bool              `json:"enabled"`
+	DefaultRetention *DefaultRetention `json:"defaultRetention,omitempty"`
+}
+
+type ObjectRetentionRequest struct {
+	KeyId            string `json:"keyId"`
+	Token            string `json:"token"`
+	Bucket           string `json:"bucket"`
+	Key              string `json:"key"`
+	VersionID        string `json:"versionId,omitempty"`
+	Mode             string `json:"mode,omitempty"`            // "GOVERNANCE" ou "COMPLIANCE" (set-object-retention)
+	RetainUntilDate  string `json:"retainUntilDate,omitempty"` // RFC3339
+	BypassGovernance bool   `json:"bypassGovernance,omitempty"`
+}
+
+type ObjectRetentionResponse struct {
+	Mode            string `json:"mode,omitempty"`
+	RetainUntilDate string `json:"retainUntilDate,omitempty"`
+}
+
+type ObjectLegalHoldRequest struct {
+	KeyId     string `json:"keyId"`
+	Token     string `json:"token"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"versionId,omitempty"`
+	Status    string `json:"status,omitempty"` // "ON" ou "OFF" (set-object-legal-hold)
+}
+
+type ObjectLegalHoldResponse struct {
+	Status string `json:"status"`
+}
+
+type ArchivePrefixRequest struct {
+	KeyId        string `json:"keyId"`
+	Token        string `json:"token"`
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix,omitempty"`
+	Format       string `json:"format,omitempty"`       // "zip" (défaut) ou "tar.gz"
+	MaxTotalSize int64  `json:"maxTotalSize,omitempty"` // Octets, plafonné par ArchiveMaxTotalSize
+	Concurrency  int    `json:"concurrency,omitempty"`  // Objets ouverts à l'avance, plafonné par archiveMaxConcurrency
+	SSEOptions
+}
+
+type ExtractArchiveEntry struct {
+	Name        string `json:"name"` // Chemin dans l'archive
+	Key         string `json:"key,omitempty"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+	Status      string `json:"status"` // "extracted", "skipped" ou "failed"
+	Reason      string `json:"reason,omitempty"`
+}
+
+type ExtractArchiveResponse struct {
+	Format    string                `json:"format"`
+	Entries   []ExtractArchiveEntry `json:"entries"`
+	Extracted int                   `json:"extracted"`
+	Skipped   int                   `json:"skipped"`
+	Failed    int                   `json:"failed"`
+	TotalSize int64                 `json:"totalSize"`
+	Error     string                `json:"error,omitempty"` // Extraction interrompue (archive invalide ou limites dépassées)
+}
+
+type SearchObjectsRequest struct {
+	KeyId             string `json:"keyId"`
+	Token             string `json:"token"`
+	Bucket            string `json:"bucket"`
+	Prefix            string `json:"prefix,omitempty"`
+	Pattern           string `json:"pattern,omitempty"`
+	PatternType       string `json:"patternType,omitempty"` // "glob" (défaut) ou "regex"
+	CaseInsensitive   bool   `json:"caseInsensitive,omitempty"`
+	MinSize           int64  `json:"minSize,omitempty"`
+	MaxSize           int64  `json:"maxSize,omitempty"`
+	ModifiedAfter     string `json:"modifiedAfter,omitempty"`  // RFC3339
+	ModifiedBefore    string `json:"modifiedBefore,omitempty"` // RFC3339
+	ContentType       string `json:"contentType,omitempty"`    // Type exact ("application/pdf") ou préfixe ("image/")
+	Stream            bool   `json:"stream,omitempty"`         // NDJSON, aussi activé par Accept: application/x-ndjson
+	Limit             int    `json:"limit,omitempty"`          // Taille de page (mode paginé)
+	ContinuationToken string `json:"continuationToken,omitempty"`
+}
+
+type SearchObjectsResponse struct {
+	Objects           []S3Object `json:"objects"`
+	Scanned           int        `json:"scanned"`
+	ContinuationToken string     `json:"continuationToken,omitempty"`
+	IsTruncated       bool       `json:"isTruncated"`
+}
+
+// SearchObjectsSummary is the last NDJSON line of a streamed search
+type SearchObjectsSummary struct {
+	Done    bool   `json:"done"`
+	Scanned int    `json:"scanned"`
+	Matched int    `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+type GetTextObjectRequest struct {
+	KeyId  string `json:"keyId"`
+	Token  string `json:"token"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	SSEOptions
+}
+
+type TextObjectResponse struct {
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	Content      string `json:"content"`
+	ETag         string `json:"etag"`
+	ContentType  string `json:"contentType"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"lastModified"`
+}
+
+type PutTextObjectRequest struct {
+	KeyId       string `json:"keyId"`
+	Token       string `json:"token"`
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	Content     string `json:"content"`
+	ContentType string `json:"contentType,omitempty"` // Déduit de l'extension par défaut
+	IfMatch     string `json:"ifMatch,omitempty"`     // ETag lu par get-text-object ; aussi en-tête If-Match
+	IfNoneMatch string `json:"ifNoneMatch,omitempty"` // "*" pour une création seule ; aussi en-tête If-None-Match
+	SSEOptions
+}
+
+type PutTextObjectResponse struct {
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	ETag      string `json:"etag"`
+	Size      int64  `json:"size"`
+	VersionID string `json:"versionId,omitempty"`
+}
+
+// WriteConflictResponse is the 409 body of a write whose precondition failed
+type WriteConflictResponse struct {
+	Error       string `json:"error"`
+	Code        string `json:"code"` // "object_exists", "object_missing", "etag_mismatch" ou "concurrent_modification"
+	Bucket      string `json:"bucket,omitempty"`
+	Key         string `json:"key,omitempty"`
+	Exists      bool   `json:"exists"`
+	CurrentETag string `json:"currentEtag,omitempty"`
+}
+
+// ChecksumErrorResponse is the body of a put-object rejected for an invalid or mismatching checksum
+type ChecksumErrorResponse struct {
+	Error   string `json:"error"`
+	Details string `json:"details"`
+	Bucket  string `json:"bucket,omitempty"`
+	Key     string `json:"key,omitempty"`
+}
+
+// VerifyObjectRequest re-hashes an object against the checksums stored at upload
+type VerifyObjectRequest struct {
+	KeyId     string `json:"keyId"`
+	Token     string `json:"token"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"versionId,omitempty"`
+	SSEOptions
+}
+
+type ObjectChecksum struct {
+	Algorithm string `json:"algorithm"` // "md5", "sha256" ou "crc32c"
+	Expected  string `json:"expected"`  // Valeur enregistrée à l'upload (hex)
+	Actual    string `json:"actual"`
+	Match     bool   `json:"match"`
+}
+
+type VerifyObjectResponse struct {
+	Bucket    string           `json:"bucket"`
+	Key       string           `json:"key"`
+	VersionID string           `json:"versionId,omitempty"`
+	Size      int64            `json:"size"`
+	Valid     bool             `json:"valid"`
+	Checksums []ObjectChecksum `json:"checksums"`
+}
+
+type ListIncompleteUploadsRequest struct {
+	KeyId          string `json:"keyId"`
+	Token          string `json:"token"`
+	Bucket         string `json:"bucket"`
+	Prefix         string `json:"prefix,omitempty"`
+	OlderThanHours int    `json:"olderThanHours,omitempty"` // Seulement les uploads démarrés avant
+	Limit          int    `json:"limit,omitempty"`
+}
+
+// IncompleteUpload is a multipart upload never completed nor aborted
+type IncompleteUpload struct {
+	Key          string `json:"key"`
+	UploadID     string `json:"uploadId"`
+	Initiated    string `json:"initiated"`
+	Size         int64  `json:"size"` // Taille des parts déjà stockées
+	Parts        int    `json:"parts"`
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+type ListIncompleteUploadsResponse struct {
+	Uploads     []IncompleteUpload `json:"uploads"`
+	TotalSize   int64              `json:"totalSize"`
+	IsTruncated bool               `json:"isTruncated"`
+}
+
+type IncompleteUploadRef struct {
+	Key      string `json:"key"`
+	UploadID string `json:"uploadId"`
+}
+
+// AbortIncompleteUploadsRequest aborts the listed uploads, or all those older than OlderThanHours
+type AbortIncompleteUploadsRequest struct {
+	KeyId          string                `json:"keyId"`
+	Token          string                `json:"token"`
+	Bucket         string                `json:"bucket"`
+	Uploads        []IncompleteUploadRef `json:"uploads,omitempty"`
+	Prefix         string                `json:"prefix,omitempty"`
+	OlderThanHours int                   `json:"olderThanHours,omitempty"`
+}
+
+type AbortIncompleteUploadFailure struct {
+	Key      string `json:"key"`
+	UploadID string `json:"uploadId"`
+	Error    string `json:"error"`
+}
+
+type AbortIncompleteUploadsResponse struct {
+	Aborted int                            `json:"aborted"`
+	Failed  []AbortIncompleteUploadFailure `json:"failed"`
 }
 
 type CreateBucketRequest struct {
-	KeyId    string `json:"keyId"`
-	Token    string `json:"token"`
-	Bucket   string `json:"bucket"`
-	ConfigID uint   `json:"configId"`
+	KeyId            string            `json:"keyId"`
+	Token            string            `json:"token"`
+	Bucket           string            `json:"bucket"`
+	ObjectLocking    bool              `json:"objectLocking,omitempty"`    // Active l'object lock (et le versioning) à la création
+	DefaultRetention *DefaultRetention `json:"defaultRetention,omitempty"` // Nécessite objectLocking
+	ConfigID         uint              `json:"configId"`
 }
 
 type CreateBucketResponse struct {
@@ -119,14 +694,70 @@ type CreateBucketResponse struct {
 }
 
 type DeleteBucketRequest struct {
-	KeyId    string `json:"keyId"`
-	Token    string `json:"token"`
-	Bucket   string `json:"bucket"`
-	ConfigID uint   `json:"configId"`
+	KeyId            string `json:"keyId"`
+	Token            string `json:"token"`
+	Bucket           string `json:"bucket"`
+	ConfirmBucket    string `json:"confirmBucket"`   // Nom du bucket retapé par l'utilisateur
+	Force            bool   `json:"force,omitempty"` // Vider le bucket (versions et uploads compris) dans un job
+	ConfigID         uint   `json:"configId"`
+	BypassGovernance bool   `json:"bypassGovernance,omitempty"` // Avec force : supprimer aussi les objets sous rétention GOVERNANCE
 }
 
 type DeleteBucketResponse struct {
-	Success bool `json:"success"`
+	Success bool        `json:"success"`
+	Job     interface{} `json:"job,omitempty"` // Job de suppression forcée (202)
+}
+
+// ObjectChange describes an object written or deleted through kexamanager
+type ObjectChange struct {
+	Bucket       string
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	Deleted      bool
+}
+
+// notifyObjectChanged reports a write to ObjectChangedFunc, if set
+func notifyObjectChanged(config S3ConfigData, change ObjectChange) {
+	if ObjectChangedFunc == nil {
+		return
+	}
+	if change.LastModified.IsZero() && !change.Deleted {
+		change.LastModified = time.Now()
+	}
+	ObjectChangedFunc(config.ID, change)
+}
+
+// notifyObjectWritten reports an upload to ObjectChangedFunc. PutObject leaves LastModified
+// empty, so the new object is stat'ed to index the date S3 recorded rather than the proxy clock.
+func notifyObjectWritten(ctx context.Context, client *minio.Client, config S3ConfigData, readSSE ReadEncryption, bucket, key string, info minio.UploadInfo) {
+	if ObjectChangedFunc == nil {
+		return
+	}
+	change := ObjectChange{Bucket: bucket, Key: key, Size: info.Size, ETag: info.ETag, LastModified: info.LastModified}
+	if change.LastModified.IsZero() {
+		if stat, _, err := readSSE.Stat(ctx, client, bucket, key, ""); err == nil {
+			change.LastModified = stat.LastModified
+		}
+	}
+	notifyObjectChanged(config, change)
+}
+
+// refreshObjectChanged re-reads the current version of a key after a version-level change
+// (a deleted version may have been the current one) and reports it
+func refreshObjectChanged(ctx context.Context, client *minio.Client, config S3ConfigData, bucket, key string) {
+	if ObjectChangedFunc == nil {
+		return
+	}
+	info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			notifyObjectChanged(config, ObjectChange{Bucket: bucket, Key: key, Deleted: true})
+		}
+		return
+	}
+	notifyObjectChanged(config, ObjectChange{Bucket: bucket, Key: key, Size: info.Size, ETag: info.ETag, LastModified: info.LastModified})
 }
 
 // getS3Credentials creates S3 credentials from the config, with optional override from request
@@ -190,3 +821,20 @@ func CreateS3Client(creds S3Credentials) (*minio.Client, error) {
 
 	return client, nil
 }
+
+// clientForRequest builds an S3 client for a handler, writing the HTTP error on failure
+func clientForRequest(w http.ResponseWriter, config S3ConfigData, keyId, token string) (*minio.Client, bool) {
+	creds, err := GetS3Credentials(config, keyId, token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	client, err := CreateS3Client(creds)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return client, true
+}
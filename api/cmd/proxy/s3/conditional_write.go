@@ -0,0 +1,204 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// WritePrecondition holds the If-Match / If-None-Match conditions of an object write
+type WritePrecondition struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// Codes of WriteConflictError, stable for the frontend
+const (
+	ConflictObjectExists  = "object_exists"
+	ConflictObjectMissing = "object_missing"
+	ConflictETagMismatch  = "etag_mismatch"
+	ConflictConcurrent    = "concurrent_modification"
+)
+
+// WriteConflictError reports a write refused because the object changed (or exists)
+type WriteConflictError struct {
+	Code        string
+	Reason      string
+	Bucket      string
+	Key         string
+	Exists      bool
+	CurrentETag string
+}
+
+func (e *WriteConflictError) Error() string { return e.Reason }
+
+// normalizeETag strips quotes and the weak prefix so ETags from headers, JSON and S3 compare equal
+func normalizeETag(etag string) string {
+	etag = strings.TrimSpace(etag)
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
+
+// preconditionFromRequest takes the body fields, falling back to the HTTP headers
+func preconditionFromRequest(r *http.Request, ifMatch, ifNoneMatch string) WritePrecondition {
+	if ifMatch == "" {
+		ifMatch = r.Header.Get("If-Match")
+	}
+	if ifNoneMatch == "" {
+		ifNoneMatch = r.Header.Get("If-None-Match")
+	}
+	return WritePrecondition{IfMatch: strings.TrimSpace(ifMatch), IfNoneMatch: strings.TrimSpace(ifNoneMatch)}
+}
+
+// ResolveWritePrecondition applies overwrite=false and the project "never overwrite" policy.
+// The policy wins over any If-Match: the key must not exist.
+func ResolveWritePrecondition(config S3ConfigData, p WritePrecondition, overwrite *bool) WritePrecondition {
+	if config.NeverOverwrite {
+		return WritePrecondition{IfNoneMatch: "*"}
+	}
+	if overwrite != nil && !*overwrite {
+		p.IfNoneMatch = "*"
+	}
+	return p
+}
+
+// IsZero reports whether the write is unconditional
+func (p WritePrecondition) IsZero() bool {
+	return p.IfMatch == "" && p.IfNoneMatch == ""
+}
+
+// evaluate compares the precondition with the current state of the key
+func (p WritePrecondition) evaluate(exists bool, currentETag string) *WriteConflictError {
+	conflict := &WriteConflictError{Exists: exists, CurrentETag: currentETag}
+	switch {
+	case p.IfMatch == "*" && !exists:
+		conflict.Code, conflict.Reason = ConflictObjectMissing, "Object does not exist"
+	case p.IfMatch != "" && p.IfMatch != "*" && !exists:
+		conflict.Code, conflict.Reason = ConflictObjectMissing, "Object was deleted since it was read"
+	case p.IfMatch != "" && p.IfMatch != "*" && normalizeETag(p.IfMatch) != currentETag:
+		conflict.Code, conflict.Reason = ConflictETagMismatch, "Object was modified since it was read"
+	case p.IfNoneMatch == "*" && exists:
+		conflict.Code, conflict.Reason = ConflictObjectExists, "Object already exists"
+	case p.IfNoneMatch != "" && p.IfNoneMatch != "*" && exists && normalizeETag(p.IfNoneMatch) == currentETag:
+		conflict.Code, conflict.Reason = ConflictETagMismatch, "Object still has the excluded ETag"
+	default:
+		return nil
+	}
+	return conflict
+}
+
+// Check stats the key and returns a *WriteConflictError when the precondition does not hold.
+// It is the fallback for S3 backends that ignore conditional headers on PUT.
+func (p WritePrecondition) Check(ctx context.Context, client *minio.Client, bucket, key string, readSSE ReadEncryption) error {
+	if p.IsZero() {
+		return nil
+	}
+	exists, etag := true, ""
+	info, _, err := readSSE.Stat(ctx, client, bucket, key, "")
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+			return err
+		}
+		exists = false
+	} else {
+		etag = normalizeETag(info.ETag)
+	}
+	if conflict := p.evaluate(exists, etag); conflict != nil {
+		conflict.Bucket, conflict.Key = bucket, key
+		return conflict
+	}
+	return nil
+}
+
+// Apply forwards the precondition to S3 so the check is atomic on backends that support it
+func (p WritePrecondition) Apply(opts *minio.PutObjectOptions) {
+	if p.IfMatch != "" {
+		opts.SetMatchETag(normalizeETag(p.IfMatch))
+	}
+	if p.IfNoneMatch != "" {
+		opts.SetMatchETagExcept(normalizeETag(p.IfNoneMatch))
+	}
+}
+
+// Put checks the precondition, then writes with the conditional headers. Backends that reject
+// them (501) get a plain PUT: the StatObject check above is then the only protection.
+func (p WritePrecondition) Put(ctx context.Context, client *minio.Client, bucket, key string, body io.ReadSeeker, size int64, opts minio.PutObjectOptions, readSSE ReadEncryption) (minio.UploadInfo, error) {
+	if err := p.Check(ctx, client, bucket, key, readSSE); err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	conditional := opts
+	p.Apply(&conditional)
+	info, err := client.PutObject(ctx, bucket, key, body, size, conditional)
+	if err != nil && !p.IsZero() && minio.ToErrorResponse(err).StatusCode == http.StatusNotImplemented {
+		if _, seekErr := body.Seek(0, io.SeekStart); seekErr != nil {
+			return info, err
+		}
+		info, err = client.PutObject(ctx, bucket, key, body, size, opts)
+	}
+	if err != nil {
+		return info, p.conflictFromPutError(ctx, client, bucket, key, readSSE, err)
+	}
+	return info, nil
+}
+
+// CompleteMultipart completes a multipart upload under the precondition, like Put: the key is
+// checked first, then the conditional headers are sent with CompleteMultipartUpload.
+func (p WritePrecondition) CompleteMultipart(ctx context.Context, core minio.Core, bucket, key, uploadID string, parts []minio.CompletePart, opts minio.PutObjectOptions, readSSE ReadEncryption) (minio.UploadInfo, error) {
+	if err := p.Check(ctx, core.Client, bucket, key, readSSE); err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	conditional := opts
+	p.Apply(&conditional)
+	info, err := core.CompleteMultipartUpload(ctx, bucket, key, uploadID, parts, conditional)
+	if err != nil && !p.IsZero() && minio.ToErrorResponse(err).StatusCode == http.StatusNotImplemented {
+		info, err = core.CompleteMultipartUpload(ctx, bucket, key, uploadID, parts, opts)
+	}
+	if err != nil {
+		return info, p.conflictFromPutError(ctx, core.Client, bucket, key, readSSE, err)
+	}
+	return info, nil
+}
+
+// conflictFromPutError turns a 412 from S3 into a *WriteConflictError carrying the current ETag
+func (p WritePrecondition) conflictFromPutError(ctx context.Context, client *minio.Client, bucket, key string, readSSE ReadEncryption, err error) error {
+	if minio.ToErrorResponse(err).StatusCode != http.StatusPreconditionFailed {
+		return err
+	}
+	if checked := p.Check(ctx, client, bucket, key, readSSE); checked != nil {
+		return checked
+	}
+	// L'objet a encore changé entre le refus et la relecture
+	return &WriteConflictError{Code: ConflictConcurrent, Reason: "Object was modified concurrently", Bucket: bucket, Key: key}
+}
+
+// WriteConflict answers 409 with the current state of the object
+func WriteConflict(w http.ResponseWriter, conflict *WriteConflictError) {
+	w.Header().Set("Content-Type", "application/json")
+	if conflict.CurrentETag != "" {
+		w.Header().Set("ETag", `"`+conflict.CurrentETag+`"`)
+	}
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(WriteConflictResponse{
+		Error:       conflict.Reason,
+		Code:        conflict.Code,
+		Bucket:      conflict.Bucket,
+		Key:         conflict.Key,
+		Exists:      conflict.Exists,
+		CurrentETag: conflict.CurrentETag,
+	})
+}
+
+// writeConditionalPutError answers a failed conditional write: 409 for conflicts, 502 otherwise
+func writeConditionalPutError(w http.ResponseWriter, err error) {
+	if conflict, ok := err.(*WriteConflictError); ok {
+		WriteConflict(w, conflict)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to write object: %v", err), http.StatusBadGateway)
+}
@@ -0,0 +1,169 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestWritePreconditionEvaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		precond     WritePrecondition
+		exists      bool
+		currentETag string
+		wantCode    string // "" : écriture autorisée
+	}{
+		{"unconditional on missing key", WritePrecondition{}, false, "", ""},
+		{"unconditional on existing key", WritePrecondition{}, true, "abc", ""},
+
+		{"if-none-match * on missing key", WritePrecondition{IfNoneMatch: "*"}, false, "", ""},
+		{"if-none-match * on existing key", WritePrecondition{IfNoneMatch: "*"}, true, "abc", ConflictObjectExists},
+		{"if-none-match etag differs", WritePrecondition{IfNoneMatch: "old"}, true, "abc", ""},
+		{"if-none-match etag equal", WritePrecondition{IfNoneMatch: `"abc"`}, true, "abc", ConflictETagMismatch},
+		{"if-none-match etag on missing key", WritePrecondition{IfNoneMatch: "abc"}, false, "", ""},
+
+		{"if-match * on existing key", WritePrecondition{IfMatch: "*"}, true, "abc", ""},
+		{"if-match * on missing key", WritePrecondition{IfMatch: "*"}, false, "", ConflictObjectMissing},
+		{"if-match etag equal", WritePrecondition{IfMatch: "abc"}, true, "abc", ""},
+		{"if-match quoted etag", WritePrecondition{IfMatch: `"abc"`}, true, "abc", ""},
+		{"if-match weak etag", WritePrecondition{IfMatch: `W/"abc"`}, true, "abc", ""},
+		{"if-match etag differs", WritePrecondition{IfMatch: "old"}, true, "abc", ConflictETagMismatch},
+		{"if-match etag on deleted key", WritePrecondition{IfMatch: "abc"}, false, "", ConflictObjectMissing},
+
+		{"if-match checked before if-none-match", WritePrecondition{IfMatch: "old", IfNoneMatch: "*"}, true, "abc", ConflictETagMismatch},
+		{"both hold", WritePrecondition{IfMatch: "abc", IfNoneMatch: "old"}, true, "abc", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict := tt.precond.evaluate(tt.exists, tt.currentETag)
+			if tt.wantCode == "" {
+				if conflict != nil {
+					t.Fatalf("evaluate() = %q (%s), want no conflict", conflict.Code, conflict.Reason)
+				}
+				return
+			}
+			if conflict == nil {
+				t.Fatalf("evaluate() = nil, want %q", tt.wantCode)
+			}
+			if conflict.Code != tt.wantCode {
+				t.Errorf("evaluate().Code = %q, want %q", conflict.Code, tt.wantCode)
+			}
+			if conflict.Exists != tt.exists || conflict.CurrentETag != tt.currentETag {
+				t.Errorf("evaluate() reports exists=%v etag=%q, want exists=%v etag=%q", conflict.Exists, conflict.CurrentETag, tt.exists, tt.currentETag)
+			}
+		})
+	}
+}
+
+func TestResolveWritePrecondition(t *testing.T) {
+	no, yes := false, true
+	tests := []struct {
+		name      string
+		never     bool
+		precond   WritePrecondition
+		overwrite *bool
+		want      WritePrecondition
+	}{
+		{"unconditional", false, WritePrecondition{}, nil, WritePrecondition{}},
+		{"overwrite allowed", false, WritePrecondition{}, &yes, WritePrecondition{}},
+		{"overwrite=false", false, WritePrecondition{}, &no, WritePrecondition{IfNoneMatch: "*"}},
+		{"overwrite=false keeps if-match", false, WritePrecondition{IfMatch: "abc"}, &no, WritePrecondition{IfMatch: "abc", IfNoneMatch: "*"}},
+		{"client preconditions kept", false, WritePrecondition{IfMatch: "abc"}, nil, WritePrecondition{IfMatch: "abc"}},
+		{"never overwrite", true, WritePrecondition{}, nil, WritePrecondition{IfNoneMatch: "*"}},
+		{"never overwrite wins over overwrite=true", true, WritePrecondition{}, &yes, WritePrecondition{IfNoneMatch: "*"}},
+		{"never overwrite drops if-match", true, WritePrecondition{IfMatch: "abc", IfNoneMatch: "old"}, nil, WritePrecondition{IfNoneMatch: "*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResolveWritePrecondition(S3ConfigData{NeverOverwrite: tt.never}, tt.precond, tt.overwrite)
+			if got != tt.want {
+				t.Errorf("ResolveWritePrecondition() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePreconditionPut(t *testing.T) {
+	const existingETag = "49f68a5c8493ec2c0bf489821c21fc3b" // md5("hi")
+	tests := []struct {
+		name              string
+		never             bool
+		precond           WritePrecondition
+		rejectConditional bool
+		staleHeads        int
+		key               string // "existing" ou "missing"
+		wantCode          string // "" : écrit
+	}{
+		{"create on missing key", false, WritePrecondition{IfNoneMatch: "*"}, false, 0, "missing", ""},
+		{"create on existing key", false, WritePrecondition{IfNoneMatch: "*"}, false, 0, "existing", ConflictObjectExists},
+		{"never overwrite ignores if-match", true, WritePrecondition{IfMatch: existingETag}, false, 0, "existing", ConflictObjectExists},
+		{"never overwrite on missing key", true, WritePrecondition{}, false, 0, "missing", ""},
+		{"if-match current etag", false, WritePrecondition{IfMatch: `"` + existingETag + `"`}, false, 0, "existing", ""},
+		{"if-match stale etag", false, WritePrecondition{IfMatch: "stale"}, false, 0, "existing", ConflictETagMismatch},
+		{"if-match on deleted key", false, WritePrecondition{IfMatch: existingETag}, false, 0, "missing", ConflictObjectMissing},
+		{"backend without conditional headers", false, WritePrecondition{IfNoneMatch: "*"}, true, 0, "missing", ""},
+		{"backend without conditional headers on existing key", false, WritePrecondition{IfNoneMatch: "*"}, true, 0, "existing", ConflictObjectExists},
+		// Le HEAD ne voit pas la clé, créée juste avant le PUT : S3 répond 412
+		{"key created between check and write", false, WritePrecondition{IfNoneMatch: "*"}, false, 1, "existing", ConflictObjectExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client := newFakeS3(t)
+			fake.seed("bkt", "existing", []byte("hi"), nil)
+			fake.rejectConditional = tt.rejectConditional
+			fake.staleHeads = tt.staleHeads
+
+			precond := ResolveWritePrecondition(S3ConfigData{NeverOverwrite: tt.never}, tt.precond, nil)
+			_, err := precond.Put(context.Background(), client, "bkt", tt.key, bytes.NewReader([]byte("new")), 3, minio.PutObjectOptions{}, ReadEncryption{})
+
+			object, _ := fake.get("bkt", tt.key)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+				if string(object.data) != "new" {
+					t.Errorf("stored %q, want the new content", object.data)
+				}
+				return
+			}
+			conflict, ok := err.(*WriteConflictError)
+			if !ok {
+				t.Fatalf("Put() error = %v (%T), want a *WriteConflictError", err, err)
+			}
+			if conflict.Code != tt.wantCode || conflict.Bucket != "bkt" || conflict.Key != tt.key {
+				t.Errorf("conflict = %+v, want code %q on bkt/%s", conflict, tt.wantCode, tt.key)
+			}
+			if tt.key == "existing" {
+				if conflict.CurrentETag != existingETag {
+					t.Errorf("conflict.CurrentETag = %q, want %q", conflict.CurrentETag, existingETag)
+				}
+				if string(object.data) != "hi" {
+					t.Errorf("existing object was overwritten with %q", object.data)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteConflictResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteConflict(rec, &WriteConflictError{Code: ConflictObjectExists, Reason: "Object already exists", Bucket: "bkt", Key: "k", Exists: true, CurrentETag: "abc"})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rec.Body.String(), err)
+	}
+	for field, want := range map[string]interface{}{"code": ConflictObjectExists, "bucket": "bkt", "key": "k", "currentEtag": "abc"} {
+		if body[field] != want {
+			t.Errorf("%s = %v, want %v", field, body[field], want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	DefaultCopyConcurrency = 4
+	MaxCopyConcurrency     = 32
+
+	// copySourceETagMetadata records the source ETag on the copy: multipart and SSE-C ETags
+	// are not reproducible, so a second run compares against it instead of the copy's ETag
+	copySourceETagMetadata = "kexa-source-etag"
+	copyProgressInterval   = 5 * time.Second
+	// Taille de part du flux source → destination, doublée pour rester sous 10000 parts
+	copyPartSize = 16 << 20
+)
+
+// CopyObjectsOptions describes what CopyObjects copies and where
+type CopyObjectsOptions struct {
+	SourceBucket string
+	SourcePrefix string
+	DestBucket   string
+	DestPrefix   string // Remplace SourcePrefix dans les clés copiées
+	StartAfter   string // Reprise : clés déjà traitées jusqu'à celle-ci incluse
+	Concurrency  int
+	Overwrite    bool // Remplacer les objets différents déjà présents (jamais si la destination l'interdit)
+}
+
+// CopyObjectsProgress counts what a CopyObjects run has done so far. Checkpoint is the last
+// key such that every key up to it has been handled, and can be passed back as StartAfter.
+type CopyObjectsProgress struct {
+	ObjectsCopied  int64
+	ObjectsSkipped int64
+	BytesCopied    int64
+	Conflicts      int64
+	Failed         int64
+	LastError      string
+	Checkpoint     string
+}
+
+// copyCheckpoint tracks the keys in flight so the checkpoint never passes a key whose copy is
+// still running: keys are handed out in listing order but finish in any order
+type copyCheckpoint struct {
+	keys []string
+	done map[string]bool
+	last string
+}
+
+func (c *copyCheckpoint) start(key string) {
+	c.keys = append(c.keys, key)
+}
+
+func (c *copyCheckpoint) finish(key string) {
+	c.done[key] = true
+	for len(c.keys) > 0 && c.done[c.keys[0]] {
+		c.last = c.keys[0]
+		delete(c.done, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+}
+
+// copyTarget is everything a worker needs about one side of the copy
+type copyTarget struct {
+	client  *minio.Client
+	config  S3ConfigData
+	readSSE ReadEncryption
+}
+
+// CopyObjects streams every object under SourcePrefix from src to dst with bounded parallelism.
+// Objects already present with the same size and ETag (or copied earlier from that ETag) are
+// skipped; content headers, user metadata and tags are preserved and the destination project's
+// default encryption applies. Per-object failures are counted and do not stop the run; the
+// returned error is for listing failures and cancellation. progress is called every few seconds.
+func CopyObjects(ctx context.Context, srcClient *minio.Client, srcConfig S3ConfigData, dstClient *minio.Client, dstConfig S3ConfigData, opts CopyObjectsOptions, progress func(CopyObjectsProgress)) (CopyObjectsProgress, error) {
+	done := CopyObjectsProgress{Checkpoint: opts.StartAfter}
+
+	srcRead, err := ResolveReadEncryption(srcConfig, SSEOptions{})
+	if err != nil {
+		return done, fmt.Errorf("source encryption: %v", err)
+	}
+	dstRead, err := ResolveReadEncryption(dstConfig, SSEOptions{})
+	if err != nil {
+		return done, fmt.Errorf("destination encryption: %v", err)
+	}
+	dstWrite, err := WriteEncryption(dstConfig, SSEOptions{})
+	if err != nil {
+		return done, fmt.Errorf("destination encryption: %v", err)
+	}
+	overwrite := opts.Overwrite
+	precondition := ResolveWritePrecondition(dstConfig, WritePrecondition{}, &overwrite)
+
+	src := copyTarget{client: srcClient, config: srcConfig, readSSE: srcRead}
+	dst := copyTarget{client: dstClient, config: dstConfig, readSSE: dstRead}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCopyConcurrency
+	}
+	if concurrency > MaxCopyConcurrency {
+		concurrency = MaxCopyConcurrency
+	}
+
+	var mu sync.Mutex
+	checkpoint := &copyCheckpoint{done: map[string]bool{}, last: opts.StartAfter}
+	lastReport := time.Now()
+	report := func() {
+		done.Checkpoint = checkpoint.last
+		if progress != nil {
+			progress(done)
+		}
+		lastReport = time.Now()
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var listErr error
+	for object := range srcClient.ListObjects(ctx, opts.SourceBucket, minio.ListObjectsOptions{Prefix: opts.SourcePrefix, Recursive: true, StartAfter: opts.StartAfter}) {
+		if object.Err != nil {
+			listErr = object.Err
+			break
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		mu.Lock()
+		checkpoint.start(object.Key)
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(object minio.ObjectInfo) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Les objets de la corbeille ne font pas partie du contenu à migrer
+			var copied int64
+			skipped, err := false, error(nil)
+			if isTrashKey(object.Key) {
+				skipped = true
+			} else {
+				destKey := opts.DestPrefix + strings.TrimPrefix(object.Key, opts.SourcePrefix)
+				copied, skipped, err = copyObjectBetween(ctx, src, opts.SourceBucket, object, dst, opts.DestBucket, destKey, dstWrite, precondition)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			// Interrompu : la clé sera reprise depuis le checkpoint
+			if err != nil && ctx.Err() != nil {
+				return
+			}
+			switch {
+			case err != nil:
+				if _, ok := err.(*WriteConflictError); ok {
+					done.Conflicts++
+				} else {
+					done.Failed++
+				}
+				done.LastError = fmt.Sprintf("%s: %v", object.Key, err)
+			case skipped:
+				done.ObjectsSkipped++
+			default:
+				done.ObjectsCopied++
+				done.BytesCopied += copied
+			}
+			checkpoint.finish(object.Key)
+			if time.Since(lastReport) >= copyProgressInterval {
+				report()
+			}
+		}(object)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	report()
+	mu.Unlock()
+
+	if listErr != nil {
+		return done, fmt.Errorf("failed to list objects: %v", listErr)
+	}
+	return done, ctx.Err()
+}
+
+// copyObjectBetween copies one object unless the destination already holds the same content.
+// It returns the bytes copied and whether the object was skipped.
+func copyObjectBetween(ctx context.Context, src copyTarget, srcBucket string, object minio.ObjectInfo, dst copyTarget, dstBucket, dstKey string, dstWrite encrypt.ServerSide, precondition WritePrecondition) (int64, bool, error) {
+	existing, _, err := dst.readSSE.Stat(ctx, dst.client, dstBucket, dstKey, "")
+	exists := err == nil
+	if err != nil && minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+		return 0, false, fmt.Errorf("failed to stat destination: %v", err)
+	}
+	sourceETag := normalizeETag(object.ETag)
+	if exists && existing.Size == object.Size {
+		if normalizeETag(existing.ETag) == sourceETag || existing.UserMetadata[http.CanonicalHeaderKey(copySourceETagMetadata)] == sourceETag {
+			return 0, true, nil
+		}
+	}
+	if exists && precondition.IfNoneMatch == "*" {
+		return 0, false, &WriteConflictError{Code: ConflictObjectExists, Reason: "Object already exists", Bucket: dstBucket, Key: dstKey, Exists: true, CurrentETag: normalizeETag(existing.ETag)}
+	}
+
+	info, sse, err := src.readSSE.Stat(ctx, src.client, srcBucket, object.Key, "")
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to stat source: %v", err)
+	}
+
+	getOpts := minio.GetObjectOptions{ServerSideEncryption: sse}
+	// Relire exactement la version dont on a lu les métadonnées
+	getOpts.SetMatchETag(info.ETag)
+	reader, err := src.client.GetObject(ctx, srcBucket, object.Key, getOpts)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read source: %v", err)
+	}
+	defer reader.Close()
+
+	putOpts := copyPutOptions(ctx, src.client, srcBucket, info)
+	putOpts.ServerSideEncryption = dstWrite
+	// Un seul tampon de part par objet : la mémoire reste bornée par la concurrence de la copie
+	putOpts.NumThreads = 1
+	putOpts.PartSize = streamPartSize(info.Size)
+
+	uploaded, err := precondition.Put(ctx, dst.client, dstBucket, dstKey, reader, info.Size, putOpts, dst.readSSE)
+	if err != nil {
+		return 0, false, err
+	}
+	notifyObjectWritten(ctx, dst.client, dst.config, dst.readSSE, dstBucket, dstKey, uploaded)
+	return uploaded.Size, false, nil
+}
+
+// streamPartSize returns the multipart part size used to stream an object of the given size
+func streamPartSize(size int64) uint64 {
+	partSize := int64(copyPartSize)
+	for size > partSize*10000 {
+		partSize *= 2
+	}
+	return uint64(partSize)
+}
+
+// copyPutOptions carries the content headers, user metadata and tags of the source object
+func copyPutOptions(ctx context.Context, client *minio.Client, bucket string, info minio.ObjectInfo) minio.PutObjectOptions {
+	metadata := ToObjectMetadata(info)
+	userMetadata := make(map[string]string, len(metadata.UserMetadata)+1)
+	for k, v := range metadata.UserMetadata {
+		userMetadata[k] = v
+	}
+	userMetadata[copySourceETagMetadata] = normalizeETag(info.ETag)
+
+	opts := minio.PutObjectOptions{
+		ContentType:        metadata.ContentType,
+		CacheControl:       metadata.CacheControl,
+		ContentDisposition: metadata.ContentDisposition,
+		ContentEncoding:    metadata.ContentEncoding,
+		ContentLanguage:    metadata.ContentLanguage,
+		UserMetadata:       userMetadata,
+	}
+	// Garage ne gère pas les tags : ne les demander que si l'objet en a
+	if info.UserTagCount > 0 {
+		if t, err := client.GetObjectTagging(ctx, bucket, info.Key, minio.GetObjectTaggingOptions{}); err == nil {
+			opts.UserTags = t.ToMap()
+		}
+	}
+	return opts
+}
@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCopyCheckpoint(t *testing.T) {
+	type step struct {
+		start, finish string // une seule des deux par étape
+		want          string // checkpoint après l'étape
+	}
+	tests := []struct {
+		name       string
+		startAfter string
+		steps      []step
+	}{
+		{"in order", "", []step{
+			{start: "a", want: ""},
+			{start: "b", want: ""},
+			{finish: "a", want: "a"},
+			{finish: "b", want: "b"},
+		}},
+		{"out of order waits for the oldest key", "", []step{
+			{start: "a", want: ""},
+			{start: "b", want: ""},
+			{start: "c", want: ""},
+			{finish: "c", want: ""},
+			{finish: "b", want: ""},
+			{finish: "a", want: "c"},
+		}},
+		{"gap in the middle", "", []step{
+			{start: "a", want: ""},
+			{start: "b", want: ""},
+			{start: "c", want: ""},
+			{finish: "a", want: "a"},
+			{finish: "c", want: "a"},
+			{finish: "b", want: "c"},
+		}},
+		{"resume keeps the previous checkpoint", "m", []step{
+			{start: "n", want: "m"},
+			{start: "o", want: "m"},
+			{finish: "o", want: "m"},
+			{finish: "n", want: "o"},
+		}},
+		{"keys started after a finish", "", []step{
+			{start: "a", want: ""},
+			{finish: "a", want: "a"},
+			{start: "b", want: "a"},
+			{start: "c", want: "a"},
+			{finish: "c", want: "a"},
+			{finish: "b", want: "c"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &copyCheckpoint{done: map[string]bool{}, last: tt.startAfter}
+			for i, s := range tt.steps {
+				if s.start != "" {
+					c.start(s.start)
+				} else {
+					c.finish(s.finish)
+				}
+				if c.last != s.want {
+					t.Fatalf("step %d: checkpoint = %q, want %q", i+1, c.last, s.want)
+				}
+			}
+			if len(c.keys) != 0 || len(c.done) != 0 {
+				t.Errorf("checkpoint still tracks keys %v / %v after every key finished", c.keys, c.done)
+			}
+		})
+	}
+}
+
+func TestCopyObjects(t *testing.T) {
+	src, srcClient := newFakeS3(t)
+	dst, dstClient := newFakeS3(t)
+	for _, key := range []string{"data/a.txt", "data/b.txt", "data/sub/c.txt", "other/d.txt"} {
+		src.seed("src", key, []byte("content of "+key), http.Header{"Content-Type": {"text/plain"}, "X-Amz-Meta-Owner": {"alice"}})
+	}
+	run := func(opts CopyObjectsOptions, dstConfig S3ConfigData) CopyObjectsProgress {
+		t.Helper()
+		opts.SourceBucket, opts.SourcePrefix, opts.DestBucket, opts.DestPrefix = "src", "data/", "dst", "copy/"
+		done, err := CopyObjects(context.Background(), srcClient, S3ConfigData{}, dstClient, dstConfig, opts, nil)
+		if err != nil {
+			t.Fatalf("CopyObjects() error = %v", err)
+		}
+		return done
+	}
+
+	done := run(CopyObjectsOptions{}, S3ConfigData{})
+	if done.ObjectsCopied != 3 || done.ObjectsSkipped != 0 || done.Failed != 0 || done.Checkpoint != "data/sub/c.txt" {
+		t.Fatalf("first run = %+v, want 3 copied up to data/sub/c.txt", done)
+	}
+	object, ok := dst.get("dst", "copy/sub/c.txt")
+	if !ok || string(object.data) != "content of data/sub/c.txt" {
+		t.Fatalf("copy/sub/c.txt = %q, %v", object.data, ok)
+	}
+	if object.header.Get("Content-Type") != "text/plain" || object.header.Get("X-Amz-Meta-Owner") != "alice" {
+		t.Errorf("copy lost its headers: %v", object.header)
+	}
+	if _, ok := dst.get("dst", "copy/d.txt"); ok {
+		t.Error("an object outside the source prefix was copied")
+	}
+
+	// Deuxième passage : tout est déjà là, rien n'est réécrit
+	before := len(dst.written())
+	done = run(CopyObjectsOptions{}, S3ConfigData{})
+	if done.ObjectsCopied != 0 || done.ObjectsSkipped != 3 || len(dst.written()) != before {
+		t.Errorf("second run = %+v with %d writes, want 3 skipped and no write", done, len(dst.written())-before)
+	}
+
+	// Reprise après le checkpoint : seules les clés suivantes sont traitées
+	done = run(CopyObjectsOptions{StartAfter: "data/a.txt"}, S3ConfigData{})
+	if done.ObjectsSkipped != 2 || done.Checkpoint != "data/sub/c.txt" {
+		t.Errorf("resumed run = %+v, want the 2 keys after data/a.txt", done)
+	}
+}
+
+func TestCopyObjectsExistingDestination(t *testing.T) {
+	tests := []struct {
+		name          string
+		overwrite     bool
+		never         bool
+		wantConflicts int64
+		wantContent   string
+	}{
+		{"overwrite", true, false, 0, "new"},
+		{"no overwrite", false, false, 1, "old"},
+		{"never overwrite destination", true, true, 1, "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, srcClient := newFakeS3(t)
+			dst, dstClient := newFakeS3(t)
+			src.seed("src", "k.txt", []byte("new"), nil)
+			dst.seed("dst", "k.txt", []byte("old"), nil)
+
+			opts := CopyObjectsOptions{SourceBucket: "src", DestBucket: "dst", Overwrite: tt.overwrite}
+			done, err := CopyObjects(context.Background(), srcClient, S3ConfigData{}, dstClient, S3ConfigData{NeverOverwrite: tt.never}, opts, nil)
+			if err != nil {
+				t.Fatalf("CopyObjects() error = %v", err)
+			}
+			if done.Conflicts != tt.wantConflicts {
+				t.Errorf("conflicts = %d, want %d (%+v)", done.Conflicts, tt.wantConflicts, done)
+			}
+			if tt.wantConflicts > 0 && !strings.Contains(done.LastError, "k.txt") {
+				t.Errorf("LastError = %q, want it to name the key", done.LastError)
+			}
+			// Un conflit est traité : le checkpoint avance quand même
+			if done.Checkpoint != "k.txt" {
+				t.Errorf("checkpoint = %q, want k.txt", done.Checkpoint)
+			}
+			if object, _ := dst.get("dst", "k.txt"); string(object.data) != tt.wantContent {
+				t.Errorf("destination holds %q, want %q", object.data, tt.wantContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/cors"
+)
+
+const (
+	maxCORSRules         = 100
+	corsDiagnoseTimeout  = 10 * time.Second
+	corsOriginRulePrefix = "kexamanager-"
+	corsOriginMaxAge     = 3600
+)
+
+var corsAllowedMethods = map[string]bool{"GET": true, "PUT": true, "POST": true, "DELETE": true, "HEAD": true}
+
+// corsDiagnoseClient sends preflights to the S3 endpoint; redirects are reported, not followed
+var corsDiagnoseClient = &http.Client{
+	Timeout: corsDiagnoseTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func toMinioCORS(rules []CORSRule) *cors.Config {
+	converted := make([]cors.Rule, 0, len(rules))
+	for _, rule := range rules {
+		methods := make([]string, len(rule.AllowedMethods))
+		for i, m := range rule.AllowedMethods {
+			methods[i] = strings.ToUpper(m)
+		}
+		converted = append(converted, cors.Rule{
+			ID:            rule.ID,
+			AllowedOrigin: rule.AllowedOrigins,
+			AllowedMethod: methods,
+			AllowedHeader: rule.AllowedHeaders,
+			ExposeHeader:  rule.ExposeHeaders,
+			MaxAgeSeconds: rule.MaxAgeSeconds,
+		})
+	}
+	return cors.NewConfig(converted)
+}
+
+func fromMinioCORS(config *cors.Config) []CORSRule {
+	rules := []CORSRule{}
+	if config == nil {
+		return rules
+	}
+	for _, rule := range config.CORSRules {
+		rules = append(rules, CORSRule{
+			ID:             rule.ID,
+			AllowedOrigins: rule.AllowedOrigin,
+			AllowedMethods: rule.AllowedMethod,
+			AllowedHeaders: rule.AllowedHeader,
+			ExposeHeaders:  rule.ExposeHeader,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		})
+	}
+	return rules
+}
+
+// validateCORSRules checks the constraints S3 enforces on a CORS configuration
+func validateCORSRules(rules []CORSRule) []string {
+	errs := []string{}
+	if len(rules) > maxCORSRules {
+		errs = append(errs, fmt.Sprintf("at most %d rules are allowed", maxCORSRules))
+	}
+	for i, rule := range rules {
+		name := fmt.Sprintf("rule %d", i+1)
+		if rule.ID != "" {
+			name = fmt.Sprintf("rule %q", rule.ID)
+		}
+		if len(rule.AllowedOrigins) == 0 {
+			errs = append(errs, fmt.Sprintf("%s: at least one allowed origin is required", name))
+		}
+		for _, origin := range rule.AllowedOrigins {
+			if strings.Count(origin, "*") > 1 {
+				errs = append(errs, fmt.Sprintf("%s: origin %q may contain at most one wildcard", name, origin))
+			}
+		}
+		if len(rule.AllowedMethods) == 0 {
+			errs = append(errs, fmt.Sprintf("%s: at least one allowed method is required", name))
+		}
+		for _, method := range rule.AllowedMethods {
+			if !corsAllowedMethods[strings.ToUpper(method)] {
+				errs = append(errs, fmt.Sprintf("%s: method %q is not allowed (GET, PUT, POST, DELETE, HEAD)", name, method))
+			}
+		}
+		for _, header := range rule.AllowedHeaders {
+			if strings.Count(header, "*") > 1 {
+				errs = append(errs, fmt.Sprintf("%s: header %q may contain at most one wildcard", name, header))
+			}
+		}
+		if rule.MaxAgeSeconds < 0 {
+			errs = append(errs, fmt.Sprintf("%s: maxAgeSeconds must be positive", name))
+		}
+	}
+	return errs
+}
+
+// requestOrigin guesses the origin of the kexamanager frontend that sent r
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		return origin
+	}
+	if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && referer.Host != "" {
+		return referer.Scheme + "://" + referer.Host
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// normalizeOrigin reduces an URL to scheme://host[:port], as browsers send it
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid origin %q (expected http(s)://host[:port])", origin)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// originRule builds the rule the S3 browser needs: presigned GET/PUT/POST uploads, ETag
+// readable for multipart and conditional requests
+func originRule(origin string) CORSRule {
+	host := strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://")
+	return CORSRule{
+		ID:             corsOriginRulePrefix + host,
+		AllowedOrigins: []string{origin},
+		AllowedMethods: []string{"GET", "HEAD", "PUT", "POST", "DELETE"},
+		AllowedHeaders: []string{"*"},
+		ExposeHeaders:  []string{"ETag", "Content-Length", "Content-Type", "Content-Disposition", "Last-Modified", "x-amz-version-id"},
+		MaxAgeSeconds:  corsOriginMaxAge,
+	}
+}
+
+func decodeCORSRequest(w http.ResponseWriter, r *http.Request) (BucketCORSRequest, bool) {
+	var req BucketCORSRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Bucket == "" {
+		http.Error(w, "bucket is required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// HandleGetBucketCORSWithConfig returns the CORS rules of a bucket
+func HandleGetBucketCORSWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeCORSRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		// GetBucketCors renvoie nil sans erreur quand le bucket n'a pas de configuration
+		corsConfig, err := client.GetBucketCors(r.Context(), req.Bucket)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get bucket CORS: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketCORSResponse{Rules: fromMinioCORS(corsConfig)})
+	}
+}
+
+// HandlePutBucketCORSWithConfig replaces the CORS rules of a bucket
+func HandlePutBucketCORSWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeCORSRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if len(req.Rules) == 0 {
+			http.Error(w, "at least one rule is required (use delete-bucket-cors to remove them)", http.StatusBadRequest)
+			return
+		}
+		if errs := validateCORSRules(req.Rules); len(errs) > 0 {
+			http.Error(w, fmt.Sprintf("Invalid CORS rules: %s", strings.Join(errs, "; ")), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		if err := client.SetBucketCors(r.Context(), req.Bucket, toMinioCORS(req.Rules)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set bucket CORS: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "put_bucket_cors", fmt.Sprintf("Set %d CORS rule(s) on bucket %s", len(req.Rules), req.Bucket), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketCORSResponse{Rules: req.Rules})
+	}
+}
+
+// HandleDeleteBucketCORSWithConfig removes the CORS configuration of a bucket
+func HandleDeleteBucketCORSWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeCORSRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		// Une configuration nil supprime le CORS du bucket
+		if err := client.SetBucketCors(r.Context(), req.Bucket, nil); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete bucket CORS: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "delete_bucket_cors", fmt.Sprintf("Removed CORS rules from bucket %s", req.Bucket), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}
+}
+
+// HandleAllowCORSOriginWithConfig generates the rule allowing the kexamanager origin to use
+// presigned URLs on a bucket, merged with the existing rules, and applies it when asked
+func HandleAllowCORSOriginWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req AllowCORSOriginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.Origin == "" {
+			req.Origin = requestOrigin(r)
+		}
+		origin, err := normalizeOrigin(req.Origin)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		current, err := client.GetBucketCors(r.Context(), req.Bucket)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get bucket CORS: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Remplace une éventuelle règle déjà générée pour cette origine, garde les autres
+		rule := originRule(origin)
+		rules := []CORSRule{rule}
+		for _, existing := range fromMinioCORS(current) {
+			if existing.ID != rule.ID {
+				rules = append(rules, existing)
+			}
+		}
+		if len(rules) > maxCORSRules {
+			http.Error(w, fmt.Sprintf("Bucket already has %d CORS rules", maxCORSRules), http.StatusConflict)
+			return
+		}
+
+		if req.Apply {
+			if err := client.SetBucketCors(r.Context(), req.Bucket, toMinioCORS(rules)); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to set bucket CORS: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if LogActionFunc != nil {
+				LogActionFunc(config.ID, config.UserID, "put_bucket_cors", fmt.Sprintf("Allowed origin %s on bucket %s", origin, req.Bucket), "success")
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AllowCORSOriginResponse{Rule: rule, Rules: rules, Applied: req.Apply})
+	}
+}
+
+// HandleDiagnoseCORSWithConfig sends a CORS preflight to the URL a browser would use for a
+// presigned request on the bucket and reports whether it would be accepted
+func HandleDiagnoseCORSWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req DiagnoseCORSRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.Origin == "" {
+			req.Origin = requestOrigin(r)
+		}
+		origin, err := normalizeOrigin(req.Origin)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		method := strings.ToUpper(req.Method)
+		if method == "" {
+			method = http.MethodPut
+		}
+		if !corsAllowedMethods[method] {
+			http.Error(w, "method must be GET, PUT, POST, DELETE or HEAD", http.StatusBadRequest)
+			return
+		}
+		key := req.Key
+		if key == "" {
+			key = "kexamanager-cors-check"
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		// L'URL présignée donne l'hôte et le style (path / virtual host) réellement utilisés par le navigateur
+		presigned, err := client.PresignedGetObject(r.Context(), req.Bucket, key, time.Minute, nil)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to build object URL: %v", err), http.StatusInternalServerError)
+			return
+		}
+		presigned.RawQuery = ""
+
+		preflight, err := http.NewRequestWithContext(r.Context(), http.MethodOptions, presigned.String(), nil)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to build preflight: %v", err), http.StatusInternalServerError)
+			return
+		}
+		preflight.Header.Set("Origin", origin)
+		preflight.Header.Set("Access-Control-Request-Method", method)
+		if method == http.MethodPut || method == http.MethodPost {
+			preflight.Header.Set("Access-Control-Request-Headers", "content-type")
+		}
+
+		resp := DiagnoseCORSResponse{URL: presigned.String(), Origin: origin, Method: method, Problems: []string{}}
+		res, err := corsDiagnoseClient.Do(preflight)
+		if err != nil {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("preflight request failed: %v", err))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		res.Body.Close()
+
+		resp.StatusCode = res.StatusCode
+		resp.AllowOrigin = res.Header.Get("Access-Control-Allow-Origin")
+		resp.AllowMethods = res.Header.Get("Access-Control-Allow-Methods")
+		resp.AllowHeaders = res.Header.Get("Access-Control-Allow-Headers")
+		resp.ExposeHeader = res.Header.Get("Access-Control-Expose-Headers")
+
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("preflight returned HTTP %d (no CORS rule matches this origin and method?)", res.StatusCode))
+		}
+		if resp.AllowOrigin == "" {
+			resp.Problems = append(resp.Problems, "response has no Access-Control-Allow-Origin header")
+		} else if resp.AllowOrigin != "*" && resp.AllowOrigin != origin {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("Access-Control-Allow-Origin is %q, not %q", resp.AllowOrigin, origin))
+		}
+		if resp.AllowMethods != "" && !strings.Contains(strings.ToUpper(resp.AllowMethods), method) {
+			resp.Problems = append(resp.Problems, fmt.Sprintf("method %s is not in Access-Control-Allow-Methods", method))
+		}
+		resp.OK = len(resp.Problems) == 0
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-
-	"github.com/minio/minio-go/v7"
 )
 
 // HandleCreateBucket handles the create bucket request
@@ -22,6 +20,11 @@ func HandleCreateBucket() http.HandlerFunc {
 			return
 		}
 
+		if req.DefaultRetention != nil && !req.ObjectLocking {
+			http.Error(w, "defaultRetention requires objectLocking", http.StatusBadRequest)
+			return
+		}
+
 		// Valider le token et récupérer l'user ID
 		userID, err := ValidateTokenFunc(r)
 		if err != nil {
@@ -48,7 +51,7 @@ func HandleCreateBucket() http.HandlerFunc {
 			return
 		}
 
-		err = client.MakeBucket(r.Context(), req.Bucket, minio.MakeBucketOptions{Region: creds.Region})
+		err = makeBucket(r.Context(), client, creds.Region, req)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to create bucket: %v", err), http.StatusInternalServerError)
 			return
@@ -74,6 +77,11 @@ func HandleCreateBucketWithConfig(config S3ConfigData) http.HandlerFunc {
 			return
 		}
 
+		if req.DefaultRetention != nil && !req.ObjectLocking {
+			http.Error(w, "defaultRetention requires objectLocking", http.StatusBadRequest)
+			return
+		}
+
 		creds, err := GetS3Credentials(config, req.KeyId, req.Token)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
@@ -86,7 +94,7 @@ func HandleCreateBucketWithConfig(config S3ConfigData) http.HandlerFunc {
 			return
 		}
 
-		err = client.MakeBucket(r.Context(), req.Bucket, minio.MakeBucketOptions{Region: creds.Region})
+		err = makeBucket(r.Context(), client, creds.Region, req)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to create bucket: %v", err), http.StatusInternalServerError)
 			return
@@ -6,6 +6,47 @@ import (
 	"net/http"
 )
 
+// checkBucketDeletion refuses to delete a protected bucket, or one whose name was not typed
+// again in confirmBucket
+func checkBucketDeletion(w http.ResponseWriter, config S3ConfigData, req DeleteBucketRequest) bool {
+	if req.Bucket == "" {
+		http.Error(w, "bucket is required", http.StatusBadRequest)
+		return false
+	}
+	if BucketProtectedFunc != nil {
+		protected, err := BucketProtectedFunc(config.ID, req.Bucket)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check bucket protection: %v", err), http.StatusInternalServerError)
+			return false
+		}
+		if protected {
+			http.Error(w, "Bucket is protected against deletion, remove the protection first", http.StatusForbidden)
+			return false
+		}
+	}
+	if req.ConfirmBucket != req.Bucket {
+		http.Error(w, "Type the bucket name in confirmBucket to confirm the deletion", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// startForceDeleteBucket hands the bucket to a background job that empties then deletes it
+func startForceDeleteBucket(w http.ResponseWriter, config S3ConfigData, req DeleteBucketRequest) {
+	if ForceDeleteBucketFunc == nil {
+		http.Error(w, "Force delete is not available", http.StatusNotImplemented)
+		return
+	}
+	job, err := ForceDeleteBucketFunc(config, req.Bucket, req.BypassGovernance)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start force delete: %v", err), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(DeleteBucketResponse{Success: true, Job: job})
+}
+
 // HandleDeleteBucket handles the delete bucket request
 func HandleDeleteBucket() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -46,6 +87,14 @@ func HandleDeleteBucket() http.HandlerFunc {
 			return
 		}
 
+		if !checkBucketDeletion(w, config, req) {
+			return
+		}
+		if req.Force {
+			startForceDeleteBucket(w, config, req)
+			return
+		}
+
 		err = client.RemoveBucket(r.Context(), req.Bucket)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to delete bucket: %v", err), http.StatusInternalServerError)
@@ -89,6 +138,14 @@ func HandleDeleteBucketWithConfig(config S3ConfigData) http.HandlerFunc {
 			return
 		}
 
+		if !checkBucketDeletion(w, config, req) {
+			return
+		}
+		if req.Force {
+			startForceDeleteBucket(w, config, req)
+			return
+		}
+
 		err = client.RemoveBucket(r.Context(), req.Bucket)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to delete bucket: %v", err), http.StatusInternalServerError)
@@ -1,13 +1,45 @@
 package s3
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/minio/minio-go/v7"
 )
 
+// deleteObject removes an object, or moves it to the trash when the project has one enabled.
+// Deleting a specific version, or with permanent set, always bypasses the trash.
+func deleteObject(ctx context.Context, client *minio.Client, config S3ConfigData, req DeleteObjectRequest) (bool, error) {
+	if config.TrashEnabled && req.VersionID == "" && !req.Permanent && !isTrashKey(req.Key) {
+		trashed, err := MoveToTrash(ctx, client, config, req.Bucket, req.Key, req.BypassGovernance)
+		if err != nil && minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+			return false, err
+		}
+		if err != nil {
+			// Rien à conserver : la suppression S3 d'une clé absente réussit
+			return false, nil
+		}
+		if ObjectTrashedFunc != nil {
+			if err := ObjectTrashedFunc(config.ID, trashed); err != nil {
+				// Sans entrée dans la liste, la copie serait introuvable et jamais purgée : on annule
+				if restoreErr := RestoreFromTrash(ctx, client, config, trashed, false); restoreErr != nil {
+					log.Printf("Failed to restore %s/%s after the trash entry could not be recorded: %v", req.Bucket, req.Key, restoreErr)
+				}
+				return false, fmt.Errorf("failed to record trashed object: %v", err)
+			}
+		}
+		return true, nil
+	}
+	err := client.RemoveObject(ctx, req.Bucket, req.Key, minio.RemoveObjectOptions{
+		VersionID:        req.VersionID,
+		GovernanceBypass: req.BypassGovernance,
+	})
+	return false, err
+}
+
 // HandleDeleteObject handles the delete object request
 func HandleDeleteObject() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -48,13 +80,19 @@ func HandleDeleteObject() http.HandlerFunc {
 			return
 		}
 
-		err = client.RemoveObject(r.Context(), req.Bucket, req.Key, minio.RemoveObjectOptions{})
+		trashed, err := deleteObject(r.Context(), client, config, req)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete object: %v", err), http.StatusInternalServerError)
+			writeDeleteObjectError(w, r.Context(), client, req, err)
 			return
 		}
 
-		resp := DeleteObjectResponse{Success: true}
+		if req.VersionID == "" {
+			notifyObjectChanged(config, ObjectChange{Bucket: req.Bucket, Key: req.Key, Deleted: true})
+		} else {
+			refreshObjectChanged(r.Context(), client, config, req.Bucket, req.Key)
+		}
+
+		resp := DeleteObjectResponse{Success: true, Trashed: trashed}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
@@ -86,16 +124,26 @@ func HandleDeleteObjectWithConfig(config S3ConfigData) http.HandlerFunc {
 			return
 		}
 
-		err = client.RemoveObject(r.Context(), req.Bucket, req.Key, minio.RemoveObjectOptions{})
+		trashed, err := deleteObject(r.Context(), client, config, req)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete object: %v", err), http.StatusInternalServerError)
+			writeDeleteObjectError(w, r.Context(), client, req, err)
 			return
 		}
 
-		resp := DeleteObjectResponse{Success: true}
+		if req.VersionID == "" {
+			notifyObjectChanged(config, ObjectChange{Bucket: req.Bucket, Key: req.Key, Deleted: true})
+		} else {
+			refreshObjectChanged(r.Context(), client, config, req.Bucket, req.Key)
+		}
+
+		resp := DeleteObjectResponse{Success: true, Trashed: trashed}
 
 		if LogActionFunc != nil {
-			LogActionFunc(config.ID, 0, "delete_object", fmt.Sprintf("Deleted object %s/%s", req.Bucket, req.Key), "success")
+			details := fmt.Sprintf("Deleted object %s/%s", req.Bucket, req.Key)
+			if trashed {
+				details = fmt.Sprintf("Moved object %s/%s to the trash", req.Bucket, req.Key)
+			}
+			LogActionFunc(config.ID, 0, "delete_object", details, "success")
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,248 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ServeObjectOptions controls how ServeObject presents the object to the client
+type ServeObjectOptions struct {
+	Disposition  string // "attachment" (default) or "inline"
+	Filename     string // Defaults to the last segment of the key
+	CacheControl string
+	VersionID    string // Empty for the current version
+	Encryption   ReadEncryption
+}
+
+// ContentDisposition builds a Content-Disposition header value safe for non-ASCII filenames
+func ContentDisposition(disposition, filename string) string {
+	if disposition != "inline" {
+		disposition = "attachment"
+	}
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, fallback, url.PathEscape(filename))
+}
+
+// etagMatches compares a list of entity tags from If-None-Match with the object ETag (weak comparison)
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(strings.Trim(etag, `"`), "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`)
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a single "bytes=start-end" range. ok is false when the header
+// should be ignored (absent, malformed or multiple ranges), in which case the full
+// object is served.
+func parseRange(header string, size int64) (start, end int64, ok bool, satisfiable bool) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, false, true
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if spec == "" || strings.Contains(spec, ",") {
+		return 0, 0, false, true
+	}
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false, true
+	}
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+	if startStr == "" {
+		// Suffixe : les N derniers octets
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, true
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, true
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	end = size - 1
+	if endStr != "" {
+		e, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || e < start {
+			return 0, 0, false, true
+		}
+		if e < end {
+			end = e
+		}
+	}
+	return start, end, true, true
+}
+
+// ServeObject streams an object through the proxy. It sets Content-Type, Content-Disposition,
+// ETag and Last-Modified from StatObject, answers If-None-Match / If-Modified-Since with 304
+// and honors single byte ranges (including If-Range).
+func ServeObject(w http.ResponseWriter, r *http.Request, client *minio.Client, bucket, key string, opts ServeObjectOptions) {
+	info, sse, err := opts.Encryption.Stat(r.Context(), client, bucket, key, opts.VersionID)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	filename := opts.Filename
+	if filename == "" {
+		filename = path.Base(key)
+	}
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	etag := `"` + strings.Trim(info.ETag, `"`) + `"`
+	lastModified := info.LastModified.UTC()
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if opts.CacheControl != "" {
+		w.Header().Set("Cache-Control", opts.CacheControl)
+	}
+
+	// If-None-Match est prioritaire sur If-Modified-Since (RFC 9110)
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", ContentDisposition(opts.Disposition, filename))
+
+	start, end, ranged, satisfiable := parseRange(r.Header.Get("Range"), info.Size)
+	if ranged {
+		// If-Range : ne servir la plage que si la représentation n'a pas changé
+		if ifRange := r.Header.Get("If-Range"); ifRange != "" {
+			if t, err := http.ParseTime(ifRange); err == nil {
+				ranged = !lastModified.Truncate(time.Second).After(t)
+			} else {
+				ranged = strings.Trim(ifRange, `"`) == strings.Trim(etag, `"`)
+			}
+		}
+	}
+	if ranged && !satisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	getOpts := minio.GetObjectOptions{VersionID: opts.VersionID, ServerSideEncryption: sse}
+	status := http.StatusOK
+	length := info.Size
+	if ranged {
+		if err := getOpts.SetRange(start, end); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid range: %v", err), http.StatusBadRequest)
+			return
+		}
+		status = http.StatusPartialContent
+		length = end - start + 1
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	object, err := client.GetObject(r.Context(), bucket, key, getOpts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get object: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer object.Close()
+
+	w.WriteHeader(status)
+	io.CopyN(w, object, length)
+}
+
+// HandleDownloadObjectWithConfig streams an object through the proxy (GET or HEAD,
+// query parameters bucket, key and optional versionId, sseKeyName and disposition=inline).
+// A per-request SSE-C key is read from the X-Amz-Server-Side-Encryption-Customer-Key header.
+func HandleDownloadObjectWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		bucket := query.Get("bucket")
+		key := query.Get("key")
+		if bucket == "" || key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		readSSE, err := ResolveReadEncryption(config, SSEOptions{
+			SSECustomerKey: r.Header.Get(SSECustomerKeyHeader),
+			SSEKeyName:     query.Get("sseKeyName"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		creds, err := GetS3Credentials(config, "", "")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		client, err := CreateS3Client(creds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		ServeObject(w, r, client, bucket, key, ServeObjectOptions{
+			Disposition:  query.Get("disposition"),
+			CacheControl: "private, no-cache",
+			VersionID:    query.Get("versionId"),
+			Encryption:   readSSE,
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// EmptyBucketProgress counts what an EmptyBucket run has removed so far
+type EmptyBucketProgress struct {
+	ObjectsDeleted int64
+	UploadsAborted int64
+	Failed         int64
+}
+
+// EmptyBucket deletes every object of a bucket, including all versions and delete markers on
+// versioned buckets, then aborts its incomplete multipart uploads. progress is called after
+// each batch. Objects under GOVERNANCE retention are only removed with bypassGovernance; the
+// others count as failures. Running it again after an interruption simply continues the work.
+func EmptyBucket(ctx context.Context, client *minio.Client, bucket string, bypassGovernance bool, progress func(EmptyBucketProgress)) (EmptyBucketProgress, error) {
+	var done EmptyBucketProgress
+	report := func() {
+		if progress != nil {
+			progress(done)
+		}
+	}
+
+	// Garage et les buckets jamais versionnés ne répondent pas forcément à ListObjectVersions
+	withVersions := false
+	if versioning, err := client.GetBucketVersioning(ctx, bucket); err == nil {
+		withVersions = versioning.Status != ""
+	}
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objects := make(chan minio.ObjectInfo)
+	var listErr error
+	go func() {
+		defer close(objects)
+		for object := range client.ListObjects(listCtx, bucket, minio.ListObjectsOptions{Recursive: true, WithVersions: withVersions}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			select {
+			case objects <- object:
+			case <-listCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+	for result := range client.RemoveObjectsWithResult(ctx, bucket, objects, minio.RemoveObjectsOptions{GovernanceBypass: bypassGovernance}) {
+		if result.Err != nil {
+			done.Failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to delete %s: %v", result.ObjectName, result.Err)
+			}
+		} else {
+			done.ObjectsDeleted++
+		}
+		if (done.ObjectsDeleted+done.Failed)%1000 == 0 {
+			report()
+		}
+	}
+	report()
+	if listErr != nil {
+		return done, fmt.Errorf("failed to list objects: %v", listErr)
+	}
+	if firstErr != nil {
+		return done, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return done, err
+	}
+
+	core := minio.Core{Client: client}
+	for upload := range client.ListIncompleteUploads(ctx, bucket, "", true) {
+		if upload.Err != nil {
+			return done, fmt.Errorf("failed to list incomplete uploads: %v", upload.Err)
+		}
+		if err := core.AbortMultipartUpload(ctx, bucket, upload.Key, upload.UploadID); err != nil {
+			done.Failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to abort upload of %s: %v", upload.Key, err)
+			}
+			continue
+		}
+		done.UploadsAborted++
+	}
+	report()
+	return done, firstErr
+}
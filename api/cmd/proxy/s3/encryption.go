@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	EncryptionNone  = "none"
+	EncryptionSSES3 = "sse-s3"
+	EncryptionSSEC  = "sse-c"
+
+	// SSECustomerKeyHeader lets download-object receive a per-request SSE-C key (base64)
+	SSECustomerKeyHeader = "X-Amz-Server-Side-Encryption-Customer-Key"
+)
+
+// ValidEncryptionMode reports whether mode can be used as a project default
+func ValidEncryptionMode(mode string) bool {
+	return mode == "" || mode == EncryptionSSES3 || mode == EncryptionSSEC
+}
+
+// customerKey returns the SSE-C key explicitly selected by the request, if any
+func customerKey(config S3ConfigData, opts SSEOptions) ([]byte, error) {
+	switch {
+	case opts.SSECustomerKey != "":
+		key, err := base64.StdEncoding.DecodeString(opts.SSECustomerKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("sseCustomerKey must be a base64-encoded 256-bit key")
+		}
+		return key, nil
+	case opts.SSEKeyName != "":
+		return keyringKey(config, opts.SSEKeyName)
+	}
+	return nil, nil
+}
+
+func keyringKey(config S3ConfigData, name string) ([]byte, error) {
+	if ResolveSSEKeyFunc == nil {
+		return nil, fmt.Errorf("SSE-C keyring is not available")
+	}
+	key, err := ResolveSSEKeyFunc(config.ID, name)
+	if err != nil {
+		return nil, fmt.Errorf("SSE-C key %q: %v", name, err)
+	}
+	return key, nil
+}
+
+// WriteEncryption resolves the encryption of an upload from the request and the project default
+func WriteEncryption(config S3ConfigData, opts SSEOptions) (encrypt.ServerSide, error) {
+	key, err := customerKey(config, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := opts.SSE
+	if mode == "" {
+		mode = config.DefaultEncryption
+		if key != nil {
+			mode = EncryptionSSEC
+		}
+	}
+
+	switch mode {
+	case "", EncryptionNone:
+		return nil, nil
+	case EncryptionSSES3:
+		return encrypt.NewSSE(), nil
+	case EncryptionSSEC:
+		if key == nil {
+			if config.DefaultSSEKey == "" {
+				return nil, fmt.Errorf("sse-c requires sseCustomerKey or sseKeyName")
+			}
+			if key, err = keyringKey(config, config.DefaultSSEKey); err != nil {
+				return nil, err
+			}
+		}
+		return encrypt.NewSSEC(key)
+	default:
+		return nil, fmt.Errorf("sse must be 'sse-s3', 'sse-c' or 'none'")
+	}
+}
+
+// ResolveUploadEncryption fixes the project default encryption of an upload spread over several
+// requests (multipart, tus). The returned options are stored with the upload and replayed with
+// WriteEncryption on every part, so a later change of the default cannot mix encryptions.
+func ResolveUploadEncryption(config S3ConfigData) (SSEOptions, encrypt.ServerSide, error) {
+	opts := SSEOptions{SSE: config.DefaultEncryption}
+	switch opts.SSE {
+	case "":
+		opts.SSE = EncryptionNone
+	case EncryptionSSEC:
+		opts.SSEKeyName = config.DefaultSSEKey
+	}
+	sse, err := WriteEncryption(config, opts)
+	return opts, sse, err
+}
+
+// ReadEncryption is the SSE-C key needed to read an object. Implicit keys come from the
+// project default and are only tried first: objects stored without SSE-C remain readable.
+type ReadEncryption struct {
+	SSE      encrypt.ServerSide
+	Implicit bool
+}
+
+// ResolveReadEncryption picks the SSE-C key for a read (stat, get, copy source, download)
+func ResolveReadEncryption(config S3ConfigData, opts SSEOptions) (ReadEncryption, error) {
+	if opts.SSE == EncryptionNone {
+		return ReadEncryption{}, nil
+	}
+
+	key, err := customerKey(config, opts)
+	if err != nil {
+		return ReadEncryption{}, err
+	}
+	implicit := false
+	if key == nil {
+		if config.DefaultEncryption != EncryptionSSEC || config.DefaultSSEKey == "" {
+			return ReadEncryption{}, nil
+		}
+		if key, err = keyringKey(config, config.DefaultSSEKey); err != nil {
+			return ReadEncryption{}, err
+		}
+		implicit = true
+	}
+
+	sse, err := encrypt.NewSSEC(key)
+	if err != nil {
+		return ReadEncryption{}, err
+	}
+	return ReadEncryption{SSE: sse, Implicit: implicit}, nil
+}
+
+// Stat stats an object with the key, falling back to no key when the key was implicit.
+// It returns the encryption that worked, to be reused for GetObject or CopyObject.
+func (e ReadEncryption) Stat(ctx context.Context, client *minio.Client, bucket, key, versionID string) (minio.ObjectInfo, encrypt.ServerSide, error) {
+	info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{VersionID: versionID, ServerSideEncryption: e.SSE})
+	if err != nil && e.SSE != nil && e.Implicit && minio.ToErrorResponse(err).StatusCode == http.StatusBadRequest {
+		info, err = client.StatObject(ctx, bucket, key, minio.StatObjectOptions{VersionID: versionID})
+		return info, nil, err
+	}
+	return info, e.SSE, err
+}
+
+// objectEncryption describes how a stored object is encrypted, from its StatObject headers
+func objectEncryption(info minio.ObjectInfo) string {
+	if info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return EncryptionSSEC
+	}
+	switch info.Metadata.Get("X-Amz-Server-Side-Encryption") {
+	case "AES256":
+		return EncryptionSSES3
+	case "aws:kms":
+		return "sse-kms"
+	}
+	return ""
+}
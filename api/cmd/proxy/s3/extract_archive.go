@@ -0,0 +1,432 @@
+package s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	archiveFormatTar = "tar"
+
+	extractMaxEntries = 10000
+	// Au-delà de extractRatioMinSize octets décompressés, un taux de compression supérieur
+	// à extractMaxRatio est traité comme une bombe de décompression
+	extractMaxRatio     = 200
+	extractRatioMinSize = 16 << 20
+)
+
+var errExtractRatio = errors.New("compression ratio is too high (possible zip bomb)")
+
+// countingReader counts the bytes read from the uploaded (compressed) stream
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ratioGuard fails once the decompressed output grows too large relative to the compressed input
+type ratioGuard struct {
+	r          io.Reader
+	compressed *countingReader
+	n          int64
+	tripped    bool
+}
+
+func (g *ratioGuard) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.n += int64(n)
+	if g.n > extractRatioMinSize && g.n > g.compressed.n*extractMaxRatio {
+		g.tripped = true
+		return n, errExtractRatio
+	}
+	return n, err
+}
+
+// sniffArchiveFormat picks the archive format from the form field, the filename, then the magic bytes
+func sniffArchiveFormat(explicit, filename string, head []byte) string {
+	switch explicit {
+	case archiveFormatZip, archiveFormatTar, archiveFormatTarGz:
+		return explicit
+	case "tgz":
+		return archiveFormatTarGz
+	}
+
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveFormatZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveFormatTarGz
+	case strings.HasSuffix(name, ".tar"):
+		return archiveFormatTar
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return archiveFormatZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return archiveFormatTarGz
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return archiveFormatTar
+	}
+	return ""
+}
+
+// extractEntryKey maps an archive path to an object key under prefix. It refuses absolute
+// paths and any ".." segment instead of cleaning them away.
+func extractEntryKey(prefix, name string) (key, reason string) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", "absolute path"
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", "path traversal"
+		}
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == "" {
+		return "", "empty name"
+	}
+	return prefix + clean, ""
+}
+
+// archiveExtractor uploads the entries of an archive and builds the report
+type archiveExtractor struct {
+	ctx      context.Context
+	config   S3ConfigData
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	sse      encrypt.ServerSide
+	maxTotal int64
+	guard    *ratioGuard // tar.gz uniquement
+	report   ExtractArchiveResponse
+	// Création seule (overwrite=false ou politique du projet) : les clés existantes sont ignorées
+	precondition  WritePrecondition
+	readSSE       ReadEncryption
+	unconditional bool // Le backend refuse If-None-Match : seul le StatObject protège
+}
+
+func (e *archiveExtractor) skip(name, reason string) {
+	e.report.Entries = append(e.report.Entries, ExtractArchiveEntry{Name: name, Status: "skipped", Reason: reason})
+	e.report.Skipped++
+}
+
+// put uploads one regular file. Only errors that make the rest of the archive unusable are returned.
+func (e *archiveExtractor) put(name string, size int64, body io.Reader) error {
+	if len(e.report.Entries) >= extractMaxEntries {
+		return fmt.Errorf("archive contains more than %d entries", extractMaxEntries)
+	}
+	key, reason := extractEntryKey(e.prefix, name)
+	if reason != "" {
+		e.skip(name, reason)
+		return nil
+	}
+	if e.report.TotalSize+size > e.maxTotal {
+		return fmt.Errorf("archive expands beyond the maximum of %d bytes", e.maxTotal)
+	}
+
+	br := bufio.NewReaderSize(body, 512)
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		head, _ := br.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+
+	opts := minio.PutObjectOptions{
+		ContentType:          contentType,
+		ServerSideEncryption: e.sse,
+	}
+	if !e.precondition.IsZero() {
+		if err := e.precondition.Check(e.ctx, e.client, e.bucket, key, e.readSSE); err != nil {
+			if _, ok := err.(*WriteConflictError); ok {
+				e.skip(name, "exists")
+				return nil
+			}
+			return fmt.Errorf("failed to check %s: %v", key, err)
+		}
+		if !e.unconditional {
+			e.precondition.Apply(&opts)
+		}
+	}
+
+	entry := ExtractArchiveEntry{Name: name, Key: key, Size: size, ContentType: contentType}
+	info, err := e.client.PutObject(e.ctx, e.bucket, key, br, size, opts)
+	if err != nil {
+		switch minio.ToErrorResponse(err).StatusCode {
+		case http.StatusPreconditionFailed:
+			// Créée entre la vérification et l'écriture
+			e.skip(name, "exists")
+			return nil
+		case http.StatusNotImplemented:
+			// Le flux est consommé : cette entrée échoue, les suivantes partent sans en-tête
+			e.unconditional = !e.precondition.IsZero()
+		}
+		entry.Status = "failed"
+		entry.Reason = err.Error()
+		e.report.Failed++
+		e.report.Entries = append(e.report.Entries, entry)
+		if e.guard != nil && e.guard.tripped {
+			return errExtractRatio
+		}
+		return nil
+	}
+
+	notifyObjectWritten(e.ctx, e.client, e.config, e.readSSE, e.bucket, key, info)
+	entry.Status = "extracted"
+	e.report.Extracted++
+	e.report.TotalSize += size
+	e.report.Entries = append(e.report.Entries, entry)
+	return nil
+}
+
+// extractZip spools the upload to a temporary file (the central directory sits at the end of
+// a ZIP) and checks the declared sizes before uploading anything.
+func (e *archiveExtractor) extractZip(upload io.Reader) error {
+	tmp, err := os.CreateTemp("", "kexa-extract-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, err := io.Copy(tmp, io.LimitReader(upload, e.maxTotal+1))
+	if err != nil {
+		return fmt.Errorf("failed to receive archive: %v", err)
+	}
+	if n > e.maxTotal {
+		return fmt.Errorf("archive is larger than %d bytes", e.maxTotal)
+	}
+
+	zr, err := zip.NewReader(tmp, n)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %v", err)
+	}
+	if len(zr.File) > extractMaxEntries {
+		return fmt.Errorf("archive contains more than %d entries", extractMaxEntries)
+	}
+	var declared uint64
+	for _, f := range zr.File {
+		declared += f.UncompressedSize64
+	}
+	if declared > uint64(e.maxTotal) {
+		return fmt.Errorf("archive expands beyond the maximum of %d bytes", e.maxTotal)
+	}
+
+	for _, f := range zr.File {
+		switch {
+		case f.FileInfo().IsDir():
+			continue
+		case !f.Mode().IsRegular():
+			e.skip(f.Name, "not a regular file")
+			continue
+		case f.UncompressedSize64 > extractRatioMinSize && f.UncompressedSize64 > f.CompressedSize64*extractMaxRatio:
+			e.skip(f.Name, errExtractRatio.Error())
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			e.report.Entries = append(e.report.Entries, ExtractArchiveEntry{Name: f.Name, Status: "failed", Reason: err.Error()})
+			e.report.Failed++
+			continue
+		}
+		err = e.put(f.Name, int64(f.UncompressedSize64), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTar streams a tar (optionally gzipped) entry by entry, without spooling
+func (e *archiveExtractor) extractTar(upload io.Reader, gzipped bool) error {
+	var src io.Reader = upload
+	if gzipped {
+		compressed := &countingReader{r: upload}
+		gz, err := gzip.NewReader(compressed)
+		if err != nil {
+			return fmt.Errorf("invalid gzip stream: %v", err)
+		}
+		defer gz.Close()
+		e.guard = &ratioGuard{r: gz, compressed: compressed}
+		src = e.guard
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %v", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg:
+			if err := e.put(header.Name, header.Size, tr); err != nil {
+				return err
+			}
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+			continue
+		default:
+			e.skip(header.Name, "not a regular file")
+		}
+	}
+}
+
+// HandleExtractArchiveWithConfig extracts an uploaded ZIP or tar(.gz) into bucket/prefix.
+// Multipart form: bucket, prefix, optional format, overwrite and sse fields, then the file part last.
+// With overwrite=false (or the project "never overwrite" policy) existing keys are skipped.
+// Tar archives are streamed straight to S3; ZIP archives are spooled to a temporary file.
+func HandleExtractArchiveWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid multipart form: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// Les champs sont lus au fil du flux : ils doivent précéder la partie "file"
+		fields := map[string]string{}
+		var file io.Reader
+		var filename string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid multipart form: %v", err), http.StatusBadRequest)
+				return
+			}
+			if part.FormName() == "file" {
+				file, filename = part, part.FileName()
+				break
+			}
+			value, _ := io.ReadAll(io.LimitReader(part, 4096))
+			fields[part.FormName()] = string(value)
+		}
+
+		bucket := fields["bucket"]
+		if bucket == "" {
+			http.Error(w, "bucket is required (form fields must precede the file)", http.StatusBadRequest)
+			return
+		}
+		if file == nil {
+			http.Error(w, "file is required", http.StatusBadRequest)
+			return
+		}
+
+		prefix := strings.TrimLeft(fields["prefix"], "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+
+		sse, err := WriteEncryption(config, SSEOptions{
+			SSE:            fields["sse"],
+			SSECustomerKey: fields["sseCustomerKey"],
+			SSEKeyName:     fields["sseKeyName"],
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid encryption: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		overwrite, err := ParseOverwrite(fields["overwrite"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		readSSE, err := ResolveReadEncryption(config, SSEOptions{
+			SSECustomerKey: fields["sseCustomerKey"],
+			SSEKeyName:     fields["sseKeyName"],
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, fields["keyId"], fields["token"])
+		if !ok {
+			return
+		}
+
+		upload := bufio.NewReaderSize(file, 512)
+		head, _ := upload.Peek(262)
+		format := sniffArchiveFormat(fields["format"], filename, head)
+		if format == "" {
+			http.Error(w, "Unrecognized archive format, expected zip, tar or tar.gz", http.StatusBadRequest)
+			return
+		}
+
+		extractor := &archiveExtractor{
+			ctx:      r.Context(),
+			config:   config,
+			client:   client,
+			bucket:   bucket,
+			prefix:   prefix,
+			sse:      sse,
+			maxTotal: ArchiveMaxTotalSize,
+			report:   ExtractArchiveResponse{Format: format, Entries: []ExtractArchiveEntry{}},
+
+			precondition: ResolveWritePrecondition(config, WritePrecondition{}, overwrite),
+			readSSE:      readSSE,
+		}
+		if format == archiveFormatZip {
+			err = extractor.extractZip(upload)
+		} else {
+			err = extractor.extractTar(upload, format == archiveFormatTarGz)
+		}
+
+		report := extractor.report
+		status := http.StatusOK
+		if err != nil {
+			report.Error = err.Error()
+			status = http.StatusUnprocessableEntity
+		}
+
+		if LogActionFunc != nil {
+			details := fmt.Sprintf("Extracted %d entries (%d bytes) from %s into %s/%s, %d skipped, %d failed", report.Extracted, report.TotalSize, filename, bucket, prefix, report.Skipped, report.Failed)
+			logStatus := "success"
+			if err != nil {
+				details += ": " + err.Error()
+				logStatus = "error"
+			}
+			LogActionFunc(config.ID, config.UserID, "extract_archive", details, logStatus)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,294 @@
+package s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExtractEntryKey(t *testing.T) {
+	tests := []struct {
+		name, prefix, entry string
+		key, reason         string
+	}{
+		{"plain file", "uploads/", "a.txt", "uploads/a.txt", ""},
+		{"nested file", "uploads/", "dir/sub/a.txt", "uploads/dir/sub/a.txt", ""},
+		{"no prefix", "", "a.txt", "a.txt", ""},
+		{"dot segments cleaned", "p/", "./dir/./a.txt", "p/dir/a.txt", ""},
+		{"duplicate slashes cleaned", "p/", "dir//a.txt", "p/dir/a.txt", ""},
+		{"backslashes become slashes", "p/", `dir\sub\a.txt`, "p/dir/sub/a.txt", ""},
+		{"dot-dot prefix", "p/", "../a.txt", "", "path traversal"},
+		{"dot-dot in the middle", "p/", "dir/../../a.txt", "", "path traversal"},
+		{"dot-dot that would clean away", "p/", "dir/../a.txt", "", "path traversal"},
+		{"backslash dot-dot", "p/", `dir\..\..\a.txt`, "", "path traversal"},
+		{"dot-dot inside a name is allowed", "p/", "a..b.txt", "p/a..b.txt", ""},
+		{"absolute path", "p/", "/etc/passwd", "", "absolute path"},
+		{"absolute backslash path", "p/", `\etc\passwd`, "", "absolute path"},
+		{"drive letter", "p/", `C:\Windows\a.txt`, "", "absolute path"},
+		{"drive letter with slash", "p/", "c:/a.txt", "", "absolute path"},
+		{"empty name", "p/", "", "", "empty name"},
+		{"dot only", "p/", ".", "", "empty name"},
+		{"dot slash only", "p/", "./", "", "empty name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, reason := extractEntryKey(tt.prefix, tt.entry)
+			if key != tt.key || reason != tt.reason {
+				t.Errorf("extractEntryKey(%q, %q) = (%q, %q), want (%q, %q)", tt.prefix, tt.entry, key, reason, tt.key, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSniffArchiveFormat(t *testing.T) {
+	ustar := make([]byte, 512)
+	copy(ustar[257:], "ustar")
+
+	tests := []struct {
+		name, explicit, filename string
+		head                     []byte
+		want                     string
+	}{
+		{"explicit zip", "zip", "archive.tar", nil, archiveFormatZip},
+		{"explicit tar", "tar", "", nil, archiveFormatTar},
+		{"explicit tgz alias", "tgz", "", nil, archiveFormatTarGz},
+		{"unknown explicit falls back to the name", "rar", "archive.zip", nil, archiveFormatZip},
+		{"zip extension", "", "Archive.ZIP", nil, archiveFormatZip},
+		{"tar.gz extension", "", "backup.tar.gz", nil, archiveFormatTarGz},
+		{"tgz extension", "", "backup.tgz", nil, archiveFormatTarGz},
+		{"tar extension", "", "backup.tar", nil, archiveFormatTar},
+		{"name wins over bytes", "", "backup.tar", []byte("PK\x03\x04"), archiveFormatTar},
+		{"zip magic", "", "upload", []byte("PK\x03\x04rest"), archiveFormatZip},
+		{"empty zip magic", "", "upload", []byte("PK\x05\x06"), archiveFormatZip},
+		{"gzip magic", "", "upload", []byte{0x1f, 0x8b, 0x08}, archiveFormatTarGz},
+		{"ustar magic", "", "upload", ustar, archiveFormatTar},
+		{"short header", "", "upload", []byte("ustar"), ""},
+		{"unknown", "", "notes.txt", []byte("hello"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffArchiveFormat(tt.explicit, tt.filename, tt.head); got != tt.want {
+				t.Errorf("sniffArchiveFormat(%q, %q) = %q, want %q", tt.explicit, tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+type archiveTestEntry struct {
+	name string
+	data []byte
+	link bool // tar : lien symbolique au lieu d'un fichier
+}
+
+func buildTar(t *testing.T, gzipped bool, entries []archiveTestEntry) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	var dst io.Writer = &out
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(&out)
+		dst = gz
+	}
+	tw := tar.NewWriter(dst)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		if e.link {
+			header = &tar.Header{Name: e.name, Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if !e.link {
+			if _, err := tw.Write(e.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func buildZip(t *testing.T, entries []archiveTestEntry) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func newTestExtractor(t *testing.T, maxTotal int64) (*archiveExtractor, *fakeS3) {
+	fake, client := newFakeS3(t)
+	return &archiveExtractor{
+		ctx:      context.Background(),
+		client:   client,
+		bucket:   "bkt",
+		prefix:   "p/",
+		maxTotal: maxTotal,
+		report:   ExtractArchiveResponse{Entries: []ExtractArchiveEntry{}},
+	}, fake
+}
+
+func entryStatus(report ExtractArchiveResponse) map[string]string {
+	status := map[string]string{}
+	for _, e := range report.Entries {
+		status[e.Name] = e.Status + " " + e.Reason
+	}
+	return status
+}
+
+func TestExtractTarSkipsUnsafeEntries(t *testing.T) {
+	e, fake := newTestExtractor(t, 1<<20)
+	archive := buildTar(t, false, []archiveTestEntry{
+		{name: "../escape.txt", data: []byte("x")},
+		{name: "/etc/cron.d/job", data: []byte("x")},
+		{name: `C:\Windows\evil.dll`, data: []byte("x")},
+		{name: "link", link: true},
+		{name: "dir/ok.txt", data: []byte("hello")},
+	})
+
+	if err := e.extractTar(bytes.NewReader(archive), false); err != nil {
+		t.Fatalf("extractTar() error = %v", err)
+	}
+	if got := fake.written(); len(got) != 1 || got[0] != "p/dir/ok.txt" {
+		t.Fatalf("written keys = %v, want [p/dir/ok.txt]", got)
+	}
+	if e.report.Extracted != 1 || e.report.Skipped != 4 {
+		t.Errorf("extracted %d, skipped %d, want 1 and 4", e.report.Extracted, e.report.Skipped)
+	}
+	status := entryStatus(e.report)
+	for name, want := range map[string]string{
+		"../escape.txt":       "skipped path traversal",
+		"/etc/cron.d/job":     "skipped absolute path",
+		`C:\Windows\evil.dll`: "skipped absolute path",
+		"link":                "skipped not a regular file",
+	} {
+		if status[name] != want {
+			t.Errorf("entry %q = %q, want %q", name, status[name], want)
+		}
+	}
+}
+
+func TestExtractTarGzRatioGuard(t *testing.T) {
+	// 20 entrées de 1 Mio de zéros : le flux décompressé dépasse extractRatioMinSize avec un
+	// taux de compression bien supérieur à extractMaxRatio
+	zeros := make([]byte, 1<<20)
+	var entries []archiveTestEntry
+	for i := 0; i < 20; i++ {
+		entries = append(entries, archiveTestEntry{name: "zero-" + strings.Repeat("x", i), data: zeros})
+	}
+	e, fake := newTestExtractor(t, 1<<30)
+
+	err := e.extractTar(bytes.NewReader(buildTar(t, true, entries)), true)
+	if err == nil || !strings.Contains(err.Error(), errExtractRatio.Error()) {
+		t.Fatalf("extractTar() error = %v, want %v", err, errExtractRatio)
+	}
+	if !e.guard.tripped {
+		t.Error("ratio guard did not trip")
+	}
+	if n := len(fake.written()); n >= len(entries) || int64(n)<<20 > extractRatioMinSize {
+		t.Errorf("%d entries written, want the extraction to stop around %d bytes", n, extractRatioMinSize)
+	}
+}
+
+func TestExtractTarGzBelowRatioThreshold(t *testing.T) {
+	// Très compressible mais sous extractRatioMinSize : rien n'est refusé
+	e, fake := newTestExtractor(t, 1<<30)
+	archive := buildTar(t, true, []archiveTestEntry{{name: "zeros.bin", data: make([]byte, 4<<20)}})
+
+	if err := e.extractTar(bytes.NewReader(archive), true); err != nil {
+		t.Fatalf("extractTar() error = %v", err)
+	}
+	if object, ok := fake.get("bkt", "p/zeros.bin"); !ok || len(object.data) != 4<<20 {
+		t.Fatalf("p/zeros.bin was not extracted whole")
+	}
+}
+
+func TestExtractTarTotalSizeLimit(t *testing.T) {
+	e, fake := newTestExtractor(t, 1000)
+	archive := buildTar(t, false, []archiveTestEntry{
+		{name: "a.bin", data: make([]byte, 600)},
+		{name: "b.bin", data: make([]byte, 600)},
+	})
+
+	err := e.extractTar(bytes.NewReader(archive), false)
+	if err == nil || !strings.Contains(err.Error(), "expands beyond") {
+		t.Fatalf("extractTar() error = %v, want the total size limit", err)
+	}
+	if got := fake.written(); len(got) != 1 || got[0] != "p/a.bin" {
+		t.Errorf("written keys = %v, want only p/a.bin", got)
+	}
+}
+
+func TestExtractZipSkipsHighRatioEntry(t *testing.T) {
+	e, fake := newTestExtractor(t, 1<<30)
+	archive := buildZip(t, []archiveTestEntry{
+		{name: "bomb.bin", data: make([]byte, extractRatioMinSize+1<<20)},
+		{name: "ok.txt", data: []byte("hello")},
+	})
+
+	if err := e.extractZip(bytes.NewReader(archive)); err != nil {
+		t.Fatalf("extractZip() error = %v", err)
+	}
+	if got := fake.written(); len(got) != 1 || got[0] != "p/ok.txt" {
+		t.Fatalf("written keys = %v, want only p/ok.txt", got)
+	}
+	if got := entryStatus(e.report)["bomb.bin"]; got != "skipped "+errExtractRatio.Error() {
+		t.Errorf("bomb.bin = %q, want skipped for its compression ratio", got)
+	}
+}
+
+func TestExtractZipDeclaredSizeLimit(t *testing.T) {
+	// L'archive est petite mais ses tailles déclarées dépassent la limite : rien n'est envoyé
+	e, fake := newTestExtractor(t, 1000)
+	archive := buildZip(t, []archiveTestEntry{
+		{name: "a.bin", data: make([]byte, 600)},
+		{name: "b.bin", data: make([]byte, 600)},
+	})
+	if len(archive) > 1000 {
+		t.Fatalf("test archive is %d bytes, want it under the limit", len(archive))
+	}
+
+	err := e.extractZip(bytes.NewReader(archive))
+	if err == nil || !strings.Contains(err.Error(), "expands beyond") {
+		t.Fatalf("extractZip() error = %v, want the declared size limit", err)
+	}
+	if got := fake.written(); len(got) != 0 {
+		t.Errorf("written keys = %v, want none", got)
+	}
+}
+
+func TestExtractZipArchiveSizeLimit(t *testing.T) {
+	e, fake := newTestExtractor(t, 100)
+	archive := buildZip(t, []archiveTestEntry{{name: "a.txt", data: []byte(strings.Repeat("incompressible? ", 20))}})
+
+	err := e.extractZip(bytes.NewReader(archive))
+	if err == nil || !strings.Contains(err.Error(), "archive is larger than") {
+		t.Fatalf("extractZip() error = %v, want the archive size limit", err)
+	}
+	if got := fake.written(); len(got) != 0 {
+		t.Errorf("written keys = %v, want none", got)
+	}
+}
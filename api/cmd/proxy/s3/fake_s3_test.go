@@ -0,0 +1,218 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeS3 is an in-memory S3 endpoint for behaviour tests. It serves path-style HEAD, GET,
+// single-part PUT (honouring If-Match / If-None-Match) and ListObjectsV2.
+type fakeS3 struct {
+	url     string
+	mu      sync.Mutex
+	objects map[string]fakeObject // "bucket/key"
+	puts    []string              // Clés écrites, dans l'ordre
+
+	// Répond 501 aux PUT conditionnels, comme un backend qui ne gère pas If-None-Match
+	rejectConditional bool
+	// Nombre de HEAD à venir qui ignorent l'objet, pour simuler une écriture concurrente
+	staleHeads int
+}
+
+type fakeObject struct {
+	data     []byte
+	etag     string
+	header   http.Header // Content-Type et x-amz-meta-*
+	modified time.Time
+}
+
+// newFakeS3 starts a fake endpoint and returns an anonymous client pointed at it
+func newFakeS3(t *testing.T) (*fakeS3, *minio.Client) {
+	t.Helper()
+	f := &fakeS3{objects: map[string]fakeObject{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	f.url = server.URL
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStatic("", "", "", credentials.SignatureAnonymous),
+		Region: "us-east-1",
+		// Pas de nouvelle tentative : les erreurs voulues par les tests remontent tout de suite
+		MaxRetries: 1,
+	})
+	if err != nil {
+		t.Fatalf("minio.New() error = %v", err)
+	}
+	return f, client
+}
+
+// config returns a project configuration pointing at the fake, for handler tests
+func (f *fakeS3) config() S3ConfigData {
+	return S3ConfigData{ID: 1, S3URL: f.url, ClientID: "test", ClientSecret: "test", Region: "us-east-1", ForcePathStyle: true}
+}
+
+// seed stores an object directly, without going through a PUT
+func (f *fakeS3) seed(bucket, key string, data []byte, header http.Header) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.store(bucket+"/"+key, data, header)
+}
+
+func (f *fakeS3) store(path string, data []byte, header http.Header) fakeObject {
+	sum := md5.Sum(data)
+	if header == nil {
+		header = http.Header{}
+	}
+	object := fakeObject{data: data, etag: hex.EncodeToString(sum[:]), header: header, modified: time.Now().UTC().Truncate(time.Second)}
+	f.objects[path] = object
+	return object
+}
+
+// get returns a stored object
+func (f *fakeS3) get(bucket, key string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.objects[bucket+"/"+key]
+	return object, ok
+}
+
+// written returns the keys written through PUT, in order
+func (f *fakeS3) written() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.puts...)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	path := bucket + "/" + key
+	object, exists := f.objects[path]
+	if r.Method == http.MethodHead && f.staleHeads > 0 {
+		f.staleHeads--
+		exists = false
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		f.list(w, bucket, r.URL.Query())
+
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		if !exists {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchKey", r.Method)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && strings.Trim(match, `"`) != object.etag {
+			fakeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed", r.Method)
+			return
+		}
+		for name, values := range object.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", `"`+object.etag+`"`)
+		w.Header().Set("Last-Modified", object.modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+
+	case r.Method == http.MethodPut && key != "" && r.URL.RawQuery == "":
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if f.rejectConditional && (ifMatch != "" || ifNoneMatch != "") {
+			fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", r.Method)
+			return
+		}
+		if (ifNoneMatch == "*" && exists) ||
+			(ifMatch != "" && (!exists || strings.Trim(ifMatch, `"`) != object.etag)) {
+			fakeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed", r.Method)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			fakeS3Error(w, http.StatusBadRequest, "IncompleteBody", r.Method)
+			return
+		}
+		header := http.Header{}
+		for name, values := range r.Header {
+			if name == "Content-Type" || strings.HasPrefix(name, "X-Amz-Meta-") {
+				header[name] = values
+			}
+		}
+		stored := f.store(path, data, header)
+		f.puts = append(f.puts, key)
+		w.Header().Set("ETag", `"`+stored.etag+`"`)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", r.Method)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket string, query map[string][]string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+		StorageClass string
+	}
+	result := struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Name     string
+		Prefix   string
+		KeyCount int
+		MaxKeys  int
+		Contents []content
+	}{Name: bucket, MaxKeys: 1000}
+
+	prefix, startAfter := "", ""
+	if v := query["prefix"]; len(v) > 0 {
+		prefix = v[0]
+	}
+	if v := query["start-after"]; len(v) > 0 {
+		startAfter = v[0]
+	}
+	result.Prefix = prefix
+	for path, object := range f.objects {
+		b, key, _ := strings.Cut(path, "/")
+		if b != bucket || !strings.HasPrefix(key, prefix) || key <= startAfter {
+			continue
+		}
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: object.modified.Format(time.RFC3339),
+			ETag:         `"` + object.etag + `"`,
+			Size:         len(object.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func fakeS3Error(w http.ResponseWriter, status int, code, method string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if method != http.MethodHead {
+		io.WriteString(w, "<Error><Code>"+code+"</Code><Message>"+code+"</Message></Error>")
+	}
+}
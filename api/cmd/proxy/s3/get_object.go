@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -21,6 +22,12 @@ func HandleGetObject() http.HandlerFunc {
 			return
 		}
 
+		// Un navigateur ne peut pas envoyer les en-têtes SSE-C avec une URL présignée
+		if req.SSECustomerKey != "" || req.SSEKeyName != "" {
+			http.Error(w, "SSE-C objects cannot be fetched through a presigned URL, use download-object", http.StatusBadRequest)
+			return
+		}
+
 		// Valider le token et récupérer l'user ID
 		userID, err := ValidateTokenFunc(r)
 		if err != nil {
@@ -47,13 +54,21 @@ func HandleGetObject() http.HandlerFunc {
 			return
 		}
 
-		presignedURL, err := client.PresignedGetObject(r.Context(), req.Bucket, req.Key, 15*time.Minute, nil)
+		expiry := PresignExpiry(req.ExpiresIn)
+		var reqParams url.Values
+		if req.VersionID != "" {
+			reqParams = url.Values{"versionId": {req.VersionID}}
+		}
+		presignedURL, err := client.PresignedGetObject(r.Context(), req.Bucket, req.Key, expiry, reqParams)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to presign get object: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		resp := GetObjectResponse{PresignedURL: presignedURL.String()}
+		resp := GetObjectResponse{
+			PresignedURL: presignedURL.String(),
+			ExpiresAt:    time.Now().Add(expiry).Format(time.RFC3339),
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
@@ -73,6 +88,12 @@ func HandleGetObjectWithConfig(config S3ConfigData) http.HandlerFunc {
 			return
 		}
 
+		// Un navigateur ne peut pas envoyer les en-têtes SSE-C avec une URL présignée
+		if req.SSECustomerKey != "" || req.SSEKeyName != "" {
+			http.Error(w, "SSE-C objects cannot be fetched through a presigned URL, use download-object", http.StatusBadRequest)
+			return
+		}
+
 		creds, err := GetS3Credentials(config, req.KeyId, req.Token)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
@@ -85,13 +106,21 @@ func HandleGetObjectWithConfig(config S3ConfigData) http.HandlerFunc {
 			return
 		}
 
-		presignedURL, err := client.PresignedGetObject(r.Context(), req.Bucket, req.Key, 15*time.Minute, nil)
+		expiry := PresignExpiry(req.ExpiresIn)
+		var reqParams url.Values
+		if req.VersionID != "" {
+			reqParams = url.Values{"versionId": {req.VersionID}}
+		}
+		presignedURL, err := client.PresignedGetObject(r.Context(), req.Bucket, req.Key, expiry, reqParams)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to presign get object: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		resp := GetObjectResponse{PresignedURL: presignedURL.String()}
+		resp := GetObjectResponse{
+			PresignedURL: presignedURL.String(),
+			ExpiresAt:    time.Now().Add(expiry).Format(time.RFC3339),
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
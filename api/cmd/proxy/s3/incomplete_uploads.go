@@ -0,0 +1,220 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	incompleteUploadsDefaultLimit = 1000
+	incompleteUploadsMaxLimit     = 10000
+	// ListObjectParts par upload pour calculer sa taille : appels bornés en parallèle
+	incompleteUploadsSizeConcurrency = 8
+)
+
+// incompleteUploadSize sums the parts already stored for an upload
+func incompleteUploadSize(ctx context.Context, core minio.Core, bucket, key, uploadID string) (int64, int, error) {
+	var size int64
+	parts, marker := 0, 0
+	for {
+		result, err := core.ListObjectParts(ctx, bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, p := range result.ObjectParts {
+			size += p.Size
+			parts++
+		}
+		if !result.IsTruncated {
+			return size, parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// fillIncompleteUploadSizes computes the size of each upload with bounded concurrency. An upload
+// aborted in the meantime keeps a zero size.
+func fillIncompleteUploadSizes(ctx context.Context, client *minio.Client, bucket string, uploads []IncompleteUpload) {
+	core := minio.Core{Client: client}
+	sem := make(chan struct{}, incompleteUploadsSizeConcurrency)
+	var wg sync.WaitGroup
+	for i := range uploads {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(u *IncompleteUpload) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			u.Size, u.Parts, _ = incompleteUploadSize(ctx, core, bucket, u.Key, u.UploadID)
+		}(&uploads[i])
+	}
+	wg.Wait()
+}
+
+// HandleListIncompleteUploadsWithConfig lists the multipart uploads never completed nor aborted
+// in a bucket, with the size of their stored parts and their initiation date
+func HandleListIncompleteUploadsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ListIncompleteUploadsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+		if req.OlderThanHours < 0 {
+			http.Error(w, "olderThanHours must not be negative", http.StatusBadRequest)
+			return
+		}
+		limit := req.Limit
+		if limit <= 0 {
+			limit = incompleteUploadsDefaultLimit
+		}
+		if limit > incompleteUploadsMaxLimit {
+			limit = incompleteUploadsMaxLimit
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		cutoff := time.Now().Add(-time.Duration(req.OlderThanHours) * time.Hour)
+		uploads := []IncompleteUpload{}
+		truncated := false
+		for upload := range client.ListIncompleteUploads(r.Context(), req.Bucket, req.Prefix, true) {
+			if upload.Err != nil {
+				http.Error(w, fmt.Sprintf("Failed to list incomplete uploads: %v", upload.Err), http.StatusBadGateway)
+				return
+			}
+			if req.OlderThanHours > 0 && !upload.Initiated.Before(cutoff) {
+				continue
+			}
+			if len(uploads) == limit {
+				truncated = true
+				break
+			}
+			uploads = append(uploads, IncompleteUpload{
+				Key:          upload.Key,
+				UploadID:     upload.UploadID,
+				Initiated:    upload.Initiated.Format(time.RFC3339),
+				StorageClass: upload.StorageClass,
+			})
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+
+		fillIncompleteUploadSizes(r.Context(), client, req.Bucket, uploads)
+		var totalSize int64
+		for _, u := range uploads {
+			totalSize += u.Size
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListIncompleteUploadsResponse{
+			Uploads:     uploads,
+			TotalSize:   totalSize,
+			IsTruncated: truncated,
+		})
+	}
+}
+
+// HandleAbortIncompleteUploadsWithConfig aborts the listed uploads, or every upload of the
+// bucket (optionally under a prefix) initiated more than olderThanHours ago
+func HandleAbortIncompleteUploadsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req AbortIncompleteUploadsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+		// Pas de valeur par défaut : un appel sans critère ne doit pas tout annuler
+		if len(req.Uploads) == 0 && req.OlderThanHours <= 0 {
+			http.Error(w, "uploads or olderThanHours is required", http.StatusBadRequest)
+			return
+		}
+		for _, u := range req.Uploads {
+			if u.Key == "" || u.UploadID == "" {
+				http.Error(w, "each upload needs key and uploadId", http.StatusBadRequest)
+				return
+			}
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+		ctx := r.Context()
+
+		targets := req.Uploads
+		if len(targets) == 0 {
+			cutoff := time.Now().Add(-time.Duration(req.OlderThanHours) * time.Hour)
+			for upload := range client.ListIncompleteUploads(ctx, req.Bucket, req.Prefix, true) {
+				if upload.Err != nil {
+					http.Error(w, fmt.Sprintf("Failed to list incomplete uploads: %v", upload.Err), http.StatusBadGateway)
+					return
+				}
+				if upload.Initiated.Before(cutoff) {
+					targets = append(targets, IncompleteUploadRef{Key: upload.Key, UploadID: upload.UploadID})
+				}
+			}
+		}
+
+		core := minio.Core{Client: client}
+		resp := AbortIncompleteUploadsResponse{Failed: []AbortIncompleteUploadFailure{}}
+		for _, u := range targets {
+			if ctx.Err() != nil {
+				return
+			}
+			err := core.AbortMultipartUpload(ctx, req.Bucket, u.Key, u.UploadID)
+			if err != nil && minio.ToErrorResponse(err).Code != "NoSuchUpload" {
+				resp.Failed = append(resp.Failed, AbortIncompleteUploadFailure{Key: u.Key, UploadID: u.UploadID, Error: err.Error()})
+				continue
+			}
+			// Upload suivi par kexamanager (chunked ou tus) : ne plus le proposer à la reprise
+			if UploadAbortedFunc != nil {
+				UploadAbortedFunc(config.ID, u.UploadID)
+			}
+			// Déjà terminé ou annulé ailleurs : rien à libérer
+			if err != nil {
+				continue
+			}
+			resp.Aborted++
+		}
+
+		if LogActionFunc != nil {
+			status := "success"
+			if len(resp.Failed) > 0 {
+				status = "error"
+			}
+			LogActionFunc(config.ID, config.UserID, "abort_incomplete_uploads", fmt.Sprintf("Aborted %d incomplete uploads in bucket %s (%d failed)", resp.Aborted, req.Bucket, len(resp.Failed)), status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
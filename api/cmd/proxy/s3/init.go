@@ -5,7 +5,13 @@ import "net/http"
 // Fonctions à initialiser depuis main
 var ValidateTokenFunc func(*http.Request) (uint, error)
 var GetS3ConfigFunc func(uint, uint) (S3ConfigData, error)
-var LogActionFunc func(uint, uint, string, string, string) error // projectID, userID, action, details, status
+var LogActionFunc func(uint, uint, string, string, string) error                // projectID, userID, action, details, status
+var ResolveSSEKeyFunc func(uint, string) ([]byte, error)                        // projectID, nom de la clé -> clé SSE-C déchiffrée
+var ObjectChangedFunc func(uint, ObjectChange)                                  // projectID, écriture faite via kexamanager (index des clés)
+var ObjectTrashedFunc func(uint, TrashedObject) error                           // projectID, objet déplacé dans la corbeille
+var BucketProtectedFunc func(uint, string) (bool, error)                        // projectID, bucket -> suppression interdite
+var ForceDeleteBucketFunc func(S3ConfigData, string, bool) (interface{}, error) // bucket, bypassGovernance : vide puis supprime un bucket en arrière-plan -> job
+var UploadAbortedFunc func(uint, string)                                        // projectID, uploadID d'un upload multipart annulé
 
 // InitHandlers initialise les fonctions nécessaires pour les handlers
 func InitHandlers(validateFunc func(*http.Request) (uint, error), getConfigFunc func(uint, uint) (S3ConfigData, error), logFunc func(uint, uint, string, string, string) error) {
@@ -0,0 +1,523 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+const (
+	lifecycleStatusEnabled  = "Enabled"
+	lifecycleStatusDisabled = "Disabled"
+
+	maxLifecycleRules      = 1000
+	defaultPreviewLimit    = 1000
+	previewTagBatchSize    = 100
+	lifecycleDateLayout    = "2006-01-02"
+	lifecycleNoSuchConfig  = "NoSuchLifecycleConfiguration"
+	lifecycleRuleIDMaxSize = 255
+)
+
+// lifecycleSchema describes LifecycleRule for the frontend editor (JSON Schema draft 2020-12)
+const lifecycleSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "Lifecycle rules",
+  "type": "array",
+  "maxItems": 1000,
+  "items": {
+    "type": "object",
+    "required": ["id"],
+    "additionalProperties": false,
+    "properties": {
+      "id": {"type": "string", "maxLength": 255, "title": "Rule ID"},
+      "status": {"type": "string", "enum": ["Enabled", "Disabled"], "default": "Enabled"},
+      "prefix": {"type": "string", "title": "Key prefix", "description": "Empty applies the rule to the whole bucket"},
+      "tags": {"type": "object", "additionalProperties": {"type": "string"}, "title": "Only objects carrying all these tags"},
+      "expirationDays": {"type": "integer", "minimum": 1, "title": "Expire current versions after N days"},
+      "expirationDate": {"type": "string", "format": "date", "title": "Expire current versions on this date (UTC)"},
+      "expiredObjectDeleteMarker": {"type": "boolean", "title": "Remove delete markers left without noncurrent versions"},
+      "noncurrentExpirationDays": {"type": "integer", "minimum": 1, "title": "Delete noncurrent versions after N days"},
+      "newerNoncurrentVersions": {"type": "integer", "minimum": 1, "title": "Keep this many newest noncurrent versions"},
+      "abortIncompleteUploadDays": {"type": "integer", "minimum": 1, "title": "Abort incomplete multipart uploads after N days"}
+    }
+  }
+}`
+
+// toMinioLifecycle converts editable rules into a minio lifecycle configuration.
+// Rules must have been validated with validateLifecycleRules.
+func toMinioLifecycle(rules []LifecycleRule) *lifecycle.Configuration {
+	config := lifecycle.NewConfiguration()
+	for _, rule := range rules {
+		status := rule.Status
+		if status == "" {
+			status = lifecycleStatusEnabled
+		}
+		r := lifecycle.Rule{ID: rule.ID, Status: status}
+
+		// Un filtre And est requis dès qu'il y a plusieurs critères
+		tagKeys := make([]string, 0, len(rule.Tags))
+		for k := range rule.Tags {
+			tagKeys = append(tagKeys, k)
+		}
+		sort.Strings(tagKeys)
+		switch {
+		case len(tagKeys) == 0:
+			r.RuleFilter.Prefix = rule.Prefix
+		case len(tagKeys) == 1 && rule.Prefix == "":
+			r.RuleFilter.Tag = lifecycle.Tag{Key: tagKeys[0], Value: rule.Tags[tagKeys[0]]}
+		default:
+			r.RuleFilter.And.Prefix = rule.Prefix
+			for _, k := range tagKeys {
+				r.RuleFilter.And.Tags = append(r.RuleFilter.And.Tags, lifecycle.Tag{Key: k, Value: rule.Tags[k]})
+			}
+		}
+
+		if rule.ExpirationDays > 0 {
+			r.Expiration.Days = lifecycle.ExpirationDays(rule.ExpirationDays)
+		}
+		if rule.ExpirationDate != "" {
+			date, _ := time.Parse(lifecycleDateLayout, rule.ExpirationDate)
+			r.Expiration.Date = lifecycle.ExpirationDate{Time: date}
+		}
+		if rule.ExpiredObjectDeleteMarker {
+			r.Expiration.DeleteMarker = true
+		}
+		if rule.NoncurrentExpirationDays > 0 {
+			r.NoncurrentVersionExpiration.NoncurrentDays = lifecycle.ExpirationDays(rule.NoncurrentExpirationDays)
+			r.NoncurrentVersionExpiration.NewerNoncurrentVersions = rule.NewerNoncurrentVersions
+		}
+		if rule.AbortIncompleteUploadDays > 0 {
+			r.AbortIncompleteMultipartUpload.DaysAfterInitiation = lifecycle.ExpirationDays(rule.AbortIncompleteUploadDays)
+		}
+		config.Rules = append(config.Rules, r)
+	}
+	return config
+}
+
+// unsupportedLifecycleRules returns the IDs of the rules using actions or filters the editor
+// does not model (transitions, size filters...). They would be lost by a read-modify-write.
+func unsupportedLifecycleRules(config *lifecycle.Configuration) []string {
+	ids := []string{}
+	for _, r := range config.Rules {
+		if !r.Transition.IsNull() ||
+			r.NoncurrentVersionTransition.StorageClass != "" || r.NoncurrentVersionTransition.NoncurrentDays != 0 ||
+			!r.DelMarkerExpiration.IsNull() || !r.AllVersionsExpiration.IsNull() ||
+			r.Expiration.DeleteAll.IsEnabled() ||
+			r.RuleFilter.ObjectSizeLessThan != 0 || r.RuleFilter.ObjectSizeGreaterThan != 0 ||
+			r.RuleFilter.And.ObjectSizeLessThan != 0 || r.RuleFilter.And.ObjectSizeGreaterThan != 0 {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// fromMinioLifecycle converts a lifecycle configuration read from S3 into editable rules.
+// Actions kexamanager does not edit (transitions...) are not represented: see
+// unsupportedLifecycleRules.
+func fromMinioLifecycle(config *lifecycle.Configuration) []LifecycleRule {
+	rules := []LifecycleRule{}
+	for _, r := range config.Rules {
+		rule := LifecycleRule{
+			ID:                        r.ID,
+			Status:                    r.Status,
+			ExpirationDays:            int(r.Expiration.Days),
+			ExpiredObjectDeleteMarker: r.Expiration.DeleteMarker.IsEnabled(),
+			NoncurrentExpirationDays:  int(r.NoncurrentVersionExpiration.NoncurrentDays),
+			NewerNoncurrentVersions:   r.NoncurrentVersionExpiration.NewerNoncurrentVersions,
+			AbortIncompleteUploadDays: int(r.AbortIncompleteMultipartUpload.DaysAfterInitiation),
+		}
+		if !r.Expiration.Date.IsZero() {
+			rule.ExpirationDate = r.Expiration.Date.UTC().Format(lifecycleDateLayout)
+		}
+
+		// Prefix peut être au niveau de la règle (ancien format), du filtre ou du And
+		rule.Prefix = r.Prefix
+		if r.RuleFilter.Prefix != "" {
+			rule.Prefix = r.RuleFilter.Prefix
+		}
+		if r.RuleFilter.And.Prefix != "" {
+			rule.Prefix = r.RuleFilter.And.Prefix
+		}
+		tags := map[string]string{}
+		if r.RuleFilter.Tag.Key != "" {
+			tags[r.RuleFilter.Tag.Key] = r.RuleFilter.Tag.Value
+		}
+		for _, t := range r.RuleFilter.And.Tags {
+			tags[t.Key] = t.Value
+		}
+		if len(tags) > 0 {
+			rule.Tags = tags
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// validateLifecycleRules checks rules against the constraints S3 enforces, so the user gets
+// every problem at once instead of the first opaque MalformedXML from the server
+func validateLifecycleRules(rules []LifecycleRule) []string {
+	errs := []string{}
+	if len(rules) > maxLifecycleRules {
+		errs = append(errs, fmt.Sprintf("at most %d rules are allowed", maxLifecycleRules))
+	}
+
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		name := fmt.Sprintf("rule %d", i+1)
+		if rule.ID != "" {
+			name = fmt.Sprintf("rule %q", rule.ID)
+		}
+
+		switch {
+		case strings.TrimSpace(rule.ID) == "":
+			errs = append(errs, fmt.Sprintf("%s: id is required", name))
+		case len(rule.ID) > lifecycleRuleIDMaxSize:
+			errs = append(errs, fmt.Sprintf("%s: id must be at most %d characters", name, lifecycleRuleIDMaxSize))
+		case seen[rule.ID]:
+			errs = append(errs, fmt.Sprintf("%s: id is used by several rules", name))
+		}
+		seen[rule.ID] = true
+
+		if rule.Status != "" && rule.Status != lifecycleStatusEnabled && rule.Status != lifecycleStatusDisabled {
+			errs = append(errs, fmt.Sprintf("%s: status must be 'Enabled' or 'Disabled'", name))
+		}
+		if len(rule.Tags) > 10 {
+			errs = append(errs, fmt.Sprintf("%s: at most 10 tags are allowed in a filter", name))
+		}
+
+		if rule.ExpirationDays < 0 || rule.NoncurrentExpirationDays < 0 || rule.NewerNoncurrentVersions < 0 || rule.AbortIncompleteUploadDays < 0 {
+			errs = append(errs, fmt.Sprintf("%s: day and version counts must be positive", name))
+		}
+		if rule.ExpirationDays == 0 && rule.ExpirationDate == "" && !rule.ExpiredObjectDeleteMarker &&
+			rule.NoncurrentExpirationDays == 0 && rule.AbortIncompleteUploadDays == 0 {
+			errs = append(errs, fmt.Sprintf("%s: at least one action is required", name))
+		}
+
+		if rule.ExpirationDays > 0 && rule.ExpirationDate != "" {
+			errs = append(errs, fmt.Sprintf("%s: expirationDays and expirationDate are mutually exclusive", name))
+		}
+		if rule.ExpirationDate != "" {
+			if _, err := time.Parse(lifecycleDateLayout, rule.ExpirationDate); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: expirationDate must be formatted YYYY-MM-DD", name))
+			}
+		}
+		if rule.ExpiredObjectDeleteMarker && (rule.ExpirationDays > 0 || rule.ExpirationDate != "") {
+			errs = append(errs, fmt.Sprintf("%s: expiredObjectDeleteMarker cannot be combined with expirationDays or expirationDate", name))
+		}
+		if len(rule.Tags) > 0 && (rule.ExpiredObjectDeleteMarker || rule.AbortIncompleteUploadDays > 0) {
+			errs = append(errs, fmt.Sprintf("%s: expiredObjectDeleteMarker and abortIncompleteUploadDays cannot be used with a tag filter", name))
+		}
+		if rule.NewerNoncurrentVersions > 0 && rule.NoncurrentExpirationDays == 0 {
+			errs = append(errs, fmt.Sprintf("%s: newerNoncurrentVersions requires noncurrentExpirationDays", name))
+		}
+	}
+	return errs
+}
+
+// lifecycleWarnings reports rules that are valid but will not do what the user probably expects
+func lifecycleWarnings(ctx context.Context, client *minio.Client, bucket string, rules []LifecycleRule) []string {
+	warnings := []string{}
+	usesVersions := false
+	for _, rule := range rules {
+		if rule.NoncurrentExpirationDays > 0 || rule.ExpiredObjectDeleteMarker {
+			usesVersions = true
+		}
+		if rule.Status == lifecycleStatusDisabled {
+			warnings = append(warnings, fmt.Sprintf("rule %q is disabled and will not run", rule.ID))
+		}
+		if rule.Prefix == "" && len(rule.Tags) == 0 && (rule.ExpirationDays > 0 || rule.ExpirationDate != "") {
+			warnings = append(warnings, fmt.Sprintf("rule %q expires every object of the bucket", rule.ID))
+		}
+	}
+
+	if usesVersions && client != nil && bucket != "" {
+		versioning, err := client.GetBucketVersioning(ctx, bucket)
+		if err == nil && !versioning.Enabled() {
+			warnings = append(warnings, "versioning is not enabled on this bucket: noncurrent-version and delete-marker actions have no effect")
+		}
+	}
+	return warnings
+}
+
+// expirationTime returns when S3 expires a current version created at lastModified,
+// following the S3 rule of rounding up to the next midnight UTC
+func expirationTime(rule LifecycleRule, lastModified time.Time) (time.Time, bool) {
+	if rule.ExpirationDate != "" {
+		date, err := time.Parse(lifecycleDateLayout, rule.ExpirationDate)
+		return date, err == nil
+	}
+	if rule.ExpirationDays > 0 {
+		t := lastModified.UTC().Add(time.Duration(rule.ExpirationDays) * 24 * time.Hour)
+		if midnight := t.Truncate(24 * time.Hour); !midnight.Equal(t) {
+			t = midnight.Add(24 * time.Hour)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func decodeLifecycleRequest(w http.ResponseWriter, r *http.Request) (BucketLifecycleRequest, bool) {
+	var req BucketLifecycleRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Bucket == "" {
+		http.Error(w, "bucket is required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// HandleLifecycleSchema returns the JSON schema of the lifecycle rules accepted by put-bucket-lifecycle
+func HandleLifecycleSchema() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write([]byte(lifecycleSchema))
+	}
+}
+
+// HandleGetBucketLifecycleWithConfig returns the lifecycle rules of a bucket
+func HandleGetBucketLifecycleWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeLifecycleRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		resp := BucketLifecycleResponse{Rules: []LifecycleRule{}}
+		lc, err := client.GetBucketLifecycle(r.Context(), req.Bucket)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code != lifecycleNoSuchConfig {
+				http.Error(w, fmt.Sprintf("Failed to get bucket lifecycle: %v", err), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			resp.Rules = fromMinioLifecycle(lc)
+			resp.UnsupportedRules = unsupportedLifecycleRules(lc)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandlePutBucketLifecycleWithConfig replaces the lifecycle rules of a bucket (an empty list removes them).
+// It refuses with 409 when the current configuration has rules the editor cannot represent,
+// since replacing it would silently drop their transitions or filters.
+func HandlePutBucketLifecycleWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeLifecycleRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if errs := validateLifecycleRules(req.Rules); len(errs) > 0 {
+			http.Error(w, fmt.Sprintf("Invalid lifecycle rules: %s", strings.Join(errs, "; ")), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		current, err := client.GetBucketLifecycle(r.Context(), req.Bucket)
+		if err != nil && minio.ToErrorResponse(err).Code != lifecycleNoSuchConfig {
+			http.Error(w, fmt.Sprintf("Failed to get bucket lifecycle: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err == nil {
+			if ids := unsupportedLifecycleRules(current); len(ids) > 0 {
+				http.Error(w, fmt.Sprintf("Bucket lifecycle has rules that cannot be edited here (%s): manage them with an S3 client", strings.Join(ids, ", ")), http.StatusConflict)
+				return
+			}
+		}
+
+		// SetBucketLifecycle supprime la configuration quand elle est vide
+		if err := client.SetBucketLifecycle(r.Context(), req.Bucket, toMinioLifecycle(req.Rules)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set bucket lifecycle: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "put_bucket_lifecycle", fmt.Sprintf("Set %d lifecycle rule(s) on bucket %s", len(req.Rules), req.Bucket), "success")
+		}
+
+		rules := req.Rules
+		if rules == nil {
+			rules = []LifecycleRule{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketLifecycleResponse{Rules: rules})
+	}
+}
+
+// HandleValidateBucketLifecycleWithConfig checks rules without applying them. Errors are what
+// S3 would reject, warnings flag rules that are accepted but probably not intended.
+func HandleValidateBucketLifecycleWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req BucketLifecycleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Le bucket est optionnel : il sert seulement à vérifier l'état du versioning
+		var client *minio.Client
+		if req.Bucket != "" {
+			if creds, err := GetS3Credentials(config, req.KeyId, req.Token); err == nil {
+				client, _ = CreateS3Client(creds)
+			}
+		}
+
+		errs := validateLifecycleRules(req.Rules)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LifecycleValidationResponse{
+			Valid:    len(errs) == 0,
+			Errors:   errs,
+			Warnings: lifecycleWarnings(r.Context(), client, req.Bucket, req.Rules),
+		})
+	}
+}
+
+// HandlePreviewBucketLifecycleWithConfig lists the current objects a rule applies to and
+// when each one would expire, without changing the bucket configuration
+func HandlePreviewBucketLifecycleWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req LifecyclePreviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+		if req.Rule.ID == "" {
+			req.Rule.ID = "preview"
+		}
+		if errs := validateLifecycleRules([]LifecycleRule{req.Rule}); len(errs) > 0 {
+			http.Error(w, fmt.Sprintf("Invalid lifecycle rule: %s", strings.Join(errs, "; ")), http.StatusBadRequest)
+			return
+		}
+
+		limit := req.Limit
+		if limit <= 0 {
+			limit = defaultPreviewLimit
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		ctx := r.Context()
+		now := time.Now()
+		resp := LifecyclePreviewResponse{Objects: []LifecyclePreviewObject{}}
+
+		addObjects := func(batch []S3Object) error {
+			if len(req.Rule.Tags) > 0 {
+				// Un aperçu incomplet serait trompeur : les tags illisibles font échouer l'aperçu
+				if failed := attachObjectTags(ctx, client, req.Bucket, batch); failed > 0 {
+					return fmt.Errorf("failed to read the tags of %d objects", failed)
+				}
+				batch = filterObjectsByTags(batch, req.Rule.Tags)
+			}
+			for _, obj := range batch {
+				lastModified, _ := time.Parse(time.RFC3339, obj.LastModified)
+				item := LifecyclePreviewObject{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}
+				if expiresAt, ok := expirationTime(req.Rule, lastModified); ok {
+					item.ExpiresAt = expiresAt.Format(time.RFC3339)
+					item.Expired = !expiresAt.After(now)
+				}
+				resp.Matched++
+				if item.Expired {
+					resp.Expired++
+				}
+				if len(resp.Objects) < limit {
+					resp.Objects = append(resp.Objects, item)
+				} else {
+					resp.Truncated = true
+				}
+			}
+			return nil
+		}
+
+		batch := make([]S3Object, 0, previewTagBatchSize)
+		for object := range client.ListObjects(ctx, req.Bucket, minio.ListObjectsOptions{Prefix: req.Rule.Prefix, Recursive: true}) {
+			if object.Err != nil {
+				http.Error(w, fmt.Sprintf("Failed to list objects: %v", object.Err), http.StatusInternalServerError)
+				return
+			}
+			batch = append(batch, S3Object{
+				Key:          object.Key,
+				Size:         object.Size,
+				LastModified: object.LastModified.Format(time.RFC3339),
+				ETag:         object.ETag,
+			})
+			if len(batch) == previewTagBatchSize {
+				if err := addObjects(batch); err != nil {
+					http.Error(w, fmt.Sprintf("Failed to get object tags: %v", err), http.StatusInternalServerError)
+					return
+				}
+				batch = make([]S3Object, 0, previewTagBatchSize)
+			}
+		}
+		if err := addObjects(batch); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get object tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if req.Rule.AbortIncompleteUploadDays > 0 {
+			cutoff := now.Add(-time.Duration(req.Rule.AbortIncompleteUploadDays) * 24 * time.Hour)
+			for upload := range client.ListIncompleteUploads(ctx, req.Bucket, req.Rule.Prefix, true) {
+				if upload.Err != nil {
+					http.Error(w, fmt.Sprintf("Failed to list incomplete uploads: %v", upload.Err), http.StatusInternalServerError)
+					return
+				}
+				if upload.Initiated.Before(cutoff) {
+					resp.IncompleteUploads++
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -61,6 +61,9 @@ func HandleListObjects() http.HandlerFunc {
 				http.Error(w, fmt.Sprintf("Failed to list objects: %v", object.Err), http.StatusInternalServerError)
 				return
 			}
+			if isTrashKey(object.Key) && !isTrashKey(req.Prefix) {
+				continue
+			}
 			objects = append(objects, S3Object{
 				Key:          object.Key,
 				Size:         object.Size,
@@ -69,6 +72,14 @@ func HandleListObjects() http.HandlerFunc {
 			})
 		}
 
+		tagErrors := 0
+		if req.IncludeTags || len(req.TagFilter) > 0 {
+			tagErrors = attachObjectTags(r.Context(), client, req.Bucket, objects)
+			if len(req.TagFilter) > 0 {
+				objects = filterObjectsByTags(objects, req.TagFilter)
+			}
+		}
+
 		// Calculate total bucket size by listing all objects without prefix
 		totalOpts := minio.ListObjectsOptions{}
 		totalObjectCh := client.ListObjects(r.Context(), req.Bucket, totalOpts)
@@ -85,6 +96,7 @@ func HandleListObjects() http.HandlerFunc {
 		resp := ListObjectsResponse{
 			Objects:   objects,
 			TotalSize: totalSize,
+			TagErrors: tagErrors,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -130,6 +142,9 @@ func HandleListObjectsWithConfig(config S3ConfigData) http.HandlerFunc {
 				http.Error(w, fmt.Sprintf("Failed to list objects: %v", object.Err), http.StatusInternalServerError)
 				return
 			}
+			if isTrashKey(object.Key) && !isTrashKey(req.Prefix) {
+				continue
+			}
 			objects = append(objects, S3Object{
 				Key:          object.Key,
 				Size:         object.Size,
@@ -138,6 +153,14 @@ func HandleListObjectsWithConfig(config S3ConfigData) http.HandlerFunc {
 			})
 		}
 
+		tagErrors := 0
+		if req.IncludeTags || len(req.TagFilter) > 0 {
+			tagErrors = attachObjectTags(r.Context(), client, req.Bucket, objects)
+			if len(req.TagFilter) > 0 {
+				objects = filterObjectsByTags(objects, req.TagFilter)
+			}
+		}
+
 		// Calculate total bucket size by listing all objects without prefix
 		totalOpts := minio.ListObjectsOptions{}
 		totalObjectCh := client.ListObjects(r.Context(), req.Bucket, totalOpts)
@@ -154,6 +177,7 @@ func HandleListObjectsWithConfig(config S3ConfigData) http.HandlerFunc {
 		resp := ListObjectsResponse{
 			Objects:   objects,
 			TotalSize: totalSize,
+			TagErrors: tagErrors,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
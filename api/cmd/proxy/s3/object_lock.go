@@ -0,0 +1,376 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// objectLockNotFound is returned by GetObjectLockConfig for buckets created without object lock
+const objectLockNotFound = "ObjectLockConfigurationNotFoundError"
+
+// toLockConfig converts a default retention into the arguments of SetObjectLockConfig
+// (all nil to clear the default retention)
+func toLockConfig(retention *DefaultRetention) (*minio.RetentionMode, *uint, *minio.ValidityUnit, error) {
+	if retention == nil {
+		return nil, nil, nil, nil
+	}
+	mode := minio.RetentionMode(strings.ToUpper(retention.Mode))
+	if !mode.IsValid() {
+		return nil, nil, nil, fmt.Errorf("retention mode must be 'GOVERNANCE' or 'COMPLIANCE'")
+	}
+	if (retention.Days == 0) == (retention.Years == 0) {
+		return nil, nil, nil, fmt.Errorf("exactly one of days or years is required")
+	}
+	validity, unit := retention.Days, minio.Days
+	if retention.Years > 0 {
+		validity, unit = retention.Years, minio.Years
+	}
+	return &mode, &validity, &unit, nil
+}
+
+// makeBucket creates a bucket, with object lock and its default retention when requested
+func makeBucket(ctx context.Context, client *minio.Client, region string, req CreateBucketRequest) error {
+	mode, validity, unit, err := toLockConfig(req.DefaultRetention)
+	if err != nil {
+		return err
+	}
+	if err := client.MakeBucket(ctx, req.Bucket, minio.MakeBucketOptions{Region: region, ObjectLocking: req.ObjectLocking}); err != nil {
+		return err
+	}
+	if mode != nil {
+		if err := client.SetObjectLockConfig(ctx, req.Bucket, mode, validity, unit); err != nil {
+			return fmt.Errorf("bucket created but default retention could not be set: %v", err)
+		}
+	}
+	return nil
+}
+
+// retentionBlockReason explains why a deletion refused by S3 is blocked by object lock,
+// or returns "" when the object carries neither legal hold nor active retention
+func retentionBlockReason(ctx context.Context, client *minio.Client, bucket, key, versionID string, bypassGovernance bool) string {
+	if status, err := client.GetObjectLegalHold(ctx, bucket, key, minio.GetObjectLegalHoldOptions{VersionID: versionID}); err == nil && status != nil && *status == minio.LegalHoldEnabled {
+		return "Object is under legal hold: remove the legal hold before deleting it"
+	}
+
+	mode, until, err := client.GetObjectRetention(ctx, bucket, key, versionID)
+	if err != nil || mode == nil || until == nil || !until.After(time.Now()) {
+		return ""
+	}
+	untilStr := until.UTC().Format(time.RFC3339)
+	switch {
+	case *mode == minio.Compliance:
+		return fmt.Sprintf("Object is locked in COMPLIANCE mode until %s and cannot be deleted before that date", untilStr)
+	case bypassGovernance:
+		return fmt.Sprintf("Object is locked in GOVERNANCE mode until %s and these credentials are not allowed to bypass it (s3:BypassGovernanceRetention)", untilStr)
+	default:
+		return fmt.Sprintf("Object is locked in GOVERNANCE mode until %s: retry with bypassGovernance to delete it", untilStr)
+	}
+}
+
+// writeDeleteObjectError reports a failed deletion, with a clear message when object lock is the cause
+func writeDeleteObjectError(w http.ResponseWriter, ctx context.Context, client *minio.Client, req DeleteObjectRequest, err error) {
+	if minio.ToErrorResponse(err).StatusCode == http.StatusForbidden {
+		if reason := retentionBlockReason(ctx, client, req.Bucket, req.Key, req.VersionID, req.BypassGovernance); reason != "" {
+			http.Error(w, reason, http.StatusForbidden)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("Failed to delete object: %v", err), http.StatusInternalServerError)
+}
+
+// HandleGetBucketObjectLockWithConfig reports whether object lock is enabled on a bucket and its default retention
+func HandleGetBucketObjectLockWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req BucketObjectLockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		resp := BucketObjectLockResponse{}
+		enabled, mode, validity, unit, err := client.GetObjectLockConfig(r.Context(), req.Bucket)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code != objectLockNotFound {
+				http.Error(w, fmt.Sprintf("Failed to get object lock configuration: %v", err), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			resp.Enabled = enabled == "Enabled"
+			if mode != nil && validity != nil && unit != nil {
+				resp.DefaultRetention = &DefaultRetention{Mode: string(*mode)}
+				if *unit == minio.Years {
+					resp.DefaultRetention.Years = *validity
+				} else {
+					resp.DefaultRetention.Days = *validity
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandleSetBucketObjectLockWithConfig sets (or clears) the default retention of an object-lock bucket
+func HandleSetBucketObjectLockWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req BucketObjectLockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		mode, validity, unit, err := toLockConfig(req.DefaultRetention)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		// L'object lock ne peut être activé qu'à la création du bucket
+		if err := client.SetObjectLockConfig(r.Context(), req.Bucket, mode, validity, unit); err != nil {
+			if minio.ToErrorResponse(err).Code == objectLockNotFound {
+				http.Error(w, "Object lock is not enabled on this bucket (it can only be enabled at creation)", http.StatusConflict)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to set object lock configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		details := fmt.Sprintf("Removed default retention of bucket %s", req.Bucket)
+		if mode != nil {
+			details = fmt.Sprintf("Set default retention of bucket %s to %s %d %s", req.Bucket, *mode, *validity, *unit)
+		}
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "set_bucket_object_lock", details, "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketObjectLockResponse{Enabled: true, DefaultRetention: req.DefaultRetention})
+	}
+}
+
+func decodeObjectRetentionRequest(w http.ResponseWriter, r *http.Request) (ObjectRetentionRequest, bool) {
+	var req ObjectRetentionRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Bucket == "" || req.Key == "" {
+		http.Error(w, "bucket and key are required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// HandleGetObjectRetentionWithConfig returns the retention mode and date of an object version
+func HandleGetObjectRetentionWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeObjectRetentionRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		resp := ObjectRetentionResponse{}
+		mode, until, err := client.GetObjectRetention(r.Context(), req.Bucket, req.Key, req.VersionID)
+		if err != nil {
+			// Un objet sans rétention renvoie NoSuchObjectLockConfiguration
+			if minio.ToErrorResponse(err).Code != "NoSuchObjectLockConfiguration" {
+				http.Error(w, fmt.Sprintf("Failed to get object retention: %v", err), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			if mode != nil {
+				resp.Mode = string(*mode)
+			}
+			if until != nil {
+				resp.RetainUntilDate = until.UTC().Format(time.RFC3339)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandleSetObjectRetentionWithConfig sets the retention of an object version. A COMPLIANCE
+// retention can only be extended; shortening a GOVERNANCE one requires bypassGovernance.
+func HandleSetObjectRetentionWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeObjectRetentionRequest(w, r)
+		if !ok {
+			return
+		}
+
+		mode := minio.RetentionMode(strings.ToUpper(req.Mode))
+		if !mode.IsValid() {
+			http.Error(w, "mode must be 'GOVERNANCE' or 'COMPLIANCE'", http.StatusBadRequest)
+			return
+		}
+		until, err := time.Parse(time.RFC3339, req.RetainUntilDate)
+		if err != nil {
+			http.Error(w, "retainUntilDate must be an RFC3339 date", http.StatusBadRequest)
+			return
+		}
+		if !until.After(time.Now()) {
+			http.Error(w, "retainUntilDate must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		err = client.PutObjectRetention(r.Context(), req.Bucket, req.Key, minio.PutObjectRetentionOptions{
+			GovernanceBypass: req.BypassGovernance,
+			Mode:             &mode,
+			RetainUntilDate:  &until,
+			VersionID:        req.VersionID,
+		})
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusForbidden {
+				http.Error(w, fmt.Sprintf("Retention change refused (COMPLIANCE retention can only be extended, GOVERNANCE requires bypassGovernance): %v", err), http.StatusForbidden)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to set object retention: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "set_object_retention", fmt.Sprintf("Set %s retention on %s/%s until %s", mode, req.Bucket, req.Key, until.UTC().Format(time.RFC3339)), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ObjectRetentionResponse{Mode: string(mode), RetainUntilDate: until.UTC().Format(time.RFC3339)})
+	}
+}
+
+func decodeLegalHoldRequest(w http.ResponseWriter, r *http.Request) (ObjectLegalHoldRequest, bool) {
+	var req ObjectLegalHoldRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Bucket == "" || req.Key == "" {
+		http.Error(w, "bucket and key are required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// HandleGetObjectLegalHoldWithConfig returns the legal hold status of an object version
+func HandleGetObjectLegalHoldWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeLegalHoldRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		resp := ObjectLegalHoldResponse{Status: string(minio.LegalHoldDisabled)}
+		status, err := client.GetObjectLegalHold(r.Context(), req.Bucket, req.Key, minio.GetObjectLegalHoldOptions{VersionID: req.VersionID})
+		if err != nil {
+			if minio.ToErrorResponse(err).Code != "NoSuchObjectLockConfiguration" {
+				http.Error(w, fmt.Sprintf("Failed to get object legal hold: %v", err), http.StatusInternalServerError)
+				return
+			}
+		} else if status != nil {
+			resp.Status = string(*status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandleSetObjectLegalHoldWithConfig places or removes a legal hold on an object version
+func HandleSetObjectLegalHoldWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeLegalHoldRequest(w, r)
+		if !ok {
+			return
+		}
+
+		status := minio.LegalHoldStatus(strings.ToUpper(req.Status))
+		if !status.IsValid() {
+			http.Error(w, "status must be 'ON' or 'OFF'", http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		if err := client.PutObjectLegalHold(r.Context(), req.Bucket, req.Key, minio.PutObjectLegalHoldOptions{VersionID: req.VersionID, Status: &status}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set object legal hold: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "set_object_legal_hold", fmt.Sprintf("Set legal hold %s on %s/%s", status, req.Bucket, req.Key), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ObjectLegalHoldResponse{Status: string(status)})
+	}
+}
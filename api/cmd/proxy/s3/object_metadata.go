@@ -0,0 +1,244 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// maxCopyObjectSize is the largest object a single CopyObject request can handle (5 GiB)
+const maxCopyObjectSize = 5 << 30
+
+// reservedMetadataPrefix marks the user metadata kexamanager maintains itself (checksums,
+// copy source ETag): clients cannot set it and metadata updates always keep it
+const reservedMetadataPrefix = "kexa-"
+
+// ToObjectMetadata extracts the metadata exposed by kexamanager from a StatObject result
+func ToObjectMetadata(info minio.ObjectInfo) ObjectMetadata {
+	userMetadata := make(map[string]string, len(info.UserMetadata))
+	for k, v := range info.UserMetadata {
+		userMetadata[strings.ToLower(k)] = v
+	}
+	return ObjectMetadata{
+		Key:                info.Key,
+		Size:               info.Size,
+		LastModified:       info.LastModified.Format(time.RFC3339),
+		Encryption:         objectEncryption(info),
+		ETag:               info.ETag,
+		VersionID:          info.VersionID,
+		StorageClass:       info.StorageClass,
+		ContentType:        info.ContentType,
+		CacheControl:       info.Metadata.Get("Cache-Control"),
+		ContentDisposition: info.Metadata.Get("Content-Disposition"),
+		ContentEncoding:    info.Metadata.Get("Content-Encoding"),
+		ContentLanguage:    info.Metadata.Get("Content-Language"),
+		UserMetadata:       userMetadata,
+	}
+}
+
+// CopyInPlace rewrites an object onto itself with the given destination options
+// (metadata replace, tags...). The copy is conditioned on the ETag read from
+// StatObject so a concurrent write is not silently overwritten. Objects larger
+// than 5 GiB are copied with a multipart compose. sse is the SSE-C key the object
+// was read with (nil otherwise); the copy keeps the object's encryption.
+func CopyInPlace(ctx context.Context, client *minio.Client, info minio.ObjectInfo, bucket string, dst minio.CopyDestOptions, sse encrypt.ServerSide) (minio.UploadInfo, error) {
+	dst.Bucket = bucket
+	dst.Object = info.Key
+	return CopyObjectTo(ctx, client, info, bucket, dst, sse)
+}
+
+// CopyObjectTo copies the object described by info (from bucket) to dst.Bucket/dst.Object
+// under the same conditions as CopyInPlace: pinned to the ETag read, encryption kept and
+// multipart compose beyond 5 GiB.
+func CopyObjectTo(ctx context.Context, client *minio.Client, info minio.ObjectInfo, bucket string, dst minio.CopyDestOptions, sse encrypt.ServerSide) (minio.UploadInfo, error) {
+	src := minio.CopySrcOptions{
+		Bucket:     bucket,
+		Object:     info.Key,
+		VersionID:  info.VersionID,
+		MatchETag:  info.ETag,
+		Encryption: sse,
+	}
+	if dst.Encryption == nil {
+		if sse != nil {
+			dst.Encryption = sse
+		} else if objectEncryption(info) == EncryptionSSES3 {
+			dst.Encryption = encrypt.NewSSE()
+		}
+	}
+	if info.Size > maxCopyObjectSize {
+		return client.ComposeObject(ctx, dst, src)
+	}
+	return client.CopyObject(ctx, dst, src)
+}
+
+// HandleStatObjectWithConfig returns the HTTP and user metadata of an object
+func HandleStatObjectWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req StatObjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		creds, err := GetS3Credentials(config, req.KeyId, req.Token)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		client, err := CreateS3Client(creds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		readSSE, err := ResolveReadEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		info, _, err := readSSE.Stat(r.Context(), client, req.Bucket, req.Key, req.VersionID)
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				http.Error(w, "Object not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ToObjectMetadata(info))
+	}
+}
+
+// HandleUpdateObjectMetadataWithConfig edits object metadata in place through a copy-to-self with metadata replace
+func HandleUpdateObjectMetadataWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req UpdateObjectMetadataRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		creds, err := GetS3Credentials(config, req.KeyId, req.Token)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		client, err := CreateS3Client(creds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		readSSE, err := ResolveReadEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		info, sse, err := readSSE.Stat(r.Context(), client, req.Bucket, req.Key, "")
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				http.Error(w, "Object not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Partir des valeurs actuelles : REPLACE efface tout ce qui n'est pas renvoyé
+		current := ToObjectMetadata(info)
+		pick := func(value *string, fallback string) string {
+			if value != nil {
+				return *value
+			}
+			return fallback
+		}
+
+		userMetadata := current.UserMetadata
+		if req.UserMetadata != nil {
+			userMetadata = make(map[string]string, len(req.UserMetadata))
+			for k, v := range req.UserMetadata {
+				k = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(k)), "x-amz-meta-")
+				if k == "" {
+					http.Error(w, "User metadata keys must not be empty", http.StatusBadRequest)
+					return
+				}
+				if strings.HasPrefix(k, reservedMetadataPrefix) {
+					http.Error(w, fmt.Sprintf("User metadata keys starting with %q are reserved", reservedMetadataPrefix), http.StatusBadRequest)
+					return
+				}
+				userMetadata[k] = v
+			}
+			for k, v := range current.UserMetadata {
+				if strings.HasPrefix(k, reservedMetadataPrefix) {
+					userMetadata[k] = v
+				}
+			}
+		}
+
+		dst := minio.CopyDestOptions{
+			ReplaceMetadata:    true,
+			UserMetadata:       userMetadata,
+			ContentType:        pick(req.ContentType, current.ContentType),
+			CacheControl:       pick(req.CacheControl, current.CacheControl),
+			ContentDisposition: pick(req.ContentDisposition, current.ContentDisposition),
+			ContentEncoding:    pick(req.ContentEncoding, current.ContentEncoding),
+			ContentLanguage:    pick(req.ContentLanguage, current.ContentLanguage),
+		}
+
+		if _, err := CopyInPlace(r.Context(), client, info, req.Bucket, dst, sse); err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+				http.Error(w, "Object was modified during the update, please retry", http.StatusConflict)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to update metadata: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		updated, err := client.StatObject(r.Context(), req.Bucket, req.Key, minio.StatObjectOptions{ServerSideEncryption: sse})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		notifyObjectChanged(config, ObjectChange{Bucket: req.Bucket, Key: req.Key, Size: updated.Size, ETag: updated.ETag, LastModified: updated.LastModified})
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "update_object_metadata", fmt.Sprintf("Updated metadata of %s/%s", req.Bucket, req.Key), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ToObjectMetadata(updated))
+	}
+}
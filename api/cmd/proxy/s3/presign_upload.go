@@ -0,0 +1,271 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	defaultPresignExpiry = 15 * time.Minute
+	maxPresignExpiry     = 7 * 24 * time.Hour // Limite imposée par la signature V4
+)
+
+// PresignExpiry convertit une durée en secondes demandée par le client en durée valide pour S3
+func PresignExpiry(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultPresignExpiry
+	}
+	expiry := time.Duration(seconds) * time.Second
+	if expiry > maxPresignExpiry {
+		return maxPresignExpiry
+	}
+	return expiry
+}
+
+// HandlePresignPutWithConfig returns a presigned PUT URL so the browser can upload directly to S3
+func HandlePresignPutWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PutObjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		creds, err := GetS3Credentials(config, req.KeyId, req.Token)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		client, err := CreateS3Client(creds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Le Content-Type est inclus dans la signature : le navigateur doit envoyer exactement celui-ci
+		headers := http.Header{}
+		if req.ContentType != "" {
+			headers.Set("Content-Type", req.ContentType)
+		}
+		// Le chiffrement par défaut est signé lui aussi, sinon le navigateur écrirait en clair
+		switch config.DefaultEncryption {
+		case EncryptionSSES3:
+			headers.Set("X-Amz-Server-Side-Encryption", "AES256")
+		case EncryptionSSEC:
+			http.Error(w, "presign-put is not available when the project encrypts with SSE-C: the key cannot be handed to the browser", http.StatusBadRequest)
+			return
+		}
+
+		// Création seule : vérification immédiate, puis If-None-Match signé pour que S3 refuse
+		// l'écrasement au moment du PUT s'il le supporte
+		precondition := ResolveWritePrecondition(config, WritePrecondition{IfNoneMatch: req.IfNoneMatch}, req.Overwrite)
+		if precondition.IfNoneMatch != "" {
+			readSSE, err := ResolveReadEncryption(config, SSEOptions{})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := precondition.Check(r.Context(), client, req.Bucket, req.Key, readSSE); err != nil {
+				writeConditionalPutError(w, err)
+				return
+			}
+			headers.Set("If-None-Match", precondition.IfNoneMatch)
+		}
+
+		expiry := PresignExpiry(req.ExpiresIn)
+		presignedURL, err := client.PresignHeader(r.Context(), http.MethodPut, req.Bucket, req.Key, expiry, nil, headers)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to presign put object: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		resp := PutObjectResponse{
+			PresignedURL: presignedURL.String(),
+			ExpiresAt:    time.Now().Add(expiry).Format(time.RFC3339),
+		}
+		if len(headers) > 0 {
+			resp.Headers = map[string]string{}
+			for name := range headers {
+				resp.Headers[name] = headers.Get(name)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandlePresignPostPolicyWithConfig returns a presigned POST policy restricting key, content type and size
+func HandlePresignPostPolicyWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PresignPostPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || (req.Key == "" && req.KeyPrefix == "") {
+			http.Error(w, "bucket and key or keyPrefix are required", http.StatusBadRequest)
+			return
+		}
+		if req.MaxSize < 0 || req.MinSize < 0 || (req.MaxSize > 0 && req.MinSize > req.MaxSize) {
+			http.Error(w, "Invalid size range", http.StatusBadRequest)
+			return
+		}
+
+		creds, err := GetS3Credentials(config, req.KeyId, req.Token)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		client, err := CreateS3Client(creds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Un formulaire POST ne peut pas porter de condition : une vérification faite ici serait
+		// périmée dès que la clé est créée, pendant toute la validité de la politique
+		if config.NeverOverwrite {
+			http.Error(w, "presign-post is not available when the project never overwrites objects: use presign-put", http.StatusBadRequest)
+			return
+		}
+
+		if config.DefaultEncryption == EncryptionSSEC {
+			http.Error(w, "presign-post is not available when the project encrypts with SSE-C: the key cannot be handed to the browser", http.StatusBadRequest)
+			return
+		}
+
+		expiresAt := time.Now().Add(PresignExpiry(req.ExpiresIn)).UTC()
+
+		policy := minio.NewPostPolicy()
+		if err := policy.SetBucket(req.Bucket); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid policy: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Key != "" {
+			err = policy.SetKey(req.Key)
+		} else {
+			err = policy.SetKeyStartsWith(req.KeyPrefix)
+		}
+		if err == nil {
+			err = policy.SetExpires(expiresAt)
+		}
+		if err == nil && req.ContentType != "" {
+			err = policy.SetContentType(req.ContentType)
+		} else if err == nil && req.ContentTypePrefix != "" {
+			err = policy.SetContentTypeStartsWith(req.ContentTypePrefix)
+		}
+		if err == nil && req.MaxSize > 0 {
+			err = policy.SetContentLengthRange(req.MinSize, req.MaxSize)
+		}
+		if err == nil && config.DefaultEncryption == EncryptionSSES3 {
+			policy.SetEncryption(encrypt.NewSSE())
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid policy: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		postURL, formData, err := client.PresignedPostPolicy(r.Context(), policy)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to presign post policy: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		resp := PresignPostPolicyResponse{
+			URL:       postURL.String(),
+			FormData:  formData,
+			ExpiresAt: expiresAt.Format(time.RFC3339),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HandleConfirmUploadWithConfig checks that a direct-to-S3 upload landed and records it in the project log
+func HandleConfirmUploadWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ConfirmUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		creds, err := GetS3Credentials(config, req.KeyId, req.Token)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		client, err := CreateS3Client(creds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		info, err := client.StatObject(r.Context(), req.Bucket, req.Key, minio.StatObjectOptions{})
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				http.Error(w, "Object not found: upload did not complete", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if req.ExpectedSize > 0 && info.Size != req.ExpectedSize {
+			if LogActionFunc != nil {
+				LogActionFunc(config.ID, config.UserID, "upload_file", fmt.Sprintf("Size mismatch for %s/%s: expected %d bytes, got %d", req.Bucket, req.Key, req.ExpectedSize, info.Size), "error")
+			}
+			http.Error(w, fmt.Sprintf("Size mismatch: expected %d bytes, got %d", req.ExpectedSize, info.Size), http.StatusConflict)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "upload_file", fmt.Sprintf("Uploaded file %s/%s (%d bytes, presigned)", req.Bucket, req.Key, info.Size), "success")
+		}
+
+		resp := ConfirmUploadResponse{
+			Success:      true,
+			Size:         info.Size,
+			ETag:         info.ETag,
+			ContentType:  info.ContentType,
+			LastModified: info.LastModified.Format(time.RFC3339),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
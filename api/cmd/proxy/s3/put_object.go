@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,6 +10,44 @@ import (
 	"github.com/minio/minio-go/v7"
 )
 
+// ParseOverwrite reads an optional "overwrite" flag: nil when absent
+func ParseOverwrite(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	overwrite, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("overwrite must be true or false")
+	}
+	return &overwrite, nil
+}
+
+// uploadPreconditionFromForm reads ifMatch / ifNoneMatch / overwrite from the form (or the
+// If-Match / If-None-Match headers) and applies the project "never overwrite" policy.
+// The returned encryption is the one needed to stat the existing object.
+func uploadPreconditionFromForm(r *http.Request, config S3ConfigData) (WritePrecondition, ReadEncryption, error) {
+	overwrite, err := ParseOverwrite(r.FormValue("overwrite"))
+	if err != nil {
+		return WritePrecondition{}, ReadEncryption{}, err
+	}
+	precondition := ResolveWritePrecondition(config, preconditionFromRequest(r, r.FormValue("ifMatch"), r.FormValue("ifNoneMatch")), overwrite)
+	readSSE, err := ResolveReadEncryption(config, SSEOptions{
+		SSECustomerKey: r.FormValue("sseCustomerKey"),
+		SSEKeyName:     r.FormValue("sseKeyName"),
+	})
+	if err != nil {
+		return WritePrecondition{}, ReadEncryption{}, err
+	}
+	return precondition, readSSE, nil
+}
+
+// writeChecksumError answers a rejected upload checksum as JSON
+func writeChecksumError(w http.ResponseWriter, status int, resp ChecksumErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
 // HandlePutObject handles the put object request
 func HandlePutObject() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -128,6 +167,22 @@ func HandlePutObject() http.HandlerFunc {
 			return
 		}
 
+		sse, err := WriteEncryption(config, SSEOptions{
+			SSE:            r.FormValue("sse"),
+			SSECustomerKey: r.FormValue("sseCustomerKey"),
+			SSEKeyName:     r.FormValue("sseKeyName"),
+		})
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			escapedErr := strings.ReplaceAll(fmt.Sprintf("%v", err), `"`, `\"`)
+			escapedErr = strings.ReplaceAll(escapedErr, "\n", "\\n")
+			escapedErr = strings.ReplaceAll(escapedErr, "\r", "\\r")
+			escapedErr = strings.ReplaceAll(escapedErr, "\t", "\\t")
+			w.Write([]byte(fmt.Sprintf(`{"error": "Invalid encryption", "details": "%s"}`, escapedErr)))
+			return
+		}
+
 		contentType := header.Header.Get("Content-Type")
 		if contentType == "" {
 			contentType = "application/octet-stream"
@@ -135,9 +190,36 @@ func HandlePutObject() http.HandlerFunc {
 
 		fmt.Printf("DEBUG: Starting PutObject - bucket: %s, key: %s, fileSize: %d, contentType: %s\n", bucket, key, fileSize, contentType)
 
-		_, err = client.PutObject(r.Context(), bucket, key, file, fileSize, minio.PutObjectOptions{
-			ContentType: contentType,
-		})
+		precondition, readSSE, err := uploadPreconditionFromForm(r, config)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf(`{"error": "Invalid upload options", "details": "%s"}`, strings.ReplaceAll(err.Error(), `"`, `\"`))))
+			return
+		}
+
+		checksums, err := checksumsFromForm(r)
+		if err != nil {
+			writeChecksumError(w, http.StatusBadRequest, ChecksumErrorResponse{Error: "Invalid checksum", Details: err.Error()})
+			return
+		}
+		if err := verifyUploadChecksums(file, checksums); err != nil {
+			if LogActionFunc != nil {
+				LogActionFunc(uint(configID), userID, "upload_file", fmt.Sprintf("Rejected upload to %s/%s: %v", bucket, key, err), "error")
+			}
+			writeChecksumError(w, http.StatusUnprocessableEntity, ChecksumErrorResponse{Error: "Checksum mismatch", Details: err.Error(), Bucket: bucket, Key: key})
+			return
+		}
+
+		info, err := precondition.Put(r.Context(), client, bucket, key, file, fileSize, minio.PutObjectOptions{
+			ContentType:          contentType,
+			UserMetadata:         checksumMetadata(checksums),
+			ServerSideEncryption: sse,
+		}, readSSE)
+		if conflict, ok := err.(*WriteConflictError); ok {
+			WriteConflict(w, conflict)
+			return
+		}
 		if err != nil {
 			fmt.Printf("DEBUG: Failed to upload object: %v\n", err)
 			w.Header().Set("Content-Type", "application/json")
@@ -153,6 +235,8 @@ func HandlePutObject() http.HandlerFunc {
 
 		fmt.Printf("DEBUG: Successfully uploaded object: %s/%s\n", bucket, key)
 
+		notifyObjectWritten(r.Context(), client, config, readSSE, bucket, key, info)
+
 		if LogActionFunc != nil {
 			LogActionFunc(uint(configID), userID, "upload_file", fmt.Sprintf("Uploaded file %s/%s (%d bytes)", bucket, key, fileSize), "success")
 		}
@@ -195,6 +279,18 @@ func HandlePutObjectWithConfig(config S3ConfigData) http.HandlerFunc {
 
 		fmt.Printf("DEBUG: Received upload request - bucket: %s, key: %s, fileSizeStr: %s\n", bucket, key, fileSizeStr)
 
+		userTags, err := ParseTags(r.FormValue("tags"))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			escapedErr := strings.ReplaceAll(fmt.Sprintf("%v", err), `"`, `\"`)
+			escapedErr = strings.ReplaceAll(escapedErr, "\n", "\\n")
+			escapedErr = strings.ReplaceAll(escapedErr, "\r", "\\r")
+			escapedErr = strings.ReplaceAll(escapedErr, "\t", "\\t")
+			w.Write([]byte(fmt.Sprintf(`{"error": "Invalid tags", "details": "%s"}`, escapedErr)))
+			return
+		}
+
 		fileSize := int64(-1)
 		if fileSizeStr != "" {
 			if size, err := strconv.ParseInt(fileSizeStr, 10, 64); err == nil {
@@ -256,10 +352,57 @@ func HandlePutObjectWithConfig(config S3ConfigData) http.HandlerFunc {
 
 		fmt.Printf("DEBUG: Created S3 client successfully\n")
 
-		// Upload the file
-		info, err := client.PutObject(r.Context(), bucket, key, file, fileSize, minio.PutObjectOptions{
-			ContentType: header.Header.Get("Content-Type"),
+		sse, err := WriteEncryption(config, SSEOptions{
+			SSE:            r.FormValue("sse"),
+			SSECustomerKey: r.FormValue("sseCustomerKey"),
+			SSEKeyName:     r.FormValue("sseKeyName"),
 		})
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			escapedErr := strings.ReplaceAll(fmt.Sprintf("%v", err), `"`, `\"`)
+			escapedErr = strings.ReplaceAll(escapedErr, "\n", "\\n")
+			escapedErr = strings.ReplaceAll(escapedErr, "\r", "\\r")
+			escapedErr = strings.ReplaceAll(escapedErr, "\t", "\\t")
+			w.Write([]byte(fmt.Sprintf(`{"error": "Invalid encryption", "details": "%s"}`, escapedErr)))
+			return
+		}
+
+		precondition, readSSE, err := uploadPreconditionFromForm(r, config)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf(`{"error": "Invalid upload options", "details": "%s"}`, strings.ReplaceAll(err.Error(), `"`, `\"`))))
+			return
+		}
+
+		checksums, err := checksumsFromForm(r)
+		if err != nil {
+			writeChecksumError(w, http.StatusBadRequest, ChecksumErrorResponse{Error: "Invalid checksum", Details: err.Error()})
+			return
+		}
+		if err := verifyUploadChecksums(file, checksums); err != nil {
+			if LogActionFunc != nil {
+				LogActionFunc(config.ID, 0, "upload_file", fmt.Sprintf("Rejected upload to %s/%s: %v", bucket, key, err), "error")
+			}
+			writeChecksumError(w, http.StatusUnprocessableEntity, ChecksumErrorResponse{Error: "Checksum mismatch", Details: err.Error(), Bucket: bucket, Key: key})
+			return
+		}
+
+		// Upload the file
+		info, err := precondition.Put(r.Context(), client, bucket, key, file, fileSize, minio.PutObjectOptions{
+			ContentType:          header.Header.Get("Content-Type"),
+			UserTags:             userTags,
+			UserMetadata:         checksumMetadata(checksums),
+			ServerSideEncryption: sse,
+		}, readSSE)
+		if conflict, ok := err.(*WriteConflictError); ok {
+			if LogActionFunc != nil {
+				LogActionFunc(config.ID, 0, "upload_file", fmt.Sprintf("Refused upload to %s/%s: %s", bucket, key, conflict.Reason), "error")
+			}
+			WriteConflict(w, conflict)
+			return
+		}
 		if err != nil {
 			fmt.Printf("DEBUG: Failed to upload object: %v\n", err)
 			w.Header().Set("Content-Type", "application/json")
@@ -275,6 +418,8 @@ func HandlePutObjectWithConfig(config S3ConfigData) http.HandlerFunc {
 
 		fmt.Printf("DEBUG: Successfully uploaded object: %s/%s, size: %d\n", bucket, key, info.Size)
 
+		notifyObjectWritten(r.Context(), client, config, readSSE, bucket, key, info)
+
 		if LogActionFunc != nil {
 			LogActionFunc(config.ID, 0, "upload_file", fmt.Sprintf("Uploaded file %s/%s (%d bytes)", bucket, key, info.Size), "success")
 		}
@@ -0,0 +1,264 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	searchDefaultLimit = 100
+	searchMaxLimit     = 1000
+	// Un appel paginé rend la main après avoir parcouru autant de clés, même sans résultat
+	searchMaxScanPerPage = 100000
+)
+
+// globToRegexp converts a glob to an anchored regular expression: "*" and "?" stay within
+// a path segment, "**" crosses segments.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	// Parcours par rune : un caractère non ASCII doit être recopié entier
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// objectMatcher holds the compiled filters of a search
+type objectMatcher struct {
+	pattern       *regexp.Regexp
+	baseNameOnly  bool // Un glob sans "/" s'applique au nom de fichier, où qu'il soit
+	minSize       int64
+	maxSize       int64
+	after, before time.Time
+	contentType   string
+}
+
+func newObjectMatcher(req SearchObjectsRequest) (*objectMatcher, error) {
+	m := &objectMatcher{minSize: req.MinSize, maxSize: req.MaxSize, contentType: strings.ToLower(req.ContentType)}
+
+	if req.Pattern != "" {
+		expr := req.Pattern
+		switch req.PatternType {
+		case "", "glob":
+			m.baseNameOnly = !strings.Contains(req.Pattern, "/")
+			expr = globToRegexp(req.Pattern)
+		case "regex":
+		default:
+			return nil, fmt.Errorf("patternType must be 'glob' or 'regex'")
+		}
+		if req.CaseInsensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+		m.pattern = re
+	}
+
+	var err error
+	if req.ModifiedAfter != "" {
+		if m.after, err = time.Parse(time.RFC3339, req.ModifiedAfter); err != nil {
+			return nil, fmt.Errorf("modifiedAfter must be an RFC3339 date")
+		}
+	}
+	if req.ModifiedBefore != "" {
+		if m.before, err = time.Parse(time.RFC3339, req.ModifiedBefore); err != nil {
+			return nil, fmt.Errorf("modifiedBefore must be an RFC3339 date")
+		}
+	}
+	if m.maxSize > 0 && m.minSize > m.maxSize {
+		return nil, fmt.Errorf("minSize is greater than maxSize")
+	}
+	return m, nil
+}
+
+// matchListing applies the filters available from the listing itself
+func (m *objectMatcher) matchListing(object minio.ObjectInfo) bool {
+	if m.pattern != nil {
+		target := object.Key
+		if m.baseNameOnly {
+			target = path.Base(object.Key)
+		}
+		if !m.pattern.MatchString(target) {
+			return false
+		}
+	}
+	if object.Size < m.minSize || (m.maxSize > 0 && object.Size > m.maxSize) {
+		return false
+	}
+	if !m.after.IsZero() && !object.LastModified.After(m.after) {
+		return false
+	}
+	if !m.before.IsZero() && !object.LastModified.Before(m.before) {
+		return false
+	}
+	return true
+}
+
+// matchContentType compares a Content-Type, ignoring parameters; a filter ending with "/" is a prefix
+func (m *objectMatcher) matchContentType(contentType string) bool {
+	contentType, _, _ = strings.Cut(strings.ToLower(contentType), ";")
+	contentType = strings.TrimSpace(contentType)
+	if strings.HasSuffix(m.contentType, "/") {
+		return strings.HasPrefix(contentType, m.contentType)
+	}
+	return contentType == m.contentType
+}
+
+// HandleSearchObjectsWithConfig searches a bucket by key pattern, size, date and content type.
+// Results are either paged (limit + continuationToken) or streamed as NDJSON, one object per
+// line followed by a summary line. The listing stops as soon as the client goes away.
+func HandleSearchObjectsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req SearchObjectsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		matcher, err := newObjectMatcher(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stream := req.Stream || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+		limit := req.Limit
+		if !stream && limit <= 0 {
+			limit = searchDefaultLimit
+		}
+		if limit > searchMaxLimit && !stream {
+			limit = searchMaxLimit
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		ctx := r.Context()
+		opts := minio.ListObjectsOptions{Prefix: req.Prefix, Recursive: true, StartAfter: req.ContinuationToken}
+
+		var encoder *json.Encoder
+		flusher, _ := w.(http.Flusher)
+		if stream {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+			encoder = json.NewEncoder(w)
+		}
+
+		matches := []S3Object{}
+		matched, scanned := 0, 0
+		lastKey := ""
+		truncated := false
+		for object := range client.ListObjects(ctx, req.Bucket, opts) {
+			if ctx.Err() != nil {
+				// Client parti : inutile de continuer ou de répondre
+				return
+			}
+			if object.Err != nil {
+				if stream {
+					encoder.Encode(SearchObjectsSummary{Scanned: scanned, Matched: matched, Error: object.Err.Error()})
+					return
+				}
+				http.Error(w, fmt.Sprintf("Failed to list objects: %v", object.Err), http.StatusInternalServerError)
+				return
+			}
+
+			if !stream && (matched >= limit || scanned >= searchMaxScanPerPage) {
+				truncated = true
+				break
+			}
+			scanned++
+			lastKey = object.Key
+
+			if isTrashKey(object.Key) && !isTrashKey(req.Prefix) {
+				continue
+			}
+			if !matcher.matchListing(object) {
+				continue
+			}
+			contentType := ""
+			if matcher.contentType != "" {
+				// Le listing S3 ne contient pas le Content-Type : HEAD des seuls candidats restants
+				info, err := client.StatObject(ctx, req.Bucket, object.Key, minio.StatObjectOptions{})
+				if err != nil || !matcher.matchContentType(info.ContentType) {
+					continue
+				}
+				contentType = info.ContentType
+			}
+
+			match := S3Object{
+				Key:          object.Key,
+				Size:         object.Size,
+				LastModified: object.LastModified.Format(time.RFC3339),
+				ETag:         object.ETag,
+				ContentType:  contentType,
+			}
+			matched++
+
+			if stream {
+				if err := encoder.Encode(match); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+				if limit > 0 && matched >= limit {
+					break
+				}
+				continue
+			}
+			matches = append(matches, match)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if stream {
+			encoder.Encode(SearchObjectsSummary{Done: true, Scanned: scanned, Matched: matched})
+			return
+		}
+
+		resp := SearchObjectsResponse{Objects: matches, Scanned: scanned, IsTruncated: truncated}
+		if truncated {
+			resp.ContinuationToken = lastKey
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,227 @@
+package s3
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		key   string
+		match bool
+	}{
+		{"*.jpg", "photo.jpg", true},
+		{"*.jpg", "photo.jpeg", false},
+		{"*.jpg", "dir/photo.jpg", false},
+		{"dir/*.jpg", "dir/photo.jpg", true},
+		{"dir/*.jpg", "dir/sub/photo.jpg", false},
+		{"dir/**.jpg", "dir/sub/photo.jpg", true},
+		{"**/photo.jpg", "a/b/c/photo.jpg", true},
+		{"**", "any/key/at/all", true},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file12.txt", false},
+		{"file?.txt", "file/.txt", false},
+		{"a.b", "a.b", true},
+		{"a.b", "axb", false},
+		{"report (1)+[draft].pdf", "report (1)+[draft].pdf", true},
+		{"$^|{}.txt", "$^|{}.txt", true},
+		{"été-*.txt", "été-2024.txt", true},
+		{"?té.txt", "été.txt", true},
+		{"日本/*", "日本/ファイル", true},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.key, func(t *testing.T) {
+			re, err := regexp.Compile(globToRegexp(tt.glob))
+			if err != nil {
+				t.Fatalf("globToRegexp(%q) = %q does not compile: %v", tt.glob, globToRegexp(tt.glob), err)
+			}
+			if got := re.MatchString(tt.key); got != tt.match {
+				t.Errorf("glob %q on %q: match = %v, want %v (regexp %q)", tt.glob, tt.key, got, tt.match, re.String())
+			}
+		})
+	}
+}
+
+func TestObjectMatcher(t *testing.T) {
+	day := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	object := func(key string, size int64) minio.ObjectInfo {
+		return minio.ObjectInfo{Key: key, Size: size, LastModified: day}
+	}
+	tests := []struct {
+		name   string
+		req    SearchObjectsRequest
+		object minio.ObjectInfo
+		match  bool
+	}{
+		{"no filter", SearchObjectsRequest{}, object("any/key", 1), true},
+		{"glob without slash matches the base name", SearchObjectsRequest{Pattern: "*.jpg"}, object("a/b/photo.jpg", 1), true},
+		{"glob without slash ignores directories", SearchObjectsRequest{Pattern: "photo*"}, object("photos/x.png", 1), false},
+		{"glob with slash matches the whole key", SearchObjectsRequest{Pattern: "a/*.jpg"}, object("x/a/photo.jpg", 1), false},
+		{"glob with slash", SearchObjectsRequest{Pattern: "a/*.jpg"}, object("a/photo.jpg", 1), true},
+		{"glob is case sensitive", SearchObjectsRequest{Pattern: "*.jpg"}, object("PHOTO.JPG", 1), false},
+		{"case insensitive glob", SearchObjectsRequest{Pattern: "*.jpg", CaseInsensitive: true}, object("PHOTO.JPG", 1), true},
+		{"regex on the whole key", SearchObjectsRequest{Pattern: `^logs/\d{4}/`, PatternType: "regex"}, object("logs/2024/app.log", 1), true},
+		{"regex is not anchored", SearchObjectsRequest{Pattern: `report`, PatternType: "regex"}, object("a/monthly-report.pdf", 1), true},
+		{"regex metacharacters stay literal in globs", SearchObjectsRequest{Pattern: "a+b.txt"}, object("aab.txt", 1), false},
+		{"min size", SearchObjectsRequest{MinSize: 10}, object("k", 9), false},
+		{"min size inclusive", SearchObjectsRequest{MinSize: 10}, object("k", 10), true},
+		{"max size", SearchObjectsRequest{MaxSize: 10}, object("k", 11), false},
+		{"max size inclusive", SearchObjectsRequest{MaxSize: 10}, object("k", 10), true},
+		{"modified after", SearchObjectsRequest{ModifiedAfter: "2024-05-10T00:00:00Z"}, object("k", 1), true},
+		{"modified after is exclusive", SearchObjectsRequest{ModifiedAfter: "2024-05-10T12:00:00Z"}, object("k", 1), false},
+		{"modified before", SearchObjectsRequest{ModifiedBefore: "2024-05-10T00:00:00Z"}, object("k", 1), false},
+		{"modified before with offset", SearchObjectsRequest{ModifiedBefore: "2024-05-10T13:00:00+02:00"}, object("k", 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newObjectMatcher(tt.req)
+			if err != nil {
+				t.Fatalf("newObjectMatcher() error = %v", err)
+			}
+			if got := m.matchListing(tt.object); got != tt.match {
+				t.Errorf("matchListing(%q, %d bytes) = %v, want %v", tt.object.Key, tt.object.Size, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestObjectMatcherErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		req  SearchObjectsRequest
+		want string
+	}{
+		{"unknown pattern type", SearchObjectsRequest{Pattern: "x", PatternType: "sql"}, "patternType"},
+		{"invalid regex", SearchObjectsRequest{Pattern: "(", PatternType: "regex"}, "invalid pattern"},
+		{"invalid date", SearchObjectsRequest{ModifiedAfter: "yesterday"}, "modifiedAfter"},
+		{"invalid before date", SearchObjectsRequest{ModifiedBefore: "2024-05-10"}, "modifiedBefore"},
+		{"inverted sizes", SearchObjectsRequest{MinSize: 10, MaxSize: 5}, "minSize"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newObjectMatcher(tt.req)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("newObjectMatcher() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectMatcherContentType(t *testing.T) {
+	tests := []struct {
+		filter, contentType string
+		match               bool
+	}{
+		{"application/pdf", "application/pdf", true},
+		{"application/pdf", "Application/PDF; charset=binary", true},
+		{"application/pdf", "application/pdfx", false},
+		{"image/", "image/png", true},
+		{"IMAGE/", "image/jpeg", true},
+		{"image/", "application/octet-stream", false},
+		{"text/plain", "text/plain;charset=utf-8", true},
+	}
+	for _, tt := range tests {
+		m, err := newObjectMatcher(SearchObjectsRequest{ContentType: tt.filter})
+		if err != nil {
+			t.Fatalf("newObjectMatcher() error = %v", err)
+		}
+		if got := m.matchContentType(tt.contentType); got != tt.match {
+			t.Errorf("filter %q on %q: match = %v, want %v", tt.filter, tt.contentType, got, tt.match)
+		}
+	}
+}
+
+func searchRequest(t *testing.T, config S3ConfigData, req SearchObjectsRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	HandleSearchObjectsWithConfig(config)(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))))
+	return rec
+}
+
+func TestSearchObjectsPaging(t *testing.T) {
+	fake, _ := newFakeS3(t)
+	for _, key := range []string{"a/1.jpg", "a/2.png", "b/3.jpg", "c/4.jpg", "d.txt"} {
+		fake.seed("bkt", key, []byte(key), nil)
+	}
+
+	var keys []string
+	token := ""
+	for page := 0; page < 5; page++ {
+		rec := searchRequest(t, fake.config(), SearchObjectsRequest{Bucket: "bkt", Pattern: "*.jpg", Limit: 2, ContinuationToken: token})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d: status %d: %s", page, rec.Code, rec.Body.String())
+		}
+		var resp SearchObjectsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range resp.Objects {
+			keys = append(keys, o.Key)
+		}
+		if !resp.IsTruncated {
+			break
+		}
+		if resp.ContinuationToken == "" {
+			t.Fatalf("page %d is truncated without a continuation token", page)
+		}
+		token = resp.ContinuationToken
+	}
+	if got := strings.Join(keys, ","); got != "a/1.jpg,b/3.jpg,c/4.jpg" {
+		t.Errorf("matched keys = %s, want a/1.jpg,b/3.jpg,c/4.jpg", got)
+	}
+}
+
+func TestSearchObjectsStreamContentType(t *testing.T) {
+	fake, _ := newFakeS3(t)
+	fake.seed("bkt", "doc.bin", []byte("pdf"), http.Header{"Content-Type": {"application/pdf"}})
+	fake.seed("bkt", "img.bin", []byte("png"), http.Header{"Content-Type": {"image/png"}})
+	fake.seed("bkt", "photo.bin", []byte("jpg"), http.Header{"Content-Type": {"image/jpeg"}})
+
+	rec := searchRequest(t, fake.config(), SearchObjectsRequest{Bucket: "bkt", ContentType: "image/", Stream: true})
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+
+	var keys []string
+	var summary SearchObjectsSummary
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if strings.Contains(string(line), `"done"`) {
+			if err := json.Unmarshal(line, &summary); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var o S3Object
+		if err := json.Unmarshal(line, &o); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, o.Key+"="+o.ContentType)
+	}
+	if got := strings.Join(keys, ","); got != "img.bin=image/png,photo.bin=image/jpeg" {
+		t.Errorf("streamed = %s", got)
+	}
+	if !summary.Done || summary.Scanned != 3 || summary.Matched != 2 {
+		t.Errorf("summary = %+v, want done with 3 scanned and 2 matched", summary)
+	}
+}
+
+func TestSearchObjectsRejectsInvalidPattern(t *testing.T) {
+	rec := searchRequest(t, S3ConfigData{}, SearchObjectsRequest{Bucket: "bkt", Pattern: "[", PatternType: "regex"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,287 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+// tagFetchConcurrency bounds the number of parallel GetObjectTagging calls made by list-objects
+const tagFetchConcurrency = 8
+
+// ParseTags reads tags sent with an upload, either as a JSON object
+// ({"project":"alpha"}) or as a URL-encoded query ("project=alpha&env=prod")
+func ParseTags(raw string) (map[string]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	result := map[string]string{}
+	if strings.HasPrefix(raw, "{") {
+		if err := json.Unmarshal([]byte(raw), &result); err != nil {
+			return nil, fmt.Errorf("invalid tags JSON: %v", err)
+		}
+	} else {
+		values, err := url.ParseQuery(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tags query: %v", err)
+		}
+		for k := range values {
+			result[k] = values.Get(k)
+		}
+	}
+	// Valide les limites S3 (10 tags, longueur des clés/valeurs)
+	if _, err := tags.MapToObjectTags(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// attachObjectTags fetches tags for each listed object with bounded concurrency. Folders ("dir/"
+// prefixes) have no tags and objects deleted since the listing count as untagged; other failures
+// leave the object without tags and are counted rather than failing the whole listing.
+func attachObjectTags(ctx context.Context, client *minio.Client, bucket string, objects []S3Object) int {
+	sem := make(chan struct{}, tagFetchConcurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+
+	for i := range objects {
+		if strings.HasSuffix(objects[i].Key, "/") {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(obj *S3Object) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			t, err := client.GetObjectTagging(ctx, bucket, obj.Key, minio.GetObjectTaggingOptions{})
+			if err != nil {
+				if minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+				return
+			}
+			obj.Tags = t.ToMap()
+		}(&objects[i])
+	}
+	wg.Wait()
+	return failed
+}
+
+// filterObjectsByTags keeps objects carrying every tag of filter
+func filterObjectsByTags(objects []S3Object, filter map[string]string) []S3Object {
+	filtered := objects[:0]
+	for _, obj := range objects {
+		match := true
+		for k, v := range filter {
+			if tv, ok := obj.Tags[k]; !ok || tv != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			filtered = append(filtered, obj)
+		}
+	}
+	return filtered
+}
+
+// isNoSuchTagSet reports whether err means the resource simply has no tags
+func isNoSuchTagSet(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchTagSet" || code == "NoSuchTagSetError"
+}
+
+func decodeTaggingRequest(w http.ResponseWriter, r *http.Request, config S3ConfigData, needKey bool) (TaggingRequest, *minio.Client, bool) {
+	var req TaggingRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return req, nil, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, nil, false
+	}
+
+	if req.Bucket == "" || (needKey && req.Key == "") {
+		if needKey {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+		} else {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+		}
+		return req, nil, false
+	}
+
+	creds, err := GetS3Credentials(config, req.KeyId, req.Token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get credentials: %v", err), http.StatusUnauthorized)
+		return req, nil, false
+	}
+
+	client, err := CreateS3Client(creds)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create S3 client: %v", err), http.StatusInternalServerError)
+		return req, nil, false
+	}
+
+	return req, client, true
+}
+
+func writeTags(w http.ResponseWriter, t map[string]string) {
+	if t == nil {
+		t = map[string]string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TaggingResponse{Tags: t})
+}
+
+// HandleGetObjectTagsWithConfig returns the tags of an object
+func HandleGetObjectTagsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, client, ok := decodeTaggingRequest(w, r, config, true)
+		if !ok {
+			return
+		}
+
+		t, err := client.GetObjectTagging(r.Context(), req.Bucket, req.Key, minio.GetObjectTaggingOptions{VersionID: req.VersionID})
+		if err != nil {
+			if isNoSuchTagSet(err) {
+				writeTags(w, nil)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get object tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeTags(w, t.ToMap())
+	}
+}
+
+// HandleSetObjectTagsWithConfig replaces the tags of an object
+func HandleSetObjectTagsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, client, ok := decodeTaggingRequest(w, r, config, true)
+		if !ok {
+			return
+		}
+
+		t, err := tags.MapToObjectTags(req.Tags)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid tags: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := client.PutObjectTagging(r.Context(), req.Bucket, req.Key, t, minio.PutObjectTaggingOptions{VersionID: req.VersionID}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set object tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "set_object_tags", fmt.Sprintf("Set tags on %s/%s: %s", req.Bucket, req.Key, t.String()), "success")
+		}
+
+		writeTags(w, t.ToMap())
+	}
+}
+
+// HandleDeleteObjectTagsWithConfig removes all tags from an object
+func HandleDeleteObjectTagsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, client, ok := decodeTaggingRequest(w, r, config, true)
+		if !ok {
+			return
+		}
+
+		if err := client.RemoveObjectTagging(r.Context(), req.Bucket, req.Key, minio.RemoveObjectTaggingOptions{VersionID: req.VersionID}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete object tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "delete_object_tags", fmt.Sprintf("Removed tags from %s/%s", req.Bucket, req.Key), "success")
+		}
+
+		writeTags(w, nil)
+	}
+}
+
+// HandleGetBucketTagsWithConfig returns the tags of a bucket
+func HandleGetBucketTagsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, client, ok := decodeTaggingRequest(w, r, config, false)
+		if !ok {
+			return
+		}
+
+		t, err := client.GetBucketTagging(r.Context(), req.Bucket)
+		if err != nil {
+			if isNoSuchTagSet(err) {
+				writeTags(w, nil)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get bucket tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeTags(w, t.ToMap())
+	}
+}
+
+// HandleSetBucketTagsWithConfig replaces the tags of a bucket
+func HandleSetBucketTagsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, client, ok := decodeTaggingRequest(w, r, config, false)
+		if !ok {
+			return
+		}
+
+		t, err := tags.MapToBucketTags(req.Tags)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid tags: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := client.SetBucketTagging(r.Context(), req.Bucket, t); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set bucket tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "set_bucket_tags", fmt.Sprintf("Set tags on bucket %s: %s", req.Bucket, t.String()), "success")
+		}
+
+		writeTags(w, t.ToMap())
+	}
+}
+
+// HandleDeleteBucketTagsWithConfig removes all tags from a bucket
+func HandleDeleteBucketTagsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, client, ok := decodeTaggingRequest(w, r, config, false)
+		if !ok {
+			return
+		}
+
+		if err := client.RemoveBucketTagging(r.Context(), req.Bucket); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete bucket tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "delete_bucket_tags", fmt.Sprintf("Removed tags from bucket %s", req.Bucket), "success")
+		}
+
+		writeTags(w, nil)
+	}
+}
@@ -0,0 +1,183 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// textObjectMaxSize caps the objects edited through get-text-object / put-text-object
+const textObjectMaxSize = 5 << 20
+
+// HandleGetTextObjectWithConfig returns a UTF-8 object as a JSON string with its ETag,
+// to be sent back as ifMatch when saving
+func HandleGetTextObjectWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req GetTextObjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		readSSE, err := ResolveReadEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		info, sse, err := readSSE.Stat(r.Context(), client, req.Bucket, req.Key, "")
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				http.Error(w, "Object not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if info.Size > textObjectMaxSize {
+			http.Error(w, fmt.Sprintf("Object is larger than %d bytes, download it instead", textObjectMaxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Lire exactement la version dont on renvoie l'ETag
+		getOpts := minio.GetObjectOptions{ServerSideEncryption: sse}
+		getOpts.SetMatchETag(normalizeETag(info.ETag))
+		object, err := client.GetObject(r.Context(), req.Bucket, req.Key, getOpts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get object: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer object.Close()
+
+		content, err := io.ReadAll(io.LimitReader(object, textObjectMaxSize+1))
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+				http.Error(w, "Object was modified while reading, please retry", http.StatusConflict)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to read object: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !utf8.Valid(content) {
+			http.Error(w, "Object is not UTF-8 text", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		etag := normalizeETag(info.ETag)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"`+etag+`"`)
+		json.NewEncoder(w).Encode(TextObjectResponse{
+			Bucket:       req.Bucket,
+			Key:          req.Key,
+			Content:      string(content),
+			ETag:         etag,
+			ContentType:  info.ContentType,
+			Size:         info.Size,
+			LastModified: info.LastModified.Format(time.RFC3339),
+		})
+	}
+}
+
+// HandlePutTextObjectWithConfig writes a text object from JSON. With ifMatch (or If-Match) the
+// save only succeeds if nobody changed the object since it was read; with ifNoneMatch "*" it
+// only creates. A failed precondition answers 409 with the current ETag.
+func HandlePutTextObjectWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PutTextObjectRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 2*textObjectMaxSize)).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" || req.Key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Content) > textObjectMaxSize {
+			http.Error(w, fmt.Sprintf("Content is larger than %d bytes", textObjectMaxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		contentType := req.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(path.Ext(req.Key))
+		}
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+
+		sse, err := WriteEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid encryption: %v", err), http.StatusBadRequest)
+			return
+		}
+		readSSE, err := ResolveReadEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		precondition := ResolveWritePrecondition(config, preconditionFromRequest(r, req.IfMatch, req.IfNoneMatch), nil)
+		info, err := precondition.Put(r.Context(), client, req.Bucket, req.Key, strings.NewReader(req.Content), int64(len(req.Content)), minio.PutObjectOptions{
+			ContentType:          contentType,
+			ServerSideEncryption: sse,
+		}, readSSE)
+		if err != nil {
+			if LogActionFunc != nil {
+				LogActionFunc(config.ID, config.UserID, "edit_text_object", fmt.Sprintf("Failed to save %s/%s: %v", req.Bucket, req.Key, err), "error")
+			}
+			writeConditionalPutError(w, err)
+			return
+		}
+
+		notifyObjectWritten(r.Context(), client, config, readSSE, req.Bucket, req.Key, info)
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "edit_text_object", fmt.Sprintf("Saved text object %s/%s (%d bytes)", req.Bucket, req.Key, info.Size), "success")
+		}
+
+		etag := normalizeETag(info.ETag)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"`+etag+`"`)
+		json.NewEncoder(w).Encode(PutTextObjectResponse{
+			Bucket:    req.Bucket,
+			Key:       req.Key,
+			ETag:      etag,
+			Size:      info.Size,
+			VersionID: info.VersionID,
+		})
+	}
+}
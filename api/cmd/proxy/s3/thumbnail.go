@@ -0,0 +1,331 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Décodeurs enregistrés auprès de image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbnailDefaultSize = 256
+	thumbnailMinSize     = 16
+	thumbnailMaxSize     = 1024
+
+	// Limites des sources : au-delà, le décodage coûterait trop de mémoire
+	thumbnailMaxSourceSize   = 50 << 20
+	thumbnailMaxSourcePixels = 60_000_000
+
+	thumbnailMaxConcurrent = 4
+)
+
+// Cache disque des miniatures, réglable depuis main
+var (
+	ThumbnailCacheDir           = "./data/thumbnails"
+	ThumbnailCacheMaxSize int64 = 512 << 20
+)
+
+// Génération limitée : chaque décodage peut occuper plusieurs centaines de Mo
+var thumbnailSlots = make(chan struct{}, thumbnailMaxConcurrent)
+
+// thumbnailCache tracks the size of the disk cache and evicts the least recently used files
+type thumbnailCache struct {
+	mu     sync.Mutex
+	loaded bool
+	size   int64
+}
+
+var thumbnails thumbnailCache
+
+type thumbnailFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *thumbnailCache) files() []thumbnailFile {
+	var files []thumbnailFile
+	filepath.WalkDir(ThumbnailCacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, thumbnailFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	return files
+}
+
+// add records a new file and evicts the oldest ones (by last access) down to 90% of the limit
+func (c *thumbnailCache) add(size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded {
+		c.size = 0
+		for _, f := range c.files() {
+			c.size += f.size
+		}
+		c.loaded = true
+	} else {
+		c.size += size
+	}
+	if c.size <= ThumbnailCacheMaxSize {
+		return
+	}
+
+	files := c.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	target := ThumbnailCacheMaxSize * 9 / 10
+	c.size = 0
+	for _, f := range files {
+		c.size += f.size
+	}
+	for _, f := range files {
+		if c.size <= target {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			c.size -= f.size
+		}
+	}
+}
+
+// thumbnailCachePath derives the cache file from everything that changes the thumbnail bytes
+func thumbnailCachePath(projectID uint, bucket, key, etag string, size int, format string) (string, string) {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s\n%s\n%d\n%s", projectID, bucket, key, strings.Trim(etag, `"`), size, format)))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(ThumbnailCacheDir, name[:2], name+".thumb"), name
+}
+
+// writeThumbnailCache writes atomically (temporary file + rename) so a concurrent reader
+// never sees a partial file
+func writeThumbnailCache(path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil || os.Rename(tmp.Name(), path) != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	thumbnails.add(int64(len(data)))
+}
+
+// hasAlpha reports whether an image has at least one non-opaque pixel
+func hasAlpha(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	return true
+}
+
+// renderThumbnail decodes a source image and scales it to fit within size x size.
+// "auto" picks PNG for images with transparency and JPEG otherwise.
+func renderThumbnail(source io.Reader, size int, format string) ([]byte, error) {
+	// Les dimensions sont lues avant de décoder : une petite image peut en annoncer d'énormes
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(source, &header))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %v", err)
+	}
+	if config.Width*config.Height > thumbnailMaxSourcePixels {
+		return nil, fmt.Errorf("image is too large (%dx%d)", config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&header, source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	if format == "auto" {
+		format = "jpeg"
+		if hasAlpha(src) {
+			format = "png"
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if format == "jpeg" {
+		// JPEG n'a pas de transparence : fond blanc
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var out bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&out, dst)
+	case "webp":
+		err = encodeWebP(&out, dst)
+	default:
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 82})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// serveThumbnail writes a cached or fresh thumbnail with validators for browser caching
+func serveThumbnail(w http.ResponseWriter, r *http.Request, data []byte, name string) {
+	etag := `"` + name + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	// Le format réel ("auto") se déduit des octets, y compris pour une entrée du cache
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// HandleThumbnailWithConfig serves a resized JPEG, PNG or lossless WebP of an image object (JPEG,
+// PNG, GIF or WebP source). GET query parameters: bucket, key, size (longest side, 16-1024) and
+// format (auto, jpeg, png or webp). Thumbnails are cached on disk keyed by bucket, key and ETag,
+// except for SSE-C objects which are never written to disk in clear. Documents (PDF, office
+// files) have no preview: any object that is not a decodable image gets 415.
+func HandleThumbnailWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		bucket := query.Get("bucket")
+		key := query.Get("key")
+		if bucket == "" || key == "" {
+			http.Error(w, "bucket and key are required", http.StatusBadRequest)
+			return
+		}
+
+		size := thumbnailDefaultSize
+		if s := query.Get("size"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < thumbnailMinSize || n > thumbnailMaxSize {
+				http.Error(w, fmt.Sprintf("size must be between %d and %d", thumbnailMinSize, thumbnailMaxSize), http.StatusBadRequest)
+				return
+			}
+			size = n
+		}
+		format := query.Get("format")
+		switch format {
+		case "":
+			format = "auto"
+		case "jpg":
+			format = "jpeg"
+		case "auto", "jpeg", "png", "webp":
+		default:
+			http.Error(w, "format must be 'auto', 'jpeg', 'png' or 'webp'", http.StatusBadRequest)
+			return
+		}
+
+		readSSE, err := ResolveReadEncryption(config, SSEOptions{
+			SSECustomerKey: r.Header.Get(SSECustomerKeyHeader),
+			SSEKeyName:     query.Get("sseKeyName"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, "", "")
+		if !ok {
+			return
+		}
+
+		info, sse, err := readSSE.Stat(r.Context(), client, bucket, key, "")
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				http.Error(w, "Object not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusBadGateway)
+			return
+		}
+		if info.Size > thumbnailMaxSourceSize {
+			http.Error(w, fmt.Sprintf("Image is larger than %d bytes", thumbnailMaxSourceSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Les objets SSE-C ne sont jamais écrits en clair sur le disque
+		cacheable := sse == nil
+		cachePath, name := thumbnailCachePath(config.ID, bucket, key, info.ETag, size, format)
+		if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, `"`+name+`"`) {
+			w.Header().Set("ETag", `"`+name+`"`)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if cacheable {
+			if data, err := os.ReadFile(cachePath); err == nil {
+				now := time.Now()
+				os.Chtimes(cachePath, now, now) // Dernier accès, pour l'éviction
+				serveThumbnail(w, r, data, name)
+				return
+			}
+		}
+
+		select {
+		case thumbnailSlots <- struct{}{}:
+		case <-r.Context().Done():
+			return
+		}
+		defer func() { <-thumbnailSlots }()
+
+		object, err := client.GetObject(r.Context(), bucket, key, minio.GetObjectOptions{ServerSideEncryption: sse})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get object: %v", err), http.StatusBadGateway)
+			return
+		}
+		defer object.Close()
+
+		data, err := renderThumbnail(io.LimitReader(object, thumbnailMaxSourceSize), size, format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		if cacheable {
+			writeThumbnailCache(cachePath, data)
+		}
+		serveThumbnail(w, r, data, name)
+	}
+}
@@ -0,0 +1,115 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// TrashPrefix holds the copies of objects deleted from unversioned buckets. It is hidden from
+// list-objects and search-objects.
+const TrashPrefix = ".kexa-trash/"
+
+// DefaultTrashRetentionDays applies when a project enables the trash without a retention
+const DefaultTrashRetentionDays = 30
+
+// TrashedObject describes where a deleted object is kept: a copy under TrashPrefix for
+// unversioned buckets, or the version that was current for versioned ones.
+type TrashedObject struct {
+	Bucket    string
+	Key       string
+	TrashKey  string
+	VersionID string
+	Size      int64
+	ETag      string
+}
+
+// isTrashKey reports whether a listed key belongs to the trash
+func isTrashKey(key string) bool {
+	return strings.HasPrefix(key, TrashPrefix)
+}
+
+// MoveToTrash deletes an object while keeping it restorable. On a versioned bucket the delete
+// only adds a delete marker and the previous version is recorded; otherwise the object is
+// copied under TrashPrefix before being removed.
+func MoveToTrash(ctx context.Context, client *minio.Client, config S3ConfigData, bucket, key string, bypassGovernance bool) (TrashedObject, error) {
+	readSSE, err := ResolveReadEncryption(config, SSEOptions{})
+	if err != nil {
+		return TrashedObject{}, err
+	}
+	info, sse, err := readSSE.Stat(ctx, client, bucket, key, "")
+	if err != nil {
+		return TrashedObject{}, err
+	}
+	trashed := TrashedObject{Bucket: bucket, Key: key, Size: info.Size, ETag: normalizeETag(info.ETag)}
+
+	versioning, err := client.GetBucketVersioning(ctx, bucket)
+	if err == nil && versioning.Enabled() && info.VersionID != "" && info.VersionID != "null" {
+		if err := client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return TrashedObject{}, err
+		}
+		trashed.VersionID = info.VersionID
+		return trashed, nil
+	}
+
+	// Horodatage en tête : plusieurs suppressions de la même clé coexistent dans la corbeille
+	trashed.TrashKey = fmt.Sprintf("%s%d/%s", TrashPrefix, time.Now().UnixNano(), key)
+	if _, err := CopyObjectTo(ctx, client, info, bucket, minio.CopyDestOptions{Bucket: bucket, Object: trashed.TrashKey}, sse); err != nil {
+		return TrashedObject{}, fmt.Errorf("failed to copy object to the trash: %v", err)
+	}
+	if err := client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{GovernanceBypass: bypassGovernance}); err != nil {
+		client.RemoveObject(ctx, bucket, trashed.TrashKey, minio.RemoveObjectOptions{})
+		return TrashedObject{}, err
+	}
+	return trashed, nil
+}
+
+// RestoreFromTrash puts a trashed object back under its original key. The key must be free
+// unless overwrite is set (and the project allows overwrites).
+func RestoreFromTrash(ctx context.Context, client *minio.Client, config S3ConfigData, object TrashedObject, overwrite bool) error {
+	readSSE, err := ResolveReadEncryption(config, SSEOptions{})
+	if err != nil {
+		return err
+	}
+	precondition := ResolveWritePrecondition(config, WritePrecondition{}, &overwrite)
+	if err := precondition.Check(ctx, client, object.Bucket, object.Key, readSSE); err != nil {
+		return err
+	}
+
+	source, versionID := object.TrashKey, ""
+	if object.TrashKey == "" {
+		source, versionID = object.Key, object.VersionID
+	}
+	info, sse, err := readSSE.Stat(ctx, client, object.Bucket, source, versionID)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return fmt.Errorf("trashed copy no longer exists")
+		}
+		return err
+	}
+	if _, err := CopyObjectTo(ctx, client, info, object.Bucket, minio.CopyDestOptions{Bucket: object.Bucket, Object: object.Key}, sse); err != nil {
+		return err
+	}
+	if object.TrashKey != "" {
+		client.RemoveObject(ctx, object.Bucket, object.TrashKey, minio.RemoveObjectOptions{})
+	}
+	refreshObjectChanged(ctx, client, config, object.Bucket, object.Key)
+	return nil
+}
+
+// PurgeTrashed permanently deletes a trashed object. A copy or version already gone is not an error.
+func PurgeTrashed(ctx context.Context, client *minio.Client, object TrashedObject) error {
+	key, opts := object.TrashKey, minio.RemoveObjectOptions{}
+	if object.TrashKey == "" {
+		key, opts.VersionID = object.Key, object.VersionID
+	}
+	err := client.RemoveObject(ctx, object.Bucket, key, opts)
+	if err != nil && minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+		return err
+	}
+	return nil
+}
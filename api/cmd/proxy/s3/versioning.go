@@ -0,0 +1,255 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// HandleGetBucketVersioningWithConfig returns the versioning status of a bucket
+func HandleGetBucketVersioningWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req BucketVersioningRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		versioning, err := client.GetBucketVersioning(r.Context(), req.Bucket)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get bucket versioning: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketVersioningResponse{Status: versioning.Status})
+	}
+}
+
+// HandleSetBucketVersioningWithConfig enables or suspends versioning on a bucket
+func HandleSetBucketVersioningWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req BucketVersioningRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+		if req.Status != minio.Enabled && req.Status != minio.Suspended {
+			http.Error(w, "status must be 'Enabled' or 'Suspended'", http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		// Un bucket versionné ne peut jamais revenir à l'état "non versionné", seulement suspendu
+		if err := client.SetBucketVersioning(r.Context(), req.Bucket, minio.BucketVersioningConfiguration{Status: req.Status}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set bucket versioning: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "set_bucket_versioning", fmt.Sprintf("Set versioning of bucket %s to %s", req.Bucket, req.Status), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BucketVersioningResponse{Status: req.Status})
+	}
+}
+
+// HandleListObjectVersionsWithConfig lists every version and delete marker under a prefix or for a single key
+func HandleListObjectVersionsWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ListObjectVersionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Bucket == "" {
+			http.Error(w, "bucket is required", http.StatusBadRequest)
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		prefix := req.Prefix
+		if req.Key != "" {
+			prefix = req.Key
+		}
+
+		versions := []ObjectVersion{}
+		for object := range client.ListObjects(r.Context(), req.Bucket, minio.ListObjectsOptions{
+			Prefix:       prefix,
+			Recursive:    true,
+			WithVersions: true,
+		}) {
+			if object.Err != nil {
+				http.Error(w, fmt.Sprintf("Failed to list object versions: %v", object.Err), http.StatusInternalServerError)
+				return
+			}
+			// Le préfixe ramène aussi "photo.jpg.bak" quand on demande "photo.jpg"
+			if req.Key != "" && object.Key != req.Key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				Key:            object.Key,
+				VersionID:      object.VersionID,
+				IsLatest:       object.IsLatest,
+				IsDeleteMarker: object.IsDeleteMarker,
+				Size:           object.Size,
+				LastModified:   object.LastModified.Format(time.RFC3339),
+				ETag:           object.ETag,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListObjectVersionsResponse{Versions: versions})
+	}
+}
+
+func decodeObjectVersionRequest(w http.ResponseWriter, r *http.Request) (ObjectVersionRequest, bool) {
+	var req ObjectVersionRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Bucket == "" || req.Key == "" || req.VersionID == "" {
+		http.Error(w, "bucket, key and versionId are required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// HandleRestoreObjectVersionWithConfig makes an older version current again by copying it
+// over the object; the history is kept and the restored copy becomes the latest version
+func HandleRestoreObjectVersionWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeObjectVersionRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		readSSE, err := ResolveReadEncryption(config, req.SSEOptions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		info, sse, err := readSSE.Stat(r.Context(), client, req.Bucket, req.Key, req.VersionID)
+		if err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				http.Error(w, "Object version not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to stat object version: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if info.IsDeleteMarker {
+			http.Error(w, "Cannot restore a delete marker", http.StatusBadRequest)
+			return
+		}
+
+		// Sans ReplaceMetadata, la copie conserve les métadonnées et le Content-Type de la version source
+		uploaded, err := CopyInPlace(r.Context(), client, info, req.Bucket, minio.CopyDestOptions{}, sse)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to restore object version: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		notifyObjectWritten(r.Context(), client, config, readSSE, req.Bucket, req.Key, uploaded)
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "restore_object_version", fmt.Sprintf("Restored version %s of %s/%s", req.VersionID, req.Bucket, req.Key), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ObjectVersion{
+			Key:          req.Key,
+			VersionID:    uploaded.VersionID,
+			IsLatest:     true,
+			Size:         info.Size,
+			LastModified: uploaded.LastModified.Format(time.RFC3339),
+			ETag:         uploaded.ETag,
+		})
+	}
+}
+
+// HandleDeleteObjectVersionWithConfig permanently deletes a single version (or delete marker)
+func HandleDeleteObjectVersionWithConfig(config S3ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeObjectVersionRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, ok := clientForRequest(w, config, req.KeyId, req.Token)
+		if !ok {
+			return
+		}
+
+		if err := client.RemoveObject(r.Context(), req.Bucket, req.Key, minio.RemoveObjectOptions{VersionID: req.VersionID}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete object version: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		refreshObjectChanged(r.Context(), client, config, req.Bucket, req.Key)
+
+		if LogActionFunc != nil {
+			LogActionFunc(config.ID, config.UserID, "delete_object_version", fmt.Sprintf("Permanently deleted version %s of %s/%s", req.VersionID, req.Bucket, req.Key), "success")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}
+}
@@ -0,0 +1,411 @@
+package s3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+// Lossless WebP (VP8L) encoder. golang.org/x/image only decodes WebP, so thumbnails use this
+// minimal encoder: subtract-green and a single gradient predictor, one prefix code group, no
+// backward references and no color cache. The output is larger than libwebp's but always valid.
+
+const (
+	vp8lSignature = 0x2f
+	vp8lMaxSize   = 1 << 14
+
+	vp8lTransformPredictor     = 0
+	vp8lTransformSubtractGreen = 2
+
+	// Prédicteur 12 (ClampAddSubtractFull) sur des blocs de 512 pixels, le plus grand possible
+	vp8lPredictorMode = 12
+	vp8lPredictorBits = 9
+
+	vp8lMaxCodeLength       = 15
+	vp8lMaxCodeLengthLength = 7
+)
+
+// Alphabets green, red, blue, alpha et distance, sans cache de couleurs
+var vp8lAlphabetSizes = [5]int{256 + 24, 256, 256, 256, 40}
+
+// Ordre dans lequel les longueurs du code des longueurs sont écrites (RFC 9649, 3.7.2.1.2)
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lBitWriter packs values least significant bit first, as VP8L expects
+type vp8lBitWriter struct {
+	buf  []byte
+	acc  uint64
+	nAcc uint
+}
+
+func (b *vp8lBitWriter) write(value uint32, n uint) {
+	b.acc |= uint64(value) << b.nAcc
+	b.nAcc += n
+	for b.nAcc >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nAcc -= 8
+	}
+}
+
+func (b *vp8lBitWriter) bytes() []byte {
+	if b.nAcc > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nAcc = 0, 0
+	}
+	return b.buf
+}
+
+// vp8lPrefixCode holds the bit-reversed canonical code of every symbol, ready to be written
+type vp8lPrefixCode struct {
+	codes   []uint32
+	lengths []uint8
+}
+
+func (c *vp8lPrefixCode) write(b *vp8lBitWriter, symbol int) {
+	b.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// encodeWebP writes img as a lossless WebP file
+func encodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return fmt.Errorf("webp: invalid image size %dx%d", width, height)
+	}
+
+	// VP8L stocke des couleurs non prémultipliées
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+	argb := make([]uint32, width*height)
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[y*nrgba.Stride:]
+		for x := 0; x < width; x++ {
+			p := row[x*4 : x*4+4]
+			argb[y*width+x] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		}
+	}
+
+	b := &vp8lBitWriter{}
+	b.write(vp8lSignature, 8)
+	b.write(uint32(width-1), 14)
+	b.write(uint32(height-1), 14)
+	alpha := uint32(0)
+	if hasAlpha(img) {
+		alpha = 1
+	}
+	b.write(alpha, 1)
+	b.write(0, 3) // version
+
+	// Le décodeur annule les transformations dans l'ordre inverse de leur écriture
+	b.write(1, 1)
+	b.write(vp8lTransformSubtractGreen, 2)
+	for i, p := range argb {
+		green := p >> 8 & 0xff
+		red := (p>>16 - green) & 0xff
+		blue := (p - green) & 0xff
+		argb[i] = p&0xff00ff00 | red<<16 | blue
+	}
+
+	b.write(1, 1)
+	b.write(vp8lTransformPredictor, 2)
+	b.write(vp8lPredictorBits-2, 3)
+	writeVP8LPredictorImage(b)
+	residuals := vp8lPredict(argb, width, height)
+
+	b.write(0, 1) // plus de transformation
+	b.write(0, 1) // pas de cache de couleurs
+	b.write(0, 1) // un seul groupe de codes
+
+	var histograms [4][]int
+	for i := range histograms {
+		histograms[i] = make([]int, vp8lAlphabetSizes[i])
+	}
+	for _, p := range residuals {
+		histograms[0][p>>8&0xff]++
+		histograms[1][p>>16&0xff]++
+		histograms[2][p&0xff]++
+		histograms[3][p>>24]++
+	}
+	var codes [4]*vp8lPrefixCode
+	for i, histogram := range histograms {
+		codes[i] = writeVP8LPrefixCode(b, histogram)
+	}
+	writeVP8LSimpleCode(b, 0) // distance, jamais utilisée
+
+	for _, p := range residuals {
+		codes[0].write(b, int(p>>8&0xff))
+		codes[1].write(b, int(p>>16&0xff))
+		codes[2].write(b, int(p&0xff))
+		codes[3].write(b, int(p>>24))
+	}
+
+	data := b.bytes()
+	padding := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+len(data)+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding != 0 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// writeVP8LPredictorImage writes the predictor sub-image: every block uses the same mode, so each
+// prefix code has a single symbol and the pixels themselves take no bits
+func writeVP8LPredictorImage(b *vp8lBitWriter) {
+	b.write(0, 1) // pas de cache de couleurs
+	writeVP8LSimpleCode(b, vp8lPredictorMode)
+	for range 4 {
+		writeVP8LSimpleCode(b, 0)
+	}
+}
+
+// vp8lPredict returns the residuals of the predictor transform. The first pixel is predicted
+// from opaque black, the top row from the left pixel and the left column from the top pixel.
+func vp8lPredict(argb []uint32, width, height int) []uint32 {
+	residuals := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var predicted uint32
+			switch {
+			case x == 0 && y == 0:
+				predicted = 0xff000000
+			case y == 0:
+				predicted = argb[i-1]
+			case x == 0:
+				predicted = argb[i-width]
+			default:
+				predicted = vp8lClampAddSubtractFull(argb[i-1], argb[i-width], argb[i-width-1])
+			}
+			residuals[i] = vp8lSubPixels(argb[i], predicted)
+		}
+	}
+	return residuals
+}
+
+func vp8lClampAddSubtractFull(left, top, topLeft uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(left>>shift&0xff) + int(top>>shift&0xff) - int(topLeft>>shift&0xff)
+		out |= uint32(min(max(v, 0), 255)) << shift
+	}
+	return out
+}
+
+// vp8lSubPixels subtracts each channel modulo 256
+func vp8lSubPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// writeVP8LSimpleCode writes a prefix code with a single symbol, read with zero bits
+func writeVP8LSimpleCode(b *vp8lBitWriter, symbol int) {
+	b.write(1, 1) // code simple
+	b.write(0, 1) // un symbole
+	if symbol < 2 {
+		b.write(0, 1)
+		b.write(uint32(symbol), 1)
+	} else {
+		b.write(1, 1)
+		b.write(uint32(symbol), 8)
+	}
+}
+
+// writeVP8LPrefixCode writes the prefix code built from a histogram and returns it. Codes with
+// one or two symbols use the simple form; the others send their code lengths, themselves
+// compressed with a prefix code.
+func writeVP8LPrefixCode(b *vp8lBitWriter, histogram []int) *vp8lPrefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	code := &vp8lPrefixCode{codes: make([]uint32, len(histogram)), lengths: make([]uint8, len(histogram))}
+
+	// Les symboles des pixels sont tous < 256 : la forme simple sur 8 bits suffit
+	switch len(used) {
+	case 0:
+		writeVP8LSimpleCode(b, 0)
+		return code
+	case 1:
+		writeVP8LSimpleCode(b, used[0])
+		return code
+	case 2:
+		b.write(1, 1)
+		b.write(1, 1) // deux symboles
+		b.write(1, 1)
+		b.write(uint32(used[0]), 8)
+		b.write(uint32(used[1]), 8)
+		code.codes[used[1]] = 1
+		code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		return code
+	}
+
+	code.lengths = huffmanCodeLengths(histogram, vp8lMaxCodeLength)
+	code.codes = canonicalCodes(code.lengths)
+
+	// Longueurs codées en 0-15, les suites de zéros en 17 (3-10) ou 18 (11-138)
+	type token struct{ symbol, extra int }
+	var tokens []token
+	for i := 0; i < len(code.lengths); {
+		if code.lengths[i] != 0 {
+			tokens = append(tokens, token{int(code.lengths[i]), 0})
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(code.lengths) && code.lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, token{18, run - 11})
+		case run >= 3:
+			tokens = append(tokens, token{17, run - 3})
+		default:
+			run = 1
+			tokens = append(tokens, token{0, 0})
+		}
+		i += run
+	}
+
+	lengthHistogram := make([]int, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		lengthHistogram[t.symbol]++
+	}
+	// Un code à un seul symbole se lit sur zéro bit : on en garde deux pour rester explicite
+	if nonZero := countNonZero(lengthHistogram); nonZero < 2 {
+		if lengthHistogram[0] == 0 {
+			lengthHistogram[0] = 1
+		} else {
+			lengthHistogram[1] = 1
+		}
+	}
+	lengthCode := &vp8lPrefixCode{lengths: huffmanCodeLengths(lengthHistogram, vp8lMaxCodeLengthLength)}
+	lengthCode.codes = canonicalCodes(lengthCode.lengths)
+
+	b.write(0, 1) // code normal
+	nCodes := 4
+	for i, symbol := range vp8lCodeLengthOrder {
+		if lengthCode.lengths[symbol] != 0 {
+			nCodes = max(nCodes, i+1)
+		}
+	}
+	b.write(uint32(nCodes-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:nCodes] {
+		b.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	b.write(0, 1) // toutes les longueurs de l'alphabet sont écrites
+	for _, t := range tokens {
+		lengthCode.write(b, t.symbol)
+		switch t.symbol {
+		case 17:
+			b.write(uint32(t.extra), 3)
+		case 18:
+			b.write(uint32(t.extra), 7)
+		}
+	}
+	return code
+}
+
+func countNonZero(values []int) int {
+	n := 0
+	for _, v := range values {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// huffmanCodeLengths builds Huffman code lengths of at most maxLength bits for a histogram with
+// at least two used symbols. When the tree is too deep, the smallest counts are raised and the
+// tree rebuilt, which flattens it.
+func huffmanCodeLengths(histogram []int, maxLength int) []uint8 {
+	type node struct{ count, parent int }
+	lengths := make([]uint8, len(histogram))
+	for minCount := 1; ; minCount *= 2 {
+		var nodes []node
+		var symbols, active []int
+		for symbol, count := range histogram {
+			if count > 0 {
+				active = append(active, len(nodes))
+				nodes = append(nodes, node{max(count, minCount), -1})
+				symbols = append(symbols, symbol)
+			}
+		}
+		for len(active) > 1 {
+			sort.Slice(active, func(i, j int) bool { return nodes[active[i]].count < nodes[active[j]].count })
+			parent := len(nodes)
+			nodes = append(nodes, node{nodes[active[0]].count + nodes[active[1]].count, -1})
+			nodes[active[0]].parent, nodes[active[1]].parent = parent, parent
+			active = append(active[2:], parent)
+		}
+
+		fits := true
+		for leaf, symbol := range symbols {
+			depth := 0
+			for n := leaf; nodes[n].parent >= 0; n = nodes[n].parent {
+				depth++
+			}
+			if depth > maxLength {
+				fits = false
+				break
+			}
+			lengths[symbol] = uint8(depth)
+		}
+		if fits {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical codes to code lengths and reverses their bits, since VP8L
+// reads prefix codes from the most significant bit through an LSB-first bit reader
+func canonicalCodes(lengths []uint8) []uint32 {
+	var counts [vp8lMaxCodeLength + 1]uint32
+	for _, l := range lengths {
+		counts[l]++
+	}
+	counts[0] = 0
+	var next [vp8lMaxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + counts[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		reversed := uint32(0)
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		codes[symbol] = reversed
+	}
+	return codes
+}
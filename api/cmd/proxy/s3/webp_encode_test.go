@@ -0,0 +1,131 @@
+package s3
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	fill := func(w, h int, pixel func(x, y int) color.NRGBA) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetNRGBA(x, y, pixel(x, y))
+			}
+		}
+		return img
+	}
+
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"single pixel", fill(1, 1, func(x, y int) color.NRGBA { return color.NRGBA{10, 20, 30, 255} })},
+		{"uniform", fill(40, 30, func(x, y int) color.NRGBA { return color.NRGBA{200, 100, 50, 255} })},
+		{"two colors", fill(17, 9, func(x, y int) color.NRGBA {
+			if (x+y)%2 == 0 {
+				return color.NRGBA{0, 0, 0, 255}
+			}
+			return color.NRGBA{255, 255, 255, 255}
+		})},
+		{"gradient", fill(256, 64, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), uint8(y * 4), uint8(x + y), 255} })},
+		{"transparency", fill(33, 21, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x * 7), 90, uint8(y * 11), uint8(x * y)} })},
+		{"noise", fill(600, 3, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+		})},
+		{"skewed histogram", fill(1024, 4, func(x, y int) color.NRGBA {
+			// Fréquences très inégales : codes longs
+			v := uint8(0)
+			for n := rng.Intn(1 << 20); n > 0 && v < 40; n >>= 1 {
+				v++
+			}
+			return color.NRGBA{v, v * 3, v * 5, 255}
+		})},
+		{"tall", fill(1, 700, func(x, y int) color.NRGBA { return color.NRGBA{uint8(y), uint8(y / 3), 7, 255} })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := encodeWebP(&out, tt.img); err != nil {
+				t.Fatalf("encodeWebP() error = %v", err)
+			}
+			decoded, err := webp.Decode(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatalf("webp.Decode() error = %v", err)
+			}
+			got, ok := decoded.(*image.NRGBA)
+			if !ok {
+				t.Fatalf("webp.Decode() returned %T, want *image.NRGBA", decoded)
+			}
+			if got.Bounds() != tt.img.Bounds() {
+				t.Fatalf("decoded bounds = %v, want %v", got.Bounds(), tt.img.Bounds())
+			}
+			for y := 0; y < got.Bounds().Dy(); y++ {
+				for x := 0; x < got.Bounds().Dx(); x++ {
+					if g, w := got.NRGBAAt(x, y), tt.img.NRGBAAt(x, y); g != w {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, g, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWebPConvertsPremultiplied(t *testing.T) {
+	// renderThumbnail produit un *image.RGBA décalé ou non : les couleurs doivent être dé-prémultipliées
+	src := image.NewRGBA(image.Rect(5, 5, 9, 7))
+	src.SetRGBA(5, 5, color.RGBA{100, 50, 0, 200})
+	src.SetRGBA(8, 6, color.RGBA{255, 255, 255, 255})
+
+	var out bytes.Buffer
+	if err := encodeWebP(&out, src); err != nil {
+		t.Fatalf("encodeWebP() error = %v", err)
+	}
+	if ct := http.DetectContentType(out.Bytes()); ct != "image/webp" {
+		t.Errorf("content type = %q, want image/webp", ct)
+	}
+	decoded, err := webp.Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("webp.Decode() error = %v", err)
+	}
+	if decoded.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("decoded bounds = %v", decoded.Bounds())
+	}
+	want := color.NRGBAModel.Convert(src.At(5, 5)).(color.NRGBA)
+	if got := decoded.(*image.NRGBA).NRGBAAt(0, 0); got != want {
+		t.Errorf("pixel (0, 0) = %v, want %v", got, want)
+	}
+	if got := decoded.(*image.NRGBA).NRGBAAt(3, 1); got != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel (3, 1) = %v, want opaque white", got)
+	}
+}
+
+func TestHuffmanCodeLengthsLimit(t *testing.T) {
+	// Des effectifs de Fibonacci donnent un arbre de Huffman de profondeur n-1 sans limite
+	histogram := make([]int, 30)
+	histogram[0], histogram[1] = 1, 1
+	for i := 2; i < len(histogram); i++ {
+		histogram[i] = histogram[i-1] + histogram[i-2]
+	}
+	for _, limit := range []int{vp8lMaxCodeLength, vp8lMaxCodeLengthLength} {
+		lengths := huffmanCodeLengths(histogram, limit)
+		kraft := 0
+		for symbol, l := range lengths {
+			if l == 0 || int(l) > limit {
+				t.Fatalf("limit %d: symbol %d has length %d", limit, symbol, l)
+			}
+			kraft += 1 << (limit - int(l))
+		}
+		// Un code préfixe complet : la somme de Kraft vaut exactement 1
+		if kraft != 1<<limit {
+			t.Errorf("limit %d: Kraft sum = %d/%d, want 1", limit, kraft, 1<<limit)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
 	"gorm.io/gorm"
 )
 
@@ -18,6 +20,62 @@ type CreateS3ConfigRequest struct {
 	ClientSecret   string `json:"client_secret"`
 	Region         string `json:"region,omitempty"`
 	ForcePathStyle bool   `json:"force_path_style,omitempty"`
+	// Champs optionnels : absents d'une mise à jour, la valeur actuelle du projet est conservée
+	DownloadMode *string `json:"download_mode,omitempty"` // "presign" (défaut) ou "proxy"
+	// Chiffrement par défaut des uploads ("", "sse-s3" ou "sse-c") et clé du trousseau pour "sse-c"
+	DefaultEncryption *string `json:"default_encryption,omitempty"`
+	DefaultSSEKey     *string `json:"default_sse_key,omitempty"`
+	// Refuser toute écriture sur une clé existante (uploads, extraction d'archives...)
+	NeverOverwrite *bool `json:"never_overwrite,omitempty"`
+	// Corbeille : suppressions restaurables pendant TrashRetentionDays jours (30 par défaut)
+	TrashEnabled       *bool `json:"trash_enabled,omitempty"`
+	TrashRetentionDays *int  `json:"trash_retention_days,omitempty"`
+}
+
+// optional renvoie la valeur d'un champ optionnel de la requête, ou fallback s'il est absent
+func optional[T any](value *T, fallback T) T {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
+// validateDownloadMode normalise le mode de téléchargement d'une config
+func validateDownloadMode(mode string) (string, bool) {
+	switch mode {
+	case "":
+		return downloadModePresign, true
+	case downloadModePresign, downloadModeProxy:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// validateTrashRetention applique la durée par défaut de la corbeille (jours)
+func validateTrashRetention(days int) (int, bool) {
+	if days == 0 {
+		return s3.DefaultTrashRetentionDays, true
+	}
+	return days, days > 0 && days <= 3650
+}
+
+// validateDefaultEncryption vérifie le chiffrement par défaut d'un projet. La clé SSE-C
+// doit déjà être dans le trousseau : un projet neuf ne peut donc pas partir en "sse-c".
+func validateDefaultEncryption(projectID uint, mode, keyName string) string {
+	if !s3.ValidEncryptionMode(mode) {
+		return "Default encryption must be '', 'sse-s3' or 'sse-c'"
+	}
+	if mode != s3.EncryptionSSEC {
+		return ""
+	}
+	if keyName == "" {
+		return "default_sse_key is required for 'sse-c'"
+	}
+	if _, err := resolveSSECKey(projectID, keyName); err != nil {
+		return fmt.Sprintf("SSE-C key %q: %v", keyName, err)
+	}
+	return ""
 }
 
 // HandleGetS3Configs retourne les configs S3 de l'utilisateur
@@ -86,6 +144,25 @@ func HandleCreateS3Config(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	downloadMode, ok := validateDownloadMode(optional(req.DownloadMode, ""))
+	if !ok {
+		jsonError(w, "Download mode must be 'presign' or 'proxy'", http.StatusBadRequest)
+		return
+	}
+
+	trashRetention, ok := validateTrashRetention(optional(req.TrashRetentionDays, 0))
+	if !ok {
+		jsonError(w, "Trash retention must be between 1 and 3650 days", http.StatusBadRequest)
+		return
+	}
+
+	defaultEncryption := optional(req.DefaultEncryption, "")
+	defaultSSEKey := optional(req.DefaultSSEKey, "")
+	if msg := validateDefaultEncryption(0, defaultEncryption, defaultSSEKey); msg != "" {
+		jsonError(w, msg, http.StatusBadRequest)
+		return
+	}
+
 	// Vérifier si une config avec ce nom existe déjà pour cet utilisateur (même soft-deleted)
 	var existingConfig S3Config
 	err = db.Unscoped().Where("user_id = ? AND name = ?", userID, req.Name).First(&existingConfig).Error
@@ -103,6 +180,24 @@ func HandleCreateS3Config(w http.ResponseWriter, r *http.Request) {
 			existingConfig.ClientSecret = req.ClientSecret
 			existingConfig.Region = req.Region
 			existingConfig.ForcePathStyle = req.ForcePathStyle
+			if req.DownloadMode != nil {
+				existingConfig.DownloadMode = downloadMode
+			}
+			if req.DefaultEncryption != nil {
+				existingConfig.DefaultEncryption = defaultEncryption
+			}
+			if req.DefaultSSEKey != nil {
+				existingConfig.DefaultSSEKey = defaultSSEKey
+			}
+			if req.NeverOverwrite != nil {
+				existingConfig.NeverOverwrite = *req.NeverOverwrite
+			}
+			if req.TrashEnabled != nil {
+				existingConfig.TrashEnabled = *req.TrashEnabled
+			}
+			if req.TrashRetentionDays != nil {
+				existingConfig.TrashRetention = trashRetention
+			}
 
 			if existingConfig.Region == "" {
 				if existingConfig.Type == "garage" {
@@ -129,16 +224,22 @@ func HandleCreateS3Config(w http.ResponseWriter, r *http.Request) {
 
 	// La config n'existe pas, on la crée
 	config := S3Config{
-		UserID:         userID,
-		Name:           req.Name,
-		Type:           req.Type,
-		S3URL:          req.S3URL,
-		AdminURL:       req.AdminURL,
-		AdminToken:     req.AdminToken,
-		ClientID:       req.ClientID,
-		ClientSecret:   req.ClientSecret,
-		Region:         req.Region,
-		ForcePathStyle: req.ForcePathStyle,
+		UserID:            userID,
+		Name:              req.Name,
+		Type:              req.Type,
+		S3URL:             req.S3URL,
+		AdminURL:          req.AdminURL,
+		AdminToken:        req.AdminToken,
+		ClientID:          req.ClientID,
+		ClientSecret:      req.ClientSecret,
+		Region:            req.Region,
+		ForcePathStyle:    req.ForcePathStyle,
+		DownloadMode:      downloadMode,
+		DefaultEncryption: defaultEncryption,
+		DefaultSSEKey:     defaultSSEKey,
+		NeverOverwrite:    optional(req.NeverOverwrite, false),
+		TrashEnabled:      optional(req.TrashEnabled, false),
+		TrashRetention:    trashRetention,
 	}
 
 	if config.Region == "" {
@@ -213,6 +314,26 @@ func HandleUpdateS3Config(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	downloadMode, ok := validateDownloadMode(optional(req.DownloadMode, config.DownloadMode))
+	if !ok {
+		jsonError(w, "Download mode must be 'presign' or 'proxy'", http.StatusBadRequest)
+		return
+	}
+
+	trashRetention, ok := validateTrashRetention(optional(req.TrashRetentionDays, config.TrashRetention))
+	if !ok {
+		jsonError(w, "Trash retention must be between 1 and 3650 days", http.StatusBadRequest)
+		return
+	}
+
+	// Le mode et la clé sont validés ensemble, même si un seul des deux change
+	defaultEncryption := optional(req.DefaultEncryption, config.DefaultEncryption)
+	defaultSSEKey := optional(req.DefaultSSEKey, config.DefaultSSEKey)
+	if msg := validateDefaultEncryption(config.ID, defaultEncryption, defaultSSEKey); msg != "" {
+		jsonError(w, msg, http.StatusBadRequest)
+		return
+	}
+
 	config.Name = req.Name
 	config.Type = req.Type
 	config.S3URL = req.S3URL
@@ -222,6 +343,12 @@ func HandleUpdateS3Config(w http.ResponseWriter, r *http.Request) {
 	config.ClientSecret = req.ClientSecret
 	config.Region = req.Region
 	config.ForcePathStyle = req.ForcePathStyle
+	config.DownloadMode = downloadMode
+	config.DefaultEncryption = defaultEncryption
+	config.DefaultSSEKey = defaultSSEKey
+	config.NeverOverwrite = optional(req.NeverOverwrite, config.NeverOverwrite)
+	config.TrashEnabled = optional(req.TrashEnabled, config.TrashEnabled)
+	config.TrashRetention = trashRetention
 
 	if err := db.Save(&config).Error; err != nil {
 		jsonError(w, "Failed to update config", http.StatusInternalServerError)
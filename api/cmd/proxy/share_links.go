@@ -0,0 +1,426 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	shareModeRedirect = "redirect"
+	shareModeStream   = "stream"
+
+	// Durée de validité de l'URL présignée générée à chaque téléchargement via un lien
+	shareRedirectExpiry = 5 * time.Minute
+
+	// Mots de passe faux tolérés par lien et par IP avant blocage jusqu'à la fin de la fenêtre
+	sharePasswordMaxAttempts = 5
+	sharePasswordWindow      = 15 * time.Minute
+
+	// sharePasswordHeader porte le mot de passe d'un lien protégé (alternative au champ POST "password")
+	sharePasswordHeader = "X-Share-Password"
+)
+
+// sharePasswordFailures compte les mots de passe faux par lien et par IP
+var sharePasswordFailures = struct {
+	sync.Mutex
+	attempts map[string]*sharePasswordAttempts
+}{attempts: map[string]*sharePasswordAttempts{}}
+
+type sharePasswordAttempts struct {
+	count int
+	since time.Time
+}
+
+// sharePasswordBlocked indique si l'IP a épuisé ses essais sur ce lien, et pour combien de temps
+func sharePasswordBlocked(linkID uint, ip string) (time.Duration, bool) {
+	sharePasswordFailures.Lock()
+	defer sharePasswordFailures.Unlock()
+	a, ok := sharePasswordFailures.attempts[fmt.Sprintf("%d/%s", linkID, ip)]
+	if !ok || a.count < sharePasswordMaxAttempts {
+		return 0, false
+	}
+	remaining := sharePasswordWindow - time.Since(a.since)
+	return remaining, remaining > 0
+}
+
+func recordSharePasswordFailure(linkID uint, ip string) {
+	sharePasswordFailures.Lock()
+	defer sharePasswordFailures.Unlock()
+	now := time.Now()
+	// Purge des fenêtres expirées pour que la table ne grossisse pas indéfiniment
+	for k, a := range sharePasswordFailures.attempts {
+		if now.Sub(a.since) > sharePasswordWindow {
+			delete(sharePasswordFailures.attempts, k)
+		}
+	}
+	key := fmt.Sprintf("%d/%s", linkID, ip)
+	a, ok := sharePasswordFailures.attempts[key]
+	if !ok {
+		a = &sharePasswordAttempts{since: now}
+		sharePasswordFailures.attempts[key] = a
+	}
+	a.count++
+}
+
+func clearSharePasswordFailures(linkID uint, ip string) {
+	sharePasswordFailures.Lock()
+	defer sharePasswordFailures.Unlock()
+	delete(sharePasswordFailures.attempts, fmt.Sprintf("%d/%s", linkID, ip))
+}
+
+type CreateShareLinkRequest struct {
+	KeyId        string `json:"keyId"`
+	Token        string `json:"token"`
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	ExpiresIn    int64  `json:"expiresIn,omitempty"` // En secondes, 0 = pas d'expiration
+	Password     string `json:"password,omitempty"`
+	MaxDownloads int    `json:"maxDownloads,omitempty"` // 0 = illimité
+	Mode         string `json:"mode,omitempty"`         // "redirect" (défaut) ou "stream"
+}
+
+type ListShareLinksRequest struct {
+	Bucket         string `json:"bucket,omitempty"`
+	Key            string `json:"key,omitempty"`
+	IncludeRevoked bool   `json:"includeRevoked,omitempty"`
+}
+
+type RevokeShareLinkRequest struct {
+	ID uint `json:"id"`
+}
+
+// ShareLinkResponse expose un lien sans son hash de mot de passe
+type ShareLinkResponse struct {
+	ShareLink
+	URL         string `json:"url"`
+	HasPassword bool   `json:"has_password"`
+}
+
+func newShareLinkResponse(link ShareLink) ShareLinkResponse {
+	return ShareLinkResponse{
+		ShareLink:   link,
+		URL:         "/s/" + link.Token,
+		HasPassword: link.PasswordHash != "",
+	}
+}
+
+// countsAsDownload indique si une requête consomme un téléchargement : HEAD et les Range qui ne
+// partent pas du début (lecture vidéo, reprise d'un téléchargement) n'en consomment pas
+func countsAsDownload(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	spec, ok := strings.CutPrefix(strings.TrimSpace(r.Header.Get("Range")), "bytes=")
+	if !ok {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(spec), "0-")
+}
+
+func generateShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HandleCreateShareLink gère POST /api/{projectId}/s3/create-share-link
+func HandleCreateShareLink(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Bucket == "" || req.Key == "" {
+		jsonError(w, "bucket and key are required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresIn < 0 || req.MaxDownloads < 0 {
+		jsonError(w, "expiresIn and maxDownloads must be positive", http.StatusBadRequest)
+		return
+	}
+
+	mode := req.Mode
+	if mode != "" && mode != shareModeRedirect && mode != shareModeStream {
+		jsonError(w, "mode must be 'redirect' or 'stream'", http.StatusBadRequest)
+		return
+	}
+
+	readSSE, err := s3.ResolveReadEncryption(config, s3.SSEOptions{})
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Vérifier que l'objet existe avant de le partager
+	client, ok := s3ClientForRequest(w, config, req.KeyId, req.Token)
+	if !ok {
+		return
+	}
+	_, sse, err := readSSE.Stat(r.Context(), client, req.Bucket, req.Key, "")
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			jsonError(w, "Object not found", http.StatusNotFound)
+		} else {
+			jsonError(w, fmt.Sprintf("Failed to stat object: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Une URL présignée ne peut pas porter la clé SSE-C : l'objet passe forcément par le proxy
+	switch {
+	case sse != nil && mode == shareModeRedirect:
+		jsonError(w, "SSE-C objects cannot be shared in redirect mode: use mode 'stream'", http.StatusBadRequest)
+		return
+	case sse != nil:
+		mode = shareModeStream
+	case mode == "":
+		mode = shareModeRedirect
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		jsonError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	link := ShareLink{
+		Token:        token,
+		ProjectID:    config.ID,
+		UserID:       config.UserID,
+		Bucket:       req.Bucket,
+		Key:          req.Key,
+		Mode:         mode,
+		MaxDownloads: req.MaxDownloads,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		link.ExpiresAt = &expiresAt
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			jsonError(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	if err := db.Create(&link).Error; err != nil {
+		jsonError(w, "Failed to create share link", http.StatusInternalServerError)
+		return
+	}
+
+	LogActivity(db, config.ID, config.UserID, "create_share_link", fmt.Sprintf("Created share link for %s/%s", link.Bucket, link.Key), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newShareLinkResponse(link))
+}
+
+// HandleListShareLinks gère POST /api/{projectId}/s3/list-share-links
+func HandleListShareLinks(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ListShareLinksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	query := db.Where("project_id = ?", config.ID)
+	if req.Bucket != "" {
+		query = query.Where("bucket = ?", req.Bucket)
+	}
+	if req.Key != "" {
+		query = query.Where("`key` = ?", req.Key)
+	}
+	if !req.IncludeRevoked {
+		query = query.Where("revoked_at IS NULL")
+	}
+
+	var links []ShareLink
+	if err := query.Order("created_at desc").Find(&links).Error; err != nil {
+		jsonError(w, "Failed to fetch share links", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]ShareLinkResponse, len(links))
+	for i, link := range links {
+		resp[i] = newShareLinkResponse(link)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"links": resp})
+}
+
+// HandleRevokeShareLink gère POST /api/{projectId}/s3/revoke-share-link
+func HandleRevokeShareLink(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RevokeShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var link ShareLink
+	if err := db.Where("id = ? AND project_id = ?", req.ID, config.ID).First(&link).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			jsonError(w, "Share link not found", http.StatusNotFound)
+		} else {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if link.RevokedAt == nil {
+		now := time.Now()
+		if err := db.Model(&link).Update("revoked_at", &now).Error; err != nil {
+			jsonError(w, "Failed to revoke share link", http.StatusInternalServerError)
+			return
+		}
+		LogActivity(db, config.ID, config.UserID, "revoke_share_link", fmt.Sprintf("Revoked share link for %s/%s", link.Bucket, link.Key), "success")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// HandleShareLinkDownload gère la route publique GET /s/{token}. Le mot de passe éventuel est passé
+// dans le corps d'un POST (champ "password") ou l'en-tête X-Share-Password, jamais dans l'URL.
+func HandleShareLinkDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.Trim(strings.TrimPrefix(r.URL.Path, "/s/"), "/")
+	if token == "" {
+		jsonError(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	var link ShareLink
+	if err := db.Where("token = ?", token).First(&link).Error; err != nil {
+		jsonError(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	if link.RevokedAt != nil {
+		jsonError(w, "Share link has been revoked", http.StatusGone)
+		return
+	}
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		jsonError(w, "Share link has expired", http.StatusGone)
+		return
+	}
+	if link.PasswordHash != "" {
+		ip := clientIP(r)
+		if wait, blocked := sharePasswordBlocked(link.ID, ip); blocked {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+			jsonError(w, "Too many wrong passwords, try again later", http.StatusTooManyRequests)
+			return
+		}
+		password := r.Header.Get(sharePasswordHeader)
+		if password == "" && r.Method == http.MethodPost {
+			password = r.PostFormValue("password")
+		}
+		if password == "" {
+			jsonError(w, "Password required", http.StatusUnauthorized)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			recordSharePasswordFailure(link.ID, ip)
+			jsonError(w, "Wrong password", http.StatusUnauthorized)
+			return
+		}
+		clearSharePasswordFailures(link.ID, ip)
+	}
+
+	config, err := getS3Config(link.ProjectID, link.UserID)
+	if err != nil {
+		jsonError(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	creds, err := s3.GetS3Credentials(config, "", "")
+	if err != nil {
+		jsonError(w, "Share link is not available", http.StatusServiceUnavailable)
+		return
+	}
+	client, err := s3.CreateS3Client(creds)
+	if err != nil {
+		jsonError(w, "Share link is not available", http.StatusServiceUnavailable)
+		return
+	}
+	readSSE, err := s3.ResolveReadEncryption(config, s3.SSEOptions{})
+	if err != nil {
+		jsonError(w, "Share link is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if countsAsDownload(r) {
+		// Incrément atomique pour respecter la limite de téléchargements même en cas de requêtes concurrentes
+		result := db.Model(&ShareLink{}).
+			Where("id = ? AND (max_downloads = 0 OR download_count < max_downloads)", link.ID).
+			UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+		if result.Error != nil {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			jsonError(w, "Download limit reached", http.StatusGone)
+			return
+		}
+
+		LogActivity(db, link.ProjectID, 0, "share_download", fmt.Sprintf("Downloaded %s/%s via share link %d from %s", link.Bucket, link.Key, link.ID, clientIP(r)), "success")
+	} else if r.Method != http.MethodHead && link.MaxDownloads > 0 && link.DownloadCount == 0 {
+		// Une suite de téléchargement suppose un téléchargement commencé et compté
+		jsonError(w, "Download must start at byte 0", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	// Les projets en mode "proxy" ne peuvent pas rediriger vers S3URL, souvent injoignable
+	if link.Mode == shareModeStream || config.DownloadMode == downloadModeProxy {
+		s3.ServeObject(w, r, client, link.Bucket, link.Key, s3.ServeObjectOptions{CacheControl: "no-store", Encryption: readSSE})
+		return
+	}
+
+	disposition := s3.ContentDisposition("attachment", path.Base(link.Key))
+	params := url.Values{}
+	params.Set("response-content-disposition", disposition)
+	presignedURL, err := client.PresignedGetObject(r.Context(), link.Bucket, link.Key, shareRedirectExpiry, params)
+	if err != nil {
+		jsonError(w, "Failed to presign object", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, presignedURL.String(), http.StatusFound)
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+)
+
+const (
+	trashListDefaultLimit = 100
+	trashListMaxLimit     = 1000
+	trashPurgeInterval    = time.Hour
+	trashPurgeTimeout     = 30 * time.Minute
+)
+
+type TrashListRequest struct {
+	Bucket string `json:"bucket,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+}
+
+// TrashItemsRequest cible des entrées de la corbeille (restore-trash, empty-trash)
+type TrashItemsRequest struct {
+	IDs       []uint `json:"ids,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`    // empty-trash sans ids : tout le bucket (ou toute la corbeille)
+	Overwrite bool   `json:"overwrite,omitempty"` // restore-trash : remplacer un objet recréé depuis
+}
+
+type TrashEntryView struct {
+	TrashEntry
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type TrashListResponse struct {
+	Entries       []TrashEntryView `json:"entries"`
+	Total         int64            `json:"total"`
+	Enabled       bool             `json:"enabled"`
+	RetentionDays int              `json:"retention_days"`
+}
+
+type TrashItemResult struct {
+	ID      uint   `json:"id"`
+	Bucket  string `json:"bucket"`
+	Key     string `json:"key"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"` // Code du conflit (ex. "object_exists") si la clé est reprise
+}
+
+func trashRetentionDays(config s3.S3ConfigData) int {
+	if config.TrashRetentionDays > 0 {
+		return config.TrashRetentionDays
+	}
+	return s3.DefaultTrashRetentionDays
+}
+
+func toTrashedObject(entry TrashEntry) s3.TrashedObject {
+	return s3.TrashedObject{
+		Bucket:    entry.Bucket,
+		Key:       entry.Key,
+		TrashKey:  entry.TrashKey,
+		VersionID: entry.VersionID,
+		Size:      entry.Size,
+		ETag:      entry.ETag,
+	}
+}
+
+// recordTrashedObject enregistre une suppression passée par la corbeille (branché sur s3.ObjectTrashedFunc)
+func recordTrashedObject(projectID uint, object s3.TrashedObject) error {
+	var project S3Config
+	if err := db.Select("id", "user_id").First(&project, projectID).Error; err != nil {
+		return err
+	}
+	return db.Create(&TrashEntry{
+		ProjectID: projectID,
+		UserID:    project.UserID,
+		Bucket:    object.Bucket,
+		Key:       object.Key,
+		TrashKey:  object.TrashKey,
+		VersionID: object.VersionID,
+		Size:      object.Size,
+		ETag:      object.ETag,
+	}).Error
+}
+
+// findTrashEntries charge les entrées demandées : par ids, sinon tout le bucket (ou toute la corbeille)
+func findTrashEntries(projectID uint, req TrashItemsRequest) ([]TrashEntry, error) {
+	query := db.Where("project_id = ?", projectID)
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	if req.Bucket != "" {
+		query = query.Where("bucket = ?", req.Bucket)
+	}
+	var entries []TrashEntry
+	err := query.Order("id").Find(&entries).Error
+	return entries, err
+}
+
+// purgeTrashEntries supprime définitivement les objets puis leurs entrées
+func purgeTrashEntries(ctx context.Context, client *minio.Client, entries []TrashEntry) []TrashItemResult {
+	results := make([]TrashItemResult, 0, len(entries))
+	for _, entry := range entries {
+		result := TrashItemResult{ID: entry.ID, Bucket: entry.Bucket, Key: entry.Key}
+		if err := s3.PurgeTrashed(ctx, client, toTrashedObject(entry)); err != nil {
+			result.Error = err.Error()
+		} else if err := db.Unscoped().Delete(&entry).Error; err != nil {
+			result.Error = "Failed to delete trash entry"
+		} else {
+			result.Success = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// HandleListTrash gère POST /api/{projectId}/s3/list-trash
+func HandleListTrash(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TrashListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = trashListDefaultLimit
+	}
+	if limit > trashListMaxLimit {
+		limit = trashListMaxLimit
+	}
+
+	query := db.Model(&TrashEntry{}).Where("project_id = ?", config.ID)
+	if req.Bucket != "" {
+		query = query.Where("bucket = ?", req.Bucket)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		jsonError(w, "Failed to count trash", http.StatusInternalServerError)
+		return
+	}
+	var entries []TrashEntry
+	if err := query.Order("created_at desc").Limit(limit).Offset(req.Offset).Find(&entries).Error; err != nil {
+		jsonError(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+
+	retention := trashRetentionDays(config)
+	resp := TrashListResponse{
+		Entries:       make([]TrashEntryView, 0, len(entries)),
+		Total:         total,
+		Enabled:       config.TrashEnabled,
+		RetentionDays: retention,
+	}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, TrashEntryView{TrashEntry: entry, ExpiresAt: entry.CreatedAt.AddDate(0, 0, retention)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleRestoreTrash gère POST /api/{projectId}/s3/restore-trash. Une clé recréée depuis la
+// suppression n'est remplacée qu'avec overwrite (et jamais si le projet interdit l'écrasement).
+func HandleRestoreTrash(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TrashItemsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		jsonError(w, "ids are required", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := findTrashEntries(config.ID, req)
+	if err != nil {
+		jsonError(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, "", "")
+	if !ok {
+		return
+	}
+
+	results := make([]TrashItemResult, 0, len(entries))
+	restored := 0
+	for _, entry := range entries {
+		result := TrashItemResult{ID: entry.ID, Bucket: entry.Bucket, Key: entry.Key}
+		err := s3.RestoreFromTrash(r.Context(), client, config, toTrashedObject(entry), req.Overwrite)
+		if conflict, ok := err.(*s3.WriteConflictError); ok {
+			result.Error, result.Code = conflict.Reason, conflict.Code
+		} else if err != nil {
+			result.Error = err.Error()
+		} else if err := db.Unscoped().Delete(&entry).Error; err != nil {
+			result.Error = "Failed to delete trash entry"
+		} else {
+			result.Success = true
+			restored++
+		}
+		results = append(results, result)
+	}
+
+	status := "success"
+	if restored < len(entries) {
+		status = "error"
+	}
+	LogActivity(db, config.ID, config.UserID, "restore_trash", fmt.Sprintf("Restored %d of %d objects from the trash", restored, len(entries)), status)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"restored": restored, "results": results})
+}
+
+// HandleEmptyTrash gère POST /api/{projectId}/s3/empty-trash (ids, un bucket, ou toute la corbeille)
+func HandleEmptyTrash(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TrashItemsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := findTrashEntries(config.ID, req)
+	if err != nil {
+		jsonError(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, "", "")
+	if !ok {
+		return
+	}
+
+	results := purgeTrashEntries(r.Context(), client, entries)
+	purged := 0
+	for _, result := range results {
+		if result.Success {
+			purged++
+		}
+	}
+
+	status := "success"
+	if purged < len(entries) {
+		status = "error"
+	}
+	LogActivity(db, config.ID, config.UserID, "empty_trash", fmt.Sprintf("Permanently deleted %d of %d objects from the trash", purged, len(entries)), status)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"purged": purged, "results": results})
+}
+
+// purgeExpiredTrash supprime les entrées plus anciennes que la rétention de leur projet
+func purgeExpiredTrash() {
+	var projectIDs []uint
+	if err := db.Model(&TrashEntry{}).Distinct().Pluck("project_id", &projectIDs).Error; err != nil {
+		log.Printf("Trash purge: failed to list projects: %v", err)
+		return
+	}
+
+	for _, projectID := range projectIDs {
+		var project S3Config
+		if err := db.First(&project, projectID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				// Projet supprimé : ses entrées ne désignent plus rien d'accessible
+				db.Unscoped().Where("project_id = ?", projectID).Delete(&TrashEntry{})
+			}
+			continue
+		}
+		config := toS3ConfigData(project)
+		cutoff := time.Now().AddDate(0, 0, -trashRetentionDays(config))
+
+		var entries []TrashEntry
+		if err := db.Where("project_id = ? AND created_at < ?", projectID, cutoff).Find(&entries).Error; err != nil || len(entries) == 0 {
+			continue
+		}
+
+		client, err := objectIndexClient(projectID)
+		if err != nil {
+			LogActivity(db, projectID, project.UserID, "empty_trash", fmt.Sprintf("Automatic trash purge failed: %v", err), "error")
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), trashPurgeTimeout)
+		results := purgeTrashEntries(ctx, client, entries)
+		cancel()
+
+		purged := 0
+		for _, result := range results {
+			if result.Success {
+				purged++
+			}
+		}
+		status := "success"
+		if purged < len(entries) {
+			status = "error"
+		}
+		LogActivity(db, projectID, project.UserID, "empty_trash", fmt.Sprintf("Automatically purged %d of %d objects older than %d days from the trash", purged, len(entries), trashRetentionDays(config)), status)
+	}
+}
+
+// runTrashPurgeScheduler purge chaque heure les corbeilles arrivées à expiration
+func runTrashPurgeScheduler() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purgeExpiredTrash()
+		<-ticker.C
+	}
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ketsuna-org/kexamanager/cmd/proxy/s3"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"gorm.io/gorm"
+)
+
+// Implémentation du protocole tus 1.0 (https://tus.io/protocols/resumable-upload)
+// au-dessus des uploads multipart S3. Les octets reçus qui ne remplissent pas encore
+// une part complète sont conservés dans un tampon local sous ./data/tus, ainsi que le
+// PATCH en cours tant que sa somme de contrôle n'est pas vérifiée.
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum"
+	tusChecksums  = "sha1,md5,sha256"
+	tusMaxSize    = 5 << 40 // Taille maximale d'un objet S3 (5 Tio)
+	tusBufferDir  = "./data/tus"
+
+	// Code de statut défini par l'extension checksum de tus
+	statusChecksumMismatch = 460
+)
+
+// tusLocks empêche deux requêtes PATCH concurrentes sur le même upload
+var tusLocks sync.Map
+
+func tusError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	jsonError(w, message, status)
+}
+
+func tusBufferPath(upload MultipartUpload) string {
+	return filepath.Join(tusBufferDir, fmt.Sprintf("%d.buf", upload.ID))
+}
+
+// parseTusMetadata décode l'en-tête Upload-Metadata ("clé base64,clé base64")
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid metadata pair %q", pair)
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value for %q", fields[0])
+			}
+			value = string(decoded)
+		}
+		meta[fields[0]] = value
+	}
+	return meta, nil
+}
+
+// parseTusChecksum lit l'en-tête Upload-Checksum ("algorithme base64")
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return nil, nil, fmt.Errorf("invalid Upload-Checksum header")
+	}
+	expected, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Upload-Checksum value")
+	}
+	switch fields[0] {
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", fields[0])
+	}
+}
+
+// HandleTus gère /api/{projectId}/s3/tus/ et /api/{projectId}/s3/tus/{id}
+func HandleTus(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData, path string) {
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && r.Method == http.MethodPost {
+		method = strings.ToUpper(override)
+	}
+
+	if method == http.MethodOptions {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Checksum-Algorithm", tusChecksums)
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(tusMaxSize, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		tusError(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(path, "/")
+	if id == "" {
+		if method != http.MethodPost {
+			tusError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleTusCreate(w, r, config)
+		return
+	}
+
+	uploadID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		tusError(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	var upload MultipartUpload
+	if err := db.Where("id = ? AND project_id = ? AND protocol = ?", uploadID, config.ID, multipartProtocolTus).First(&upload).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			tusError(w, "Upload not found", http.StatusNotFound)
+		} else {
+			tusError(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if upload.Status == multipartStatusAborted {
+		tusError(w, "Upload terminated", http.StatusGone)
+		return
+	}
+
+	switch method {
+	case http.MethodHead:
+		handleTusHead(w, upload)
+	case http.MethodPatch:
+		handleTusPatch(w, r, config, upload)
+	case http.MethodDelete:
+		handleTusDelete(w, r, config, upload)
+	default:
+		tusError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTusCreate implémente l'extension creation : démarre un upload multipart S3.
+// Les métadonnées doivent contenir "bucket" et soit "key", soit "filename" (avec "prefix" optionnel).
+func handleTusCreate(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		tusError(w, "Upload-Defer-Length is not supported", http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		tusError(w, "Upload-Length header is required", http.StatusBadRequest)
+		return
+	}
+	if length > tusMaxSize {
+		tusError(w, "Upload exceeds Tus-Max-Size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	meta, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		tusError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket := meta["bucket"]
+	key := meta["key"]
+	if key == "" && meta["filename"] != "" {
+		key = meta["prefix"] + meta["filename"]
+	}
+	if bucket == "" || key == "" {
+		tusError(w, "Upload-Metadata must contain bucket and key (or filename)", http.StatusBadRequest)
+		return
+	}
+
+	contentType := meta["filetype"]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	overwrite, err := s3.ParseOverwrite(meta["overwrite"])
+	if err != nil {
+		tusError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, "", "")
+	if !ok {
+		return
+	}
+
+	precondition := s3.ResolveWritePrecondition(config, s3.WritePrecondition{}, overwrite)
+	if err := checkUploadPrecondition(r.Context(), client, config, bucket, key, precondition); err != nil {
+		writeUploadPreconditionError(w, err)
+		return
+	}
+
+	encryption, sse, err := s3.ResolveUploadEncryption(config)
+	if err != nil {
+		tusError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	core := minio.Core{Client: client}
+	s3UploadID, err := core.NewMultipartUpload(r.Context(), bucket, key, minio.PutObjectOptions{
+		ContentType:          contentType,
+		ServerSideEncryption: sse,
+	})
+	if err != nil {
+		tusError(w, fmt.Sprintf("Failed to initiate multipart upload: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	upload := MultipartUpload{
+		ProjectID:   config.ID,
+		UserID:      config.UserID,
+		Bucket:      bucket,
+		Key:         key,
+		UploadID:    s3UploadID,
+		ContentType: contentType,
+		FileSize:    length,
+		PartSize:    choosePartSize(length, 0),
+		Status:      multipartStatusInProgress,
+		Protocol:    multipartProtocolTus,
+		Metadata:    rawMetadata,
+		IfNoneMatch: precondition.IfNoneMatch,
+		Encryption:  encryption.SSE,
+		SSEKeyName:  encryption.SSEKeyName,
+	}
+	if err := db.Create(&upload).Error; err != nil {
+		core.AbortMultipartUpload(r.Context(), bucket, key, s3UploadID)
+		tusError(w, "Failed to save upload", http.StatusInternalServerError)
+		return
+	}
+
+	// Un fichier vide est terminé dès sa création
+	if length == 0 {
+		if err := finishTusUpload(r.Context(), core, config, &upload); err != nil {
+			writeTusFinishError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Location", fmt.Sprintf("/api/%d/s3/tus/%d", config.ID, upload.ID))
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func handleTusHead(w http.ResponseWriter, upload MultipartUpload) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.FileSize, 10))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleTusPatch envoie à S3 chaque part complète dès qu'elle est reçue, garde le reste
+// dans le tampon local et termine l'upload multipart quand Upload-Length est atteint.
+func handleTusPatch(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData, upload MultipartUpload) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		tusError(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	lock, _ := tusLocks.LoadOrStore(upload.ID, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	if !mu.TryLock() {
+		tusError(w, "Upload is locked by another request", http.StatusLocked)
+		return
+	}
+	defer mu.Unlock()
+
+	// Relire l'état après avoir obtenu le verrou
+	if err := db.First(&upload, upload.ID).Error; err != nil {
+		tusError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if upload.Status != multipartStatusInProgress {
+		tusError(w, fmt.Sprintf("Upload is %s", upload.Status), http.StatusForbidden)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		tusError(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+		return
+	}
+
+	hasher, expectedSum, err := parseTusChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		tusError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sse, err := uploadEncryption(config, upload)
+	if err != nil {
+		tusError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, "", "")
+	if !ok {
+		return
+	}
+	core := minio.Core{Client: client}
+
+	if err := os.MkdirAll(tusBufferDir, 0755); err != nil {
+		tusError(w, "Failed to create upload buffer", http.StatusInternalServerError)
+		return
+	}
+	buf, err := os.OpenFile(tusBufferPath(upload), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		tusError(w, "Failed to open upload buffer", http.StatusInternalServerError)
+		return
+	}
+	defer buf.Close()
+
+	bufferedBefore, err := buf.Seek(0, io.SeekEnd)
+	if err != nil {
+		tusError(w, "Failed to read upload buffer", http.StatusInternalServerError)
+		return
+	}
+
+	remaining := upload.FileSize - upload.Offset
+	if r.ContentLength > remaining {
+		tusError(w, "Request body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var copyErr, flushErr error
+	if hasher != nil {
+		// Avec une somme de contrôle, les octets de ce PATCH restent dans le tampon jusqu'à la
+		// vérification : un chunk incomplet ou corrompu est entièrement rejeté
+		n, err := io.Copy(io.MultiWriter(buf, hasher), io.LimitReader(r.Body, remaining+1))
+		if n > remaining {
+			buf.Truncate(bufferedBefore)
+			tusError(w, "Request body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			buf.Truncate(bufferedBefore)
+			tusError(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !bytes.Equal(hasher.Sum(nil), expectedSum) {
+			buf.Truncate(bufferedBefore)
+			tusError(w, "Checksum mismatch", statusChecksumMismatch)
+			return
+		}
+		upload.Offset += n
+		flushErr = flushTusBuffer(r.Context(), core, &upload, sse, buf, bufferedBefore+n, upload.Offset == upload.FileSize)
+	} else {
+		// Sans somme de contrôle, le corps est envoyé part par part au fil de la lecture et les
+		// octets reçus avant une coupure sont conservés
+		copyErr, flushErr = streamTusBody(r.Context(), core, &upload, sse, buf, bufferedBefore, r.Body)
+	}
+	final := upload.Offset == upload.FileSize
+
+	if err := saveTusProgress(&upload); err != nil {
+		tusError(w, "Failed to save upload state", http.StatusInternalServerError)
+		return
+	}
+
+	if flushErr != nil {
+		tusError(w, fmt.Sprintf("Failed to upload part: %v", flushErr), http.StatusInternalServerError)
+		return
+	}
+	if copyErr != nil {
+		tusError(w, fmt.Sprintf("Failed to read request body: %v", copyErr), http.StatusBadRequest)
+		return
+	}
+	if final && hasher == nil {
+		// Corps sans longueur annoncée : les octets en trop ne sont pas lus, l'upload n'est pas terminé
+		if extra, _ := r.Body.Read(make([]byte, 1)); extra > 0 {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			tusError(w, "Request body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	if final {
+		buf.Close()
+		if err := finishTusUpload(r.Context(), core, config, &upload); err != nil {
+			writeTusFinishError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// streamTusBody lit le corps dans le tampon jusqu'à remplir une part, l'envoie à S3 et
+// recommence : le tampon ne dépasse jamais PartSize, quelle que soit la taille du PATCH.
+// L'état est enregistré après chaque part pour qu'une reprise reparte du bon offset.
+func streamTusBody(ctx context.Context, core minio.Core, upload *MultipartUpload, sse encrypt.ServerSide, buf *os.File, buffered int64, body io.Reader) (readErr, flushErr error) {
+	for {
+		want := min(upload.PartSize-buffered, upload.FileSize-upload.Offset)
+		n, err := io.Copy(io.NewOffsetWriter(buf, buffered), io.LimitReader(body, want))
+		buffered += n
+		upload.Offset += n
+
+		final := upload.Offset == upload.FileSize
+		if buffered == upload.PartSize || (final && buffered > 0) {
+			if err := flushTusBuffer(ctx, core, upload, sse, buf, buffered, final); err != nil {
+				return nil, err
+			}
+			buffered = 0
+			if err := saveTusProgress(upload); err != nil {
+				return nil, err
+			}
+		}
+		if err != nil || n < want || final {
+			return err, nil
+		}
+	}
+}
+
+// saveTusProgress enregistre l'offset et le nombre de parts envoyées
+func saveTusProgress(upload *MultipartUpload) error {
+	return db.Model(upload).Updates(map[string]interface{}{
+		"offset":     upload.Offset,
+		"part_count": upload.PartCount,
+	}).Error
+}
+
+// flushTusBuffer envoie à S3 les parts complètes présentes dans le tampon (et le reste
+// si final est vrai), puis ne garde dans le tampon que les octets non envoyés.
+func flushTusBuffer(ctx context.Context, core minio.Core, upload *MultipartUpload, sse encrypt.ServerSide, buf *os.File, size int64, final bool) error {
+	var pos int64
+	var err error
+	for size-pos >= upload.PartSize || (final && size > pos) {
+		partLen := size - pos
+		if partLen > upload.PartSize {
+			partLen = upload.PartSize
+		}
+		section := io.NewSectionReader(buf, pos, partLen)
+		if _, err = core.PutObjectPart(ctx, upload.Bucket, upload.Key, upload.UploadID, upload.PartCount+1, section, partLen, minio.PutObjectPartOptions{SSE: sse}); err != nil {
+			break
+		}
+		upload.PartCount++
+		pos += partLen
+	}
+
+	if pos > 0 {
+		// Ramener les octets restants au début du tampon
+		rest := io.NewSectionReader(buf, pos, size-pos)
+		if _, copyErr := io.Copy(io.NewOffsetWriter(buf, 0), rest); copyErr != nil && err == nil {
+			err = copyErr
+		}
+		if truncErr := buf.Truncate(size - pos); truncErr != nil && err == nil {
+			err = truncErr
+		}
+	}
+	return err
+}
+
+// writeTusFinishError répond 409 (structuré) si la clé a été créée entre-temps
+func writeTusFinishError(w http.ResponseWriter, err error) {
+	if conflict, ok := err.(*s3.WriteConflictError); ok {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		s3.WriteConflict(w, conflict)
+		return
+	}
+	tusError(w, fmt.Sprintf("Failed to complete upload: %v", err), http.StatusInternalServerError)
+}
+
+// finishTusUpload assemble les parts envoyées et marque l'upload comme terminé
+func finishTusUpload(ctx context.Context, core minio.Core, config s3.S3ConfigData, upload *MultipartUpload) error {
+	if upload.PartCount == 0 {
+		// Fichier vide : S3 exige au moins une part
+		sse, err := uploadEncryption(config, *upload)
+		if err != nil {
+			return err
+		}
+		if _, err := core.PutObjectPart(ctx, upload.Bucket, upload.Key, upload.UploadID, 1, bytes.NewReader(nil), 0, minio.PutObjectPartOptions{SSE: sse}); err != nil {
+			return err
+		}
+		upload.PartCount = 1
+	}
+
+	parts := []minio.CompletePart{}
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, upload.Bucket, upload.Key, upload.UploadID, marker, 1000)
+		if err != nil {
+			return err
+		}
+		for _, p := range result.ObjectParts {
+			parts = append(parts, minio.CompletePart{PartNumber: p.PartNumber, ETag: p.ETag})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	readSSE, err := s3.ResolveReadEncryption(config, s3.SSEOptions{})
+	if err != nil {
+		return err
+	}
+	precondition := s3.ResolveWritePrecondition(config, s3.WritePrecondition{IfNoneMatch: upload.IfNoneMatch}, nil)
+	info, err := precondition.CompleteMultipart(ctx, core, upload.Bucket, upload.Key, upload.UploadID, parts, minio.PutObjectOptions{}, readSSE)
+	if err != nil {
+		if _, ok := err.(*s3.WriteConflictError); ok {
+			// La clé a été créée pendant l'envoi : les parts ne serviront plus
+			core.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID)
+			upload.Status = multipartStatusAborted
+			db.Model(upload).Update("status", upload.Status)
+			os.Remove(tusBufferPath(*upload))
+			tusLocks.Delete(upload.ID)
+		}
+		LogActivity(db, upload.ProjectID, upload.UserID, "upload_file", fmt.Sprintf("Failed to complete tus upload %s/%s: %v", upload.Bucket, upload.Key, err), "error")
+		return err
+	}
+
+	upload.Status = multipartStatusCompleted
+	if err := db.Model(upload).Updates(map[string]interface{}{
+		"status":     upload.Status,
+		"part_count": upload.PartCount,
+	}).Error; err != nil {
+		return err
+	}
+
+	os.Remove(tusBufferPath(*upload))
+	tusLocks.Delete(upload.ID)
+
+	LogActivity(db, upload.ProjectID, upload.UserID, "upload_file", fmt.Sprintf("Uploaded file %s/%s (%d bytes, tus)", upload.Bucket, upload.Key, upload.FileSize), "success")
+	indexObjectChange(upload.ProjectID, s3.ObjectChange{Bucket: upload.Bucket, Key: upload.Key, Size: upload.FileSize, ETag: info.ETag, LastModified: time.Now()})
+	return nil
+}
+
+// handleTusDelete implémente l'extension termination
+func handleTusDelete(w http.ResponseWriter, r *http.Request, config s3.S3ConfigData, upload MultipartUpload) {
+	if upload.Status == multipartStatusCompleted {
+		tusError(w, "Upload already completed", http.StatusForbidden)
+		return
+	}
+
+	client, ok := s3ClientForRequest(w, config, "", "")
+	if !ok {
+		return
+	}
+
+	core := minio.Core{Client: client}
+	if err := core.AbortMultipartUpload(r.Context(), upload.Bucket, upload.Key, upload.UploadID); err != nil {
+		tusError(w, fmt.Sprintf("Failed to abort multipart upload: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.Model(&upload).Update("status", multipartStatusAborted).Error; err != nil {
+		tusError(w, "Failed to update upload", http.StatusInternalServerError)
+		return
+	}
+
+	os.Remove(tusBufferPath(upload))
+	tusLocks.Delete(upload.ID)
+
+	LogActivity(db, config.ID, config.UserID, "abort_upload", fmt.Sprintf("Terminated tus upload %s/%s", upload.Bucket, upload.Key), "success")
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
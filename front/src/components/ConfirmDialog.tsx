@@ -1,4 +1,5 @@
-import { Dialog, DialogTitle, DialogContent, DialogContentText, DialogActions, Button, CircularProgress } from "@mui/material"
+import { useEffect, useState } from "react"
+import { Dialog, DialogTitle, DialogContent, DialogContentText, DialogActions, Button, CircularProgress, TextField } from "@mui/material"
 import { useTranslation } from "react-i18next"
 
 interface ConfirmDialogProps {
@@ -9,6 +10,8 @@ interface ConfirmDialogProps {
     cancelLabel?: string
     confirmColor?: "primary" | "secondary" | "error" | "info" | "success" | "warning"
     loading?: boolean
+    // Texte à retaper (ex. nom du bucket) avant de pouvoir confirmer
+    confirmText?: string
     onConfirm: () => void
     onClose: () => void
 }
@@ -21,10 +24,17 @@ export default function ConfirmDialog({
     cancelLabel,
     confirmColor = "primary",
     loading = false,
+    confirmText,
     onConfirm,
     onClose
 }: ConfirmDialogProps) {
     const { t } = useTranslation()
+    const [typed, setTyped] = useState("")
+    const confirmed = !confirmText || typed === confirmText
+
+    useEffect(() => {
+        if (!open) setTyped("")
+    }, [open])
 
     return (
         <Dialog open={open} onClose={onClose} maxWidth="sm" fullWidth>
@@ -33,12 +43,23 @@ export default function ConfirmDialog({
                 <DialogContentText>
                     {message}
                 </DialogContentText>
+                {confirmText && (
+                    <TextField
+                        fullWidth
+                        margin="normal"
+                        size="small"
+                        autoFocus
+                        label={t("common.type_to_confirm", { text: confirmText, defaultValue: `Type "${confirmText}" to confirm` })}
+                        value={typed}
+                        onChange={(e) => setTyped(e.target.value)}
+                    />
+                )}
             </DialogContent>
             <DialogActions>
                 <Button onClick={onClose} color="inherit" disabled={loading}>
                     {cancelLabel || t("common.cancel", "Cancel")}
                 </Button>
-                <Button onClick={onConfirm} variant="contained" color={confirmColor} disabled={loading} autoFocus>
+                <Button onClick={onConfirm} variant="contained" color={confirmColor} disabled={loading || !confirmed} autoFocus={!confirmText}>
                     {loading ? <CircularProgress size={24} color="inherit" /> : (confirmLabel || t("common.confirm", "Confirm"))}
                 </Button>
             </DialogActions>
@@ -17,6 +17,7 @@ interface ConfirmState {
   title: string
   message: string
   confirmColor?: "primary" | "secondary" | "error" | "info" | "success" | "warning"
+  confirmText?: string
   onConfirm: () => void
 }
 
@@ -151,6 +152,7 @@ export default function S3Browser({ selectedProject }: S3BrowserProps) {
       title: t("s3browser.delete_bucket_title", "Delete Bucket"),
       message: t("s3browser.delete_bucket_confirm", `Are you sure you want to delete bucket "${name}"? This action cannot be undone.`),
       confirmColor: "error",
+      confirmText: name,
       onConfirm: () => performDeleteBucket(name)
     })
   }
@@ -160,7 +162,8 @@ export default function S3Browser({ selectedProject }: S3BrowserProps) {
     setError(null)
     try {
       await s3ApiRequest<{ success: boolean }>('delete-bucket', {
-        bucket: name
+        bucket: name,
+        confirmBucket: name
       }, selectedConfigId || undefined)
       if (selectedBucket === name) setSelectedBucket(null)
       setConfirmState(null)
@@ -734,6 +737,7 @@ export default function S3Browser({ selectedProject }: S3BrowserProps) {
         title={confirmState?.title || ""}
         message={confirmState?.message || ""}
         confirmColor={confirmState?.confirmColor}
+        confirmText={confirmState?.confirmText}
         loading={loading}
         onConfirm={confirmState?.onConfirm || (() => { })}
         onClose={() => setConfirmState(null)}